@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	cfg "github.com/christk1/kstack/internal/config"
+	"github.com/christk1/kstack/pkg/addons"
+	"github.com/christk1/kstack/pkg/bundle"
+	"github.com/christk1/kstack/pkg/cluster"
+	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/utils"
+)
+
+func newBundleCmd(opts *rootOptions) *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Create and load offline bundles of charts and images",
+		Long: "`bundle create` packages the charts, merged values, addon images and node images of a stack into one tarball.\n" +
+			"`bundle load` imports it on a machine without internet access; `kstack up` then installs from the bundle.",
+	}
+
+	var out string
+	var ha bool
+	var extraValues []string
+	var chartVersions []string
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Package the stack's charts, values and images into a tarball",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: no external commands will be executed")
+			}
+			if err := c.Validate(); err != nil {
+				return err
+			}
+			if err := applyChartVersions(&c, chartVersions); err != nil {
+				return err
+			}
+			if err := cfg.ValidateValuesFiles(extraValues); err != nil {
+				return err
+			}
+			_, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			if err := cluster.SetK8sVersion(prov, c.K8sVersion); err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+
+			hc := newHelmClient(c, "", opts.dryRun)
+			if _, err := hc.Preflight(ctx, 10*time.Second); err != nil {
+				return fmt.Errorf("helm not available or fails preflight: %w", err)
+			}
+			return createBundle(ctx, c, prov, hc, ha, extraValues, out, opts.dryRun)
+		},
+	}
+	createCmd.Flags().StringVarP(&out, "out", "o", "kstack-bundle.tar.gz", "Path of the bundle to write")
+	createCmd.Flags().BoolVar(&ha, "ha", false, "Bundle the HA variant for supported addons (e.g. postgres)")
+	createCmd.Flags().StringArrayVar(&extraValues, "values", nil, "Additional values files to bake into the bundled values. Can be supplied multiple times")
+	createCmd.Flags().StringArrayVar(&chartVersions, "chart-version", nil, "Bundle a specific chart version (addon=version). Can be supplied multiple times")
+
+	loadCmd := &cobra.Command{
+		Use:   "load <bundle>",
+		Short: "Import a bundle so that `kstack up` runs offline",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: extract %s to %s and docker load its images", args[0], bundle.Dir())
+				return nil
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			return loadBundle(ctx, args[0])
+		},
+	}
+
+	unloadCmd := &cobra.Command{
+		Use:   "unload",
+		Short: "Forget the loaded bundle; `kstack up` downloads charts and images again",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: remove %s", bundle.Dir())
+				return nil
+			}
+			if err := os.RemoveAll(bundle.Dir()); err != nil {
+				return fmt.Errorf("remove bundle: %w", err)
+			}
+			utils.Info("bundle unloaded; images stay in the local Docker daemon")
+			return nil
+		},
+	}
+
+	bundleCmd.AddCommand(createCmd, loadCmd, unloadCmd)
+	return bundleCmd
+}
+
+// createBundle pulls the chart, merged values and images of every addon
+// plus the provider's node images and packs them into out.
+func createBundle(ctx context.Context, c cfg.Config, prov cluster.Provider, hc *helm.HelmClient, ha bool, extraValues []string, out string, dryRun bool) error {
+	work, err := os.MkdirTemp("", "kstack-bundle-")
+	if err != nil {
+		return fmt.Errorf("create bundle dir: %w", err)
+	}
+	defer os.RemoveAll(work)
+
+	m := &bundle.Manifest{Created: time.Now().UTC(), Provider: c.Provider, K8sVersion: c.K8sVersion}
+	var images []string
+	seen := map[string]bool{}
+	addImages := func(imgs []string) {
+		for _, img := range imgs {
+			if !seen[img] {
+				seen[img] = true
+				images = append(images, img)
+			}
+		}
+	}
+
+	nodeImages, err := cluster.NodeImages(ctx, prov)
+	if err != nil {
+		utils.Warn("node images are not bundled: %v", err)
+	} else {
+		m.NodeImages = nodeImages
+		addImages(nodeImages)
+	}
+
+	for _, name := range c.Addons {
+		a, err := addons.Get(name)
+		if err != nil {
+			return err
+		}
+		in := resolveAddonInstall(a, ha, c.AddonOptions[name], extraValues, nil)
+		entry, err := bundleAddon(ctx, hc, in, work)
+		if err != nil {
+			return fmt.Errorf("bundle addon %s: %w", name, err)
+		}
+		m.Addons = append(m.Addons, entry)
+		addImages(entry.Images)
+		utils.Info("bundled addon %s (%s, %d image(s))", name, in.chart, len(entry.Images))
+	}
+
+	if _, _, err := cluster.PullMissingImages(ctx, images, dryRun); err != nil {
+		return err
+	}
+	if len(images) > 0 {
+		if err := bundle.SaveImages(ctx, images, filepath.Join(work, bundle.ImagesFile), dryRun); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		utils.Info("DRY-RUN: write bundle %s", out)
+		return nil
+	}
+	if err := bundle.WriteManifest(work, m); err != nil {
+		return err
+	}
+	if err := bundle.Pack(work, out); err != nil {
+		return err
+	}
+	utils.Info("wrote %s: %d addon(s), %d image(s)", out, len(m.Addons), len(images))
+	return nil
+}
+
+// bundleAddon stores the chart archive and merged values of in under dir
+// and returns the manifest entry with the images the chart renders.
+func bundleAddon(ctx context.Context, hc *helm.HelmClient, in addonInstall, dir string) (bundle.Addon, error) {
+	name := in.addon.Name()
+	entry := bundle.Addon{Name: name, Chart: in.chart, Version: in.version}
+	if err := addRepo(ctx, hc, in); err != nil {
+		return entry, err
+	}
+	chartDir := filepath.Join(dir, "charts", name)
+	if err := os.MkdirAll(chartDir, 0o755); err != nil {
+		return entry, err
+	}
+	archive, err := hc.Pull(ctx, in.chart, in.version, chartDir)
+	if err != nil {
+		return entry, err
+	}
+	if archive != "" {
+		entry.Archive = filepath.ToSlash(filepath.Join("charts", name, filepath.Base(archive)))
+	}
+
+	merged, cleanup, err := helm.MergeValues(in.values, nil)
+	if err != nil {
+		return entry, err
+	}
+	defer func() {
+		if cerr := cleanup(); cerr != nil {
+			utils.Debug("cleanup error: %v", cerr)
+		}
+	}()
+	b, err := os.ReadFile(merged)
+	if err != nil {
+		return entry, fmt.Errorf("read merged values: %w", err)
+	}
+	entry.Values = filepath.ToSlash(filepath.Join("values", name+".yaml"))
+	if err := os.MkdirAll(filepath.Join(dir, "values"), 0o755); err != nil {
+		return entry, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, entry.Values), b, 0o644); err != nil {
+		return entry, fmt.Errorf("write bundled values: %w", err)
+	}
+
+	manifests, err := hc.Template(ctx, name, in.chart, in.version, in.addon.Namespace(), merged, in.set, false)
+	if err != nil {
+		return entry, err
+	}
+	entry.Images, err = helm.ManifestImages(manifests)
+	return entry, err
+}
+
+// loadBundle extracts the bundle at path as the active bundle and imports
+// its images into the local Docker daemon.
+func loadBundle(ctx context.Context, path string) error {
+	dest := bundle.Dir()
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), "bundle-")
+	if err != nil {
+		return fmt.Errorf("create bundle dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := bundle.Unpack(path, tmp); err != nil {
+		return err
+	}
+	m, err := bundle.ReadManifest(tmp)
+	if err != nil {
+		return fmt.Errorf("%s is not a kstack bundle: %w", path, err)
+	}
+	if images := filepath.Join(tmp, bundle.ImagesFile); fileExists(images) {
+		utils.Info("importing images into the local Docker daemon...")
+		if err := bundle.LoadImages(ctx, images, false); err != nil {
+			return err
+		}
+		// the images now live in Docker; keep only charts and values
+		if err := os.Remove(images); err != nil {
+			utils.Debug("remove %s: %v", images, err)
+		}
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return fmt.Errorf("replace bundle: %w", err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return fmt.Errorf("replace bundle: %w", err)
+	}
+	names := make([]string, 0, len(m.Addons))
+	for _, a := range m.Addons {
+		names = append(names, a.Name)
+	}
+	utils.Info("loaded bundle for provider %s (addons: %s); `kstack up` now installs from it offline", m.Provider, strings.Join(names, ", "))
+	return nil
+}
+
+// useBundle switches in to the chart archive and values of the loaded
+// bundle m when it contains the addon, keeping extra values from the
+// command line on top. It reports whether the bundle was used.
+func useBundle(in *addonInstall, m *bundle.Manifest, extraValues []string) bool {
+	if m == nil {
+		return false
+	}
+	entry, ok := m.Addon(in.addon.Name(), in.chart)
+	if !ok {
+		utils.Warn("addon %s (%s) is not in the loaded bundle; installing it from its repository", in.addon.Name(), in.chart)
+		return false
+	}
+	if entry.Version != in.version {
+		utils.Warn("the loaded bundle has addon %s at chart version %q but %q is requested; installing it from its repository", in.addon.Name(), entry.Version, in.version)
+		return false
+	}
+	in.archive = entry.Archive
+	in.values = append([]string{entry.Values}, extraValues...)
+	return true
+}
+
+// useBundleNodeImage creates the cluster from the bundled node image unless
+// the configuration selects a node image itself.
+func useBundleNodeImage(c cfg.Config, prov cluster.Provider, m *bundle.Manifest) {
+	if len(m.NodeImages) == 0 {
+		return
+	}
+	if m.Provider != c.Provider {
+		utils.Warn("the loaded bundle was created for provider %s; node images will be pulled for %s", m.Provider, c.Provider)
+		return
+	}
+	if c.K8sVersion != m.K8sVersion {
+		utils.Warn("the loaded bundle pins k8s-version %q but the stack asks for %q; node images will be pulled", m.K8sVersion, c.K8sVersion)
+		return
+	}
+	if s := c.ProviderSettings(); c.K8sVersion != "" || s != nil && (s.NodeImage() != "" || s.ConfigPath() != "") {
+		// the configuration resolves to the bundled image by itself
+		return
+	}
+	if err := cluster.SetNodeImage(prov, m.NodeImages[0]); err != nil {
+		utils.Warn("%v", err)
+	}
+}
+
+// loadBundleImages loads the bundled addon images from the local Docker
+// daemon into the cluster's nodes so that no pod has to pull.
+func loadBundleImages(ctx context.Context, prov cluster.Provider, m *bundle.Manifest, dryRun bool) {
+	images := m.Images()
+	if len(images) == 0 {
+		return
+	}
+	if dryRun {
+		utils.Info("DRY-RUN: load %d bundled image(s) into the cluster's nodes", len(images))
+		return
+	}
+	nodes, err := cluster.LoadImages(ctx, prov, images)
+	if err != nil {
+		utils.Warn("loading bundled images into the cluster failed: %v", err)
+		return
+	}
+	utils.Info("loaded %d bundled image(s) into %d node(s)", len(images), len(nodes))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/christk1/kstack/pkg/cluster"
+	"github.com/christk1/kstack/utils"
+)
+
+func newCacheCmd(opts *rootOptions) *cobra.Command {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and trim the pull-through registry caches",
+		Long: "`kstack up --cache` runs pull-through caches for " + strings.Join(cluster.CacheRegistries(), ", ") + "\n" +
+			"as local containers shared by all clusters, so recreated clusters pull images from the cache.",
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the cache containers and how much they store",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: docker ps -a --filter label=dev.kstack.cache")
+				return nil
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			infos, err := cluster.CacheStatus(ctx)
+			if err != nil {
+				return err
+			}
+			if len(infos) == 0 {
+				utils.Info("no caches found; run `kstack up --cache` to create them")
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "REGISTRY\tCONTAINER\tSTATE\tSIZE")
+			for _, in := range infos {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", in.Registry, in.Container, in.State, formatSize(in.Size))
+			}
+			return w.Flush()
+		},
+	}
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune [registry...]",
+		Short: "Remove caches and their data (all caches by default)",
+		Long: "Removes the cache containers and volumes for the given registries (" + strings.Join(cluster.CacheRegistries(), ", ") + "),\n" +
+			"or all of them. Clusters fall back to the upstream registries until `kstack up --cache` recreates the caches.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: no external commands will be executed")
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			removed, err := cluster.PruneCaches(ctx, args, opts.dryRun)
+			for _, name := range removed {
+				utils.Info("removed cache %s", name)
+			}
+			if err != nil {
+				return err
+			}
+			if len(removed) == 0 && !opts.dryRun {
+				utils.Info("no caches to remove")
+			}
+			return nil
+		},
+	}
+
+	cacheCmd.AddCommand(statusCmd, pruneCmd)
+	return cacheCmd
+}
+
+// formatSize renders a byte count for humans; negative means unknown.
+func formatSize(n int64) string {
+	if n < 0 {
+		return "-"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
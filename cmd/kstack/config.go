@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	cfg "github.com/christk1/kstack/internal/config"
+)
+
+// loadConfig resolves the effective configuration for a command. See
+// resolveConfig for the layering order.
+func loadConfig(cmd *cobra.Command, opts *rootOptions) (cfg.Config, error) {
+	c, _, err := resolveConfig(cmd, opts)
+	return c, err
+}
+
+// resolveConfig layers built-in defaults, the user config file, the project
+// stack file (--file or ./kstack.yaml), KSTACK_*/GO_CLOUD_* environment
+// variables and explicitly set flags, returning the origin of each setting.
+func resolveConfig(cmd *cobra.Command, opts *rootOptions) (cfg.Config, cfg.Origins, error) {
+	flags := map[string]string{}
+	for _, f := range []struct {
+		key     string
+		value   string
+		nonZero bool
+	}{
+		{"provider", opts.provider, opts.provider != ""},
+		{"cluster", opts.clusterName, opts.clusterName != ""},
+		{"addons", opts.addons, opts.addons != ""},
+		{"namespace", opts.namespace, opts.namespace != ""},
+		{"kubeconfig", opts.kubeconfig, opts.kubeconfig != ""},
+		{"context", opts.kubeContext, opts.kubeContext != ""},
+		{"helm", opts.helmPath, opts.helmPath != ""},
+		{"k8s-version", opts.k8sVersion, opts.k8sVersion != ""},
+		{"timeout", opts.timeout.String(), opts.timeout > 0},
+		{"verbose", strconv.FormatBool(opts.verbose), opts.verbose},
+		{"debug", strconv.FormatBool(opts.debug), opts.debug},
+	} {
+		if flagSet(cmd, f.key, f.nonZero) {
+			flags[f.key] = f.value
+		}
+	}
+	return cfg.Load(cfg.Sources{StackFile: opts.stackFile, Flags: flags})
+}
+
+// flagSet reports whether the named flag was explicitly provided. When the
+// command is not attached to the root (e.g. in tests constructing
+// subcommands directly) the flag is unknown and nonZero decides instead.
+func flagSet(cmd *cobra.Command, name string, nonZero bool) bool {
+	if f := cmd.Flag(name); f != nil {
+		return f.Changed
+	}
+	return nonZero
+}
+
+func newConfigCmd(opts *rootOptions) *cobra.Command {
+	configCmd := &cobra.Command{Use: "config", Short: "Inspect the effective kstack configuration"}
+
+	var showOrigin bool
+	viewCmd := &cobra.Command{
+		Use:   "view",
+		Short: "Print each effective setting (and where it came from)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, origins, err := resolveConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			for _, key := range cfg.Keys() {
+				if showOrigin {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", key, c.Get(key), origins[key])
+				} else {
+					fmt.Fprintf(w, "%s\t%s\n", key, c.Get(key))
+				}
+			}
+			names := make([]string, 0, len(c.AddonOptions))
+			for name := range c.AddonOptions {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				o := c.AddonOptions[name]
+				for _, kv := range [][2]string{
+					{"values", strings.Join(o.Values, ",")},
+					{"set", strings.Join(o.Set, ",")},
+					{"ha", strconv.FormatBool(o.HA)},
+					{"chartVersion", o.ChartVersion},
+				} {
+					if kv[1] == "" || kv[1] == "false" {
+						continue
+					}
+					if showOrigin {
+						fmt.Fprintf(w, "addons.%s.%s\t%s\t%s\n", name, kv[0], kv[1], origins.AddonOptions())
+					} else {
+						fmt.Fprintf(w, "addons.%s.%s\t%s\n", name, kv[0], kv[1])
+					}
+				}
+			}
+			return w.Flush()
+		},
+	}
+	viewCmd.Flags().BoolVar(&showOrigin, "show-origin", false, "Show which layer (default, user config, stack file, env, flag) supplied each setting")
+
+	configCmd.AddCommand(viewCmd)
+	return configCmd
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	cfg "github.com/christk1/kstack/internal/config"
+	"github.com/christk1/kstack/pkg/addons"
+	"github.com/christk1/kstack/pkg/diff"
+	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/pkg/lock"
+	"github.com/christk1/kstack/utils"
+)
+
+// errDiffFound is returned by `diff` when objects would change. main exits
+// with status 2 for it, apart from status 1 for failures, like diff(1).
+var errDiffFound = errors.New("differences found")
+
+func newDiffCmd(opts *rootOptions) *cobra.Command {
+	var setPairs []string
+	var extraValues []string
+	var ha bool
+	var chartVersions []string
+
+	cmd := &cobra.Command{
+		Use:   "diff [addon]",
+		Short: "Show what `kstack up` would change in the addons on the cluster",
+		Long: "Render the chart of every selected addon (or only the given one) with the values `kstack up` would use,\n" +
+			"including the stack file and kstack.lock, and print a unified diff of each Kubernetes object against the\n" +
+			"deployed release. Exits with status 2 when anything would change, 1 when the diff fails and 0 otherwise.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: no external commands will be executed")
+			}
+			if len(args) == 1 {
+				c.Addons = args
+			}
+			if len(c.Addons) == 0 {
+				return fmt.Errorf("no addons to diff; name one or select them with --addons or a stack file")
+			}
+			if err := applyChartVersions(&c, chartVersions); err != nil {
+				return err
+			}
+			if err := c.Validate(); err != nil {
+				return err
+			}
+			if err := cfg.ValidateValuesFiles(extraValues); err != nil {
+				return err
+			}
+			if err := cfg.ValidateSetPairs(setPairs); err != nil {
+				return err
+			}
+			locked, err := lock.Read(lock.Path(c.StackFile))
+			if err != nil {
+				return err
+			}
+
+			_, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			hc := newHelmClient(c, providerKubeconfig(ctx, c, prov), opts.dryRun)
+			if ver, err := hc.Preflight(ctx, 10*time.Second); err != nil {
+				return fmt.Errorf("helm not available or fails preflight: %w", err)
+			} else {
+				utils.Debug("helm version: %s", ver)
+			}
+
+			changed := 0
+			for _, name := range c.Addons {
+				a, err := addons.Get(name)
+				if err != nil {
+					return err
+				}
+				in := resolveAddonInstall(a, ha, c.AddonOptions[name], extraValues, setPairs)
+				pinToLock(&in, locked, false)
+				n, err := diffAddon(ctx, hc, in, cmd.OutOrStdout(), !opts.noColor)
+				if err != nil {
+					return err
+				}
+				changed += n
+			}
+			if changed > 0 {
+				return fmt.Errorf("%w: %d object(s) would change", errDiffFound, changed)
+			}
+			if !opts.dryRun {
+				utils.Info("no changes")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&setPairs, "set", nil, "Set values (key=val). Can be supplied multiple times")
+	cmd.Flags().StringArrayVar(&extraValues, "values", nil, "Additional values files to pass (-f) to Helm. Can be supplied multiple times")
+	cmd.Flags().BoolVar(&ha, "ha", false, "Diff the HA variant for supported addons (e.g. postgres)")
+	cmd.Flags().StringArrayVar(&chartVersions, "chart-version", nil, "Diff a specific chart version of an addon (addon=version). Can be supplied multiple times")
+	return cmd
+}
+
+// diffAddon renders the chart of in against the cluster, compares each
+// object with the deployed release and writes a unified diff of every
+// changed object to w, with the values of Secrets redacted. It returns the
+// number of changed objects.
+func diffAddon(ctx context.Context, hc *helm.HelmClient, in addonInstall, w io.Writer, color bool) (int, error) {
+	name := in.addon.Name()
+	rendered, err := planAddon(ctx, hc, in)
+	if err != nil {
+		return 0, err
+	}
+	deployed, err := hc.ReleaseManifest(ctx, name, in.addon.Namespace())
+	if errors.Is(err, helm.ErrReleaseNotFound) {
+		utils.Info("addon %s is not installed; all of its objects would be created", name)
+		deployed = ""
+	} else if err != nil {
+		return 0, err
+	}
+	if hc.DryRun {
+		return 0, nil
+	}
+
+	objs, err := helm.SplitManifest(rendered)
+	if err != nil {
+		return 0, fmt.Errorf("addon %s: %w", name, err)
+	}
+	// helm does not keep hooks in the manifest of a release
+	want := slices.DeleteFunc(objs, func(o helm.Object) bool { return o.Hook != "" })
+	have, err := helm.SplitManifest(deployed)
+	if err != nil {
+		return 0, fmt.Errorf("release %s: %w", name, err)
+	}
+	live := map[string]string{}
+	for _, o := range have {
+		live[o.Key()] = o.YAML
+	}
+
+	changed := 0
+	show := func(o helm.Object, from, to string) {
+		if from == to {
+			return
+		}
+		if o.Kind == "Secret" {
+			from, to = helm.RedactSecret(from, to)
+		}
+		key := o.Key()
+		d := diff.Unified(key+" (deployed)", key+" (rendered)", from, to)
+		if d == "" {
+			return
+		}
+		if color {
+			d = diff.Colorize(d)
+		}
+		fmt.Fprint(w, d)
+		changed++
+	}
+	for _, o := range want {
+		show(o, live[o.Key()], o.YAML)
+		delete(live, o.Key())
+	}
+	// objects the new chart no longer renders would be deleted
+	for _, o := range have {
+		if yml, ok := live[o.Key()]; ok {
+			show(o, yml, "")
+		}
+	}
+	if changed == 0 {
+		utils.Info("addon %s: no changes", name)
+	} else {
+		utils.Info("addon %s: %d object(s) would change", name, changed)
+	}
+	return changed, nil
+}
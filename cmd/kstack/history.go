@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/christk1/kstack/pkg/addons"
+	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/utils"
+)
+
+// valuesSummaryKeys is how many changed values `addons history` names per
+// revision.
+const valuesSummaryKeys = 3
+
+func newAddonsHistoryCmd(opts *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "history <name>",
+		Short: "List the revisions of an addon's release with their chart and values changes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			a, err := addons.Get(args[0])
+			if err != nil {
+				return err
+			}
+			_, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			hc := newHelmClient(c, providerKubeconfig(ctx, c, prov), opts.dryRun)
+			if ver, err := hc.Preflight(ctx, 10*time.Second); err != nil {
+				return fmt.Errorf("helm not available or fails preflight: %w", err)
+			} else {
+				utils.Debug("helm version: %s", ver)
+			}
+
+			revs, err := hc.History(ctx, a.Name(), a.Namespace())
+			if err != nil {
+				return notInstalled(a, err)
+			}
+			values := make([][]byte, len(revs))
+			for i, r := range revs {
+				if values[i], err = hc.RevisionValues(ctx, a.Name(), a.Namespace(), r.Revision); err != nil {
+					return err
+				}
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "REVISION\tUPDATED\tSTATUS\tCHART\tAPP VERSION\tVALUES\tDESCRIPTION")
+			for i, r := range revs {
+				summary := "-"
+				switch {
+				case r.Revision == 1:
+					summary = "initial"
+				case i > 0 && revs[i-1].Revision == r.Revision-1:
+					d, err := helm.DiffValues(values[i-1], values[i])
+					if err != nil {
+						return fmt.Errorf("revision %d: %w", r.Revision, err)
+					}
+					summary = d.Summary(valuesSummaryKeys)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Revision, r.Updated.Local().Format("2006-01-02 15:04:05"),
+					r.Status, r.Chart, r.AppVersion, summary, r.Description)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newAddonsRollbackCmd(opts *rootOptions) *cobra.Command {
+	var wait bool
+	var helmTimeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "rollback <name> [revision]",
+		Short: "Roll an addon's release back to an earlier revision (the previous one by default)",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			revision := 0
+			if len(args) == 2 {
+				n, err := strconv.Atoi(args[1])
+				if err != nil || n < 1 {
+					return fmt.Errorf("invalid revision %q; see `kstack addons history %s`", args[1], args[0])
+				}
+				revision = n
+			}
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: no external commands will be executed")
+			}
+			a, err := addons.Get(args[0])
+			if err != nil {
+				return err
+			}
+			_, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			hc := newHelmClient(c, providerKubeconfig(ctx, c, prov), opts.dryRun)
+			if ver, err := hc.Preflight(ctx, 10*time.Second); err != nil {
+				return fmt.Errorf("helm not available or fails preflight: %w", err)
+			} else {
+				utils.Debug("helm version: %s", ver)
+			}
+
+			if err := hc.Rollback(ctx, a.Name(), a.Namespace(), revision, wait, helmTimeout); err != nil {
+				return notInstalled(a, err)
+			}
+			if revision == 0 {
+				utils.Info("rolled back addon %s in ns=%s to its previous revision", a.Name(), a.Namespace())
+			} else {
+				utils.Info("rolled back addon %s in ns=%s to revision %d", a.Name(), a.Namespace(), revision)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait for resources to become ready (passes --wait to helm)")
+	cmd.Flags().DurationVar(&helmTimeout, "helm-timeout", 15*time.Minute, "Timeout passed to helm --timeout when --wait is set")
+	return cmd
+}
+
+// notInstalled explains a helm error about a missing release in terms of
+// the addon.
+func notInstalled(a addons.Addon, err error) error {
+	if errors.Is(err, helm.ErrReleaseNotFound) {
+		return fmt.Errorf("addon %s is not installed in namespace %s: %w", a.Name(), a.Namespace(), err)
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/christk1/kstack/pkg/cluster"
+	"github.com/christk1/kstack/utils"
+)
+
+func newImageCmd(opts *rootOptions) *cobra.Command {
+	imageCmd := &cobra.Command{Use: "image", Short: "Manage container images in the cluster"}
+
+	loadCmd := &cobra.Command{
+		Use:   "load <image>...",
+		Short: "Load local Docker images into the cluster's nodes",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: no external commands will be executed")
+			}
+			if err := c.Validate(); err != nil {
+				return err
+			}
+
+			spec, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			if !spec.Has(cluster.CapImageLoad) {
+				return fmt.Errorf("provider %s cannot load images; push %s to a registry the cluster can pull from instead", spec.Name, strings.Join(args, ", "))
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+
+			exists, err := prov.Exists(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to query existing cluster: %w", err)
+			}
+			if !exists && !opts.dryRun {
+				return fmt.Errorf("%s cluster %s not found; run `kstack up` first", c.Provider, c.ClusterName)
+			}
+
+			nodes, err := cluster.LoadImages(ctx, prov, args)
+			if err != nil {
+				return err
+			}
+			if !opts.dryRun {
+				utils.Info("loaded %s into %d node(s): %s", strings.Join(args, ", "), len(nodes), strings.Join(nodes, ", "))
+			}
+			return nil
+		},
+	}
+
+	imageCmd.AddCommand(loadCmd)
+	return imageCmd
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	cfg "github.com/christk1/kstack/internal/config"
+	"github.com/christk1/kstack/pkg/addons"
+	pgaddon "github.com/christk1/kstack/pkg/addons/postgres"
+	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/utils"
+)
+
+// addonInstall holds the resolved chart, repo and values for installing a
+// single addon.
+type addonInstall struct {
+	addon addons.Addon
+	chart string
+	// version is the chart version passed to helm, "" for the newest.
+	version string
+	// archive, when set, is a packaged copy of chart (from a bundle or a
+	// pull verified against kstack.lock) that helm installs instead.
+	archive  string
+	repoName string
+	repoURL  string
+	// values are values files in merge order (later files win).
+	values []string
+	set    []string
+}
+
+// resolveAddonInstall selects the chart (including the HA variant where
+// supported) and layers values files in order: addon defaults, HA values,
+// per-addon stack file values, then extra values from the command line. The
+// chart version pinned by the addon can be overridden per addon.
+func resolveAddonInstall(a addons.Addon, ha bool, opts cfg.AddonOptions, extraValues, setPairs []string) addonInstall {
+	in := addonInstall{
+		addon:    a,
+		chart:    a.Chart(),
+		version:  a.ChartVersion(),
+		repoName: a.RepoName(),
+		repoURL:  a.RepoURL(),
+	}
+	ha = ha || opts.HA
+	if ha && a.Name() == "postgres" {
+		in.chart = pgaddon.HAChart
+		in.version = pgaddon.HAChartVersion
+		in.repoName = ""
+		in.repoURL = ""
+	}
+
+	if opts.ChartVersion != "" {
+		if helm.IsLocalChart(in.chart) {
+			utils.Warn("addon %s installs the local chart %s; ignoring chart version %s", a.Name(), in.chart, opts.ChartVersion)
+		} else {
+			in.version = opts.ChartVersion
+		}
+	}
+
+	in.values = a.ValuesFiles()
+	if ha && a.Name() == "postgres" {
+		if haFile, err := pgaddon.HAValuesFile(); err == nil && haFile != "" {
+			in.values = append(in.values, haFile)
+		} else if err != nil {
+			utils.Debug("failed to load HA values for postgres: %v", err)
+		}
+	}
+	in.values = append(in.values, opts.Values...)
+	in.values = append(in.values, extraValues...)
+
+	in.set = append(in.set, opts.Set...)
+	in.set = append(in.set, setPairs...)
+	return in
+}
+
+// installAddon adds and refreshes the chart repository when needed, merges
+// values and runs `helm upgrade --install` for the resolved addon.
+func installAddon(ctx context.Context, hc *helm.HelmClient, in addonInstall, wait bool, timeout time.Duration, atomic bool) error {
+	if err := addRepo(ctx, hc, in); err != nil {
+		return err
+	}
+	merged, cleanup, err := helm.MergeValues(in.values, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := cleanup(); cerr != nil {
+			utils.Debug("cleanup error: %v", cerr)
+		}
+	}()
+	chart, version := in.source()
+	err = hc.InstallOrUpgrade(ctx, in.addon.Name(), chart, version, in.addon.Namespace(), merged, wait, timeout, atomic, in.set)
+	if errors.Is(err, helm.ErrReleaseLocked) && !hc.RecoverStuck {
+		return fmt.Errorf("%w\nrelease %s is stuck from an interrupted operation; rerun with --recover-stuck to roll it back or remove it", err, in.addon.Name())
+	}
+	return err
+}
+
+// source returns the chart reference and version helm installs from.
+func (in addonInstall) source() (chart, version string) {
+	if in.archive != "" {
+		return in.archive, ""
+	}
+	return in.chart, in.version
+}
+
+// addRepo prepares the source of the addon's chart: it adds and refreshes
+// the chart repository (only that one, once per run), or logs in to the
+// OCI registry of an oci:// chart with stored credentials. Local charts
+// need neither.
+func addRepo(ctx context.Context, hc *helm.HelmClient, in addonInstall) error {
+	chart, _ := in.source()
+	if helm.IsLocalChart(chart) {
+		return nil
+	}
+	if helm.IsOCIChart(chart) {
+		return registryLogin(ctx, hc, helm.OCIHost(chart))
+	}
+	if err := hc.RepoAdd(ctx, in.repoName, in.repoURL); err != nil {
+		return err
+	}
+	return hc.RepoUpdate(ctx, in.repoName)
+}
+
+// addonImages renders the addon's chart with its merged values and returns
+// the container images the manifests reference.
+func addonImages(ctx context.Context, hc *helm.HelmClient, in addonInstall) ([]string, error) {
+	manifests, err := renderAddon(ctx, hc, in, false)
+	if err != nil {
+		return nil, err
+	}
+	return helm.ManifestImages(manifests)
+}
+
+// renderAddon renders the addon's chart offline with the values installAddon
+// would merge for it, including its CRDs if includeCRDs is set. It returns ""
+// in dry-run mode.
+func renderAddon(ctx context.Context, hc *helm.HelmClient, in addonInstall, includeCRDs bool) (string, error) {
+	return withAddonValues(ctx, hc, in, func(chart, version, values string) (string, error) {
+		return hc.Template(ctx, in.addon.Name(), chart, version, in.addon.Namespace(), values, in.set, includeCRDs)
+	})
+}
+
+// planAddon renders what installAddon would deploy, against the cluster, so
+// that charts see its API versions and the objects they look up. It returns
+// "" in dry-run mode.
+func planAddon(ctx context.Context, hc *helm.HelmClient, in addonInstall) (string, error) {
+	return withAddonValues(ctx, hc, in, func(chart, version, values string) (string, error) {
+		return hc.PlanUpgrade(ctx, in.addon.Name(), chart, version, in.addon.Namespace(), values, in.set)
+	})
+}
+
+// withAddonValues makes the addon's chart available and calls render with
+// the chart, its version and a temporary file of the merged values.
+func withAddonValues(ctx context.Context, hc *helm.HelmClient, in addonInstall, render func(chart, version, values string) (string, error)) (string, error) {
+	if err := addRepo(ctx, hc, in); err != nil {
+		return "", err
+	}
+	merged, cleanup, err := helm.MergeValues(in.values, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := cleanup(); cerr != nil {
+			utils.Debug("cleanup error: %v", cerr)
+		}
+	}()
+	chart, version := in.source()
+	return render(chart, version, merged)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	cfg "github.com/christk1/kstack/internal/config"
+	"github.com/christk1/kstack/pkg/cluster"
+	"github.com/christk1/kstack/pkg/kubeconfig"
+	"github.com/christk1/kstack/utils"
+)
+
+// contextName is the context a cluster's kubeconfig is merged under in the
+// user's default kubeconfig.
+func contextName(c cfg.Config) string { return "kstack-" + c.ClusterName }
+
+func newKubeconfigCmd(opts *rootOptions) *cobra.Command {
+	var internal, merge, unmerge, printConfig, pathOnly bool
+	cmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Show, print or merge the managed kubeconfig of the cluster",
+		Long: "Writes the cluster's kubeconfig to a stable path under the kstack state directory and prints that path.\n" +
+			"--print writes the kubeconfig to stdout, --merge adds it to your default kubeconfig as context kstack-<cluster>\n" +
+			"and makes it current, --unmerge removes that context again. --internal uses the API server address\n" +
+			"inside the Docker network, for devcontainers and other containers.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if err := c.Validate(); err != nil {
+				return err
+			}
+
+			if unmerge {
+				removed, target, err := unmergeKubeconfig(c)
+				if err != nil {
+					return err
+				}
+				if removed {
+					utils.Info("removed context %s from %s", contextName(c), target)
+				} else {
+					utils.Info("context %s not found in %s", contextName(c), target)
+				}
+				return nil
+			}
+
+			_, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			var kp string
+			if internal {
+				kp, err = cluster.InternalKubeconfigPath(ctx, prov)
+			} else {
+				kp, err = prov.KubeconfigPath(ctx)
+			}
+			if err != nil {
+				return err
+			}
+			if kp == "" {
+				// dry-run: nothing was written
+				return nil
+			}
+
+			switch {
+			case printConfig:
+				b, err := os.ReadFile(kp)
+				if err != nil {
+					return fmt.Errorf("read kubeconfig: %w", err)
+				}
+				_, err = cmd.OutOrStdout().Write(b)
+				return err
+			case merge:
+				target, err := mergeKubeconfig(c, kp)
+				if err != nil {
+					return err
+				}
+				utils.Info("merged context %s into %s and made it current", contextName(c), target)
+				return nil
+			default:
+				fmt.Fprintln(cmd.OutOrStdout(), kp)
+				return nil
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&internal, "internal", false, "Use the API server address inside the Docker network")
+	cmd.Flags().BoolVar(&merge, "merge", false, "Merge into the default kubeconfig as context kstack-<cluster>")
+	cmd.Flags().BoolVar(&unmerge, "unmerge", false, "Remove context kstack-<cluster> from the default kubeconfig")
+	cmd.Flags().BoolVar(&printConfig, "print", false, "Print the kubeconfig instead of its path")
+	cmd.Flags().BoolVar(&pathOnly, "path", false, "Print the path of the managed kubeconfig (default)")
+	cmd.MarkFlagsMutuallyExclusive("merge", "unmerge", "print", "path")
+	cmd.MarkFlagsMutuallyExclusive("internal", "unmerge")
+	return cmd
+}
+
+// mergeKubeconfig merges the kubeconfig at src into the user's default
+// kubeconfig under contextName(c) and returns the file it wrote.
+func mergeKubeconfig(c cfg.Config, src string) (string, error) {
+	from, err := kubeconfig.Load(src)
+	if err != nil {
+		return "", err
+	}
+	target := kubeconfig.DefaultPath()
+	into, err := kubeconfig.Load(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		into = &kubeconfig.Config{}
+	} else if err != nil {
+		return "", err
+	}
+	if err := into.Merge(from, contextName(c)); err != nil {
+		return "", err
+	}
+	return target, into.Save(target)
+}
+
+// unmergeKubeconfig removes contextName(c) from the user's default
+// kubeconfig, reporting whether it was present and the file it checked.
+func unmergeKubeconfig(c cfg.Config) (bool, string, error) {
+	target := kubeconfig.DefaultPath()
+	into, err := kubeconfig.Load(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, target, nil
+	} else if err != nil {
+		return false, target, err
+	}
+	if !into.Remove(contextName(c)) {
+		return false, target, nil
+	}
+	return true, target, into.Save(target)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/christk1/kstack/pkg/addons"
+	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/pkg/lock"
+	"github.com/christk1/kstack/utils"
+)
+
+func newLockCmd(opts *rootOptions) *cobra.Command {
+	lockCmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Inspect the kstack.lock written by `kstack up`",
+		Long: "`kstack up` records the chart repository, version, digest and app version of every addon, plus a hash of\n" +
+			"its values, in kstack.lock next to the stack file; `kstack addons install` updates the entry of its addon. Later runs\n" +
+			"install exactly those charts unless --update is passed.",
+	}
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Report drift between kstack.lock and the releases on the cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			path := lock.Path(c.StackFile)
+			locked, err := lock.Read(path)
+			if err != nil {
+				return err
+			}
+			if len(locked.Addons) == 0 {
+				return fmt.Errorf("no addons locked in %s; run `kstack up` first", path)
+			}
+			if opts.dryRun {
+				utils.Info("DRY-RUN: compare %d locked addon(s) in %s with the releases on the cluster", len(locked.Addons), path)
+				return nil
+			}
+			_, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			hc := newHelmClient(c, providerKubeconfig(ctx, c, prov), opts.dryRun)
+
+			drifted := 0
+			for _, entry := range locked.Addons {
+				problems, err := lockDrift(ctx, hc, entry)
+				if err != nil {
+					return err
+				}
+				if len(problems) == 0 {
+					utils.Info("addon %s matches %s (%s %s)", entry.Name, path, entry.Chart, entry.Version)
+					continue
+				}
+				drifted++
+				utils.Warn("addon %s drifted from %s: %s", entry.Name, path, strings.Join(problems, "; "))
+			}
+			if drifted > 0 {
+				return fmt.Errorf("%d of %d addon(s) drifted from %s", drifted, len(locked.Addons), path)
+			}
+			return nil
+		},
+	}
+
+	lockCmd.AddCommand(verifyCmd)
+	return lockCmd
+}
+
+// lockDrift compares the release of a locked addon with its lock entry and
+// describes every difference.
+func lockDrift(ctx context.Context, hc *helm.HelmClient, entry lock.Addon) ([]string, error) {
+	a, err := addons.Get(entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	releases, err := hc.ListReleases(ctx, a.Namespace())
+	if err != nil {
+		return nil, err
+	}
+	var rel *helm.ReleaseInfo
+	for i := range releases {
+		if releases[i].Name == entry.Name {
+			rel = &releases[i]
+		}
+	}
+	if rel == nil {
+		return []string{fmt.Sprintf("no release in namespace %s", a.Namespace())}, nil
+	}
+	var problems []string
+	if entry.Version != "" && !strings.HasSuffix(rel.Chart, "-"+entry.Version) {
+		problems = append(problems, fmt.Sprintf("chart %s is installed, %s is locked", rel.Chart, entry.Version))
+	}
+	if entry.AppVersion != "" && rel.AppVersion != entry.AppVersion {
+		problems = append(problems, fmt.Sprintf("app version %s is installed, %s is locked", rel.AppVersion, entry.AppVersion))
+	}
+	if entry.ValuesHash != "" {
+		values, err := hc.ReleaseValues(ctx, entry.Name, a.Namespace())
+		if err != nil {
+			return nil, err
+		}
+		hash, err := lock.ValuesHash(values)
+		if err != nil {
+			return nil, err
+		}
+		if hash != entry.ValuesHash {
+			problems = append(problems, "values differ")
+		}
+	}
+	return problems, nil
+}
+
+// pinToLock selects the chart version recorded in the lockfile for in
+// unless update is set or the addon now uses a different chart.
+func pinToLock(in *addonInstall, locked *lock.File, update bool) {
+	prev, ok := locked.Get(in.addon.Name())
+	if update || !ok || prev.Chart != in.chart || prev.Version == "" || helm.IsLocalChart(in.chart) {
+		return
+	}
+	if prev.Version != in.version {
+		requested := in.version
+		if requested == "" {
+			requested = "the newest version"
+		}
+		utils.Warn("addon %s is locked at chart version %s; pass --update to install %s", in.addon.Name(), prev.Version, requested)
+	}
+	in.version = prev.Version
+}
+
+// lockChart resolves the chart in installs to its exact version, app
+// version and digest. Repository charts are pulled into dir and installed
+// from that archive, so what is installed is what was checked against the
+// lockfile: a locked chart whose digest changed upstream is an error
+// unless update is set.
+func lockChart(ctx context.Context, hc *helm.HelmClient, in *addonInstall, locked *lock.File, update bool, dir string) (lock.Addon, error) {
+	name := in.addon.Name()
+	entry := lock.Addon{Name: name, Chart: in.chart, Repo: in.repoURL, Version: in.version}
+	archive := in.archive
+	switch {
+	case archive != "":
+	case helm.IsLocalChart(in.chart):
+		archive = in.chart
+	default:
+		if err := addRepo(ctx, hc, *in); err != nil {
+			return entry, err
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return entry, err
+		}
+		pulled, err := hc.Pull(ctx, in.chart, in.version, dir)
+		if err != nil {
+			return entry, err
+		}
+		if pulled == "" {
+			// dry-run
+			return entry, nil
+		}
+		archive = pulled
+		in.archive = pulled
+	}
+
+	if fi, err := os.Stat(archive); err == nil && !fi.IsDir() {
+		if entry.Digest, err = lock.FileDigest(archive); err != nil {
+			return entry, fmt.Errorf("digest of chart %s: %w", archive, err)
+		}
+	}
+	if meta, err := helm.ReadChartMetadata(archive); err != nil {
+		utils.Warn("cannot read the chart metadata of addon %s: %v", name, err)
+	} else {
+		entry.Version = meta.Version
+		entry.AppVersion = meta.AppVersion
+	}
+
+	prev, ok := locked.Get(name)
+	if ok && !update && prev.Chart == entry.Chart && prev.Version == entry.Version &&
+		prev.Digest != "" && entry.Digest != "" && prev.Digest != entry.Digest {
+		return entry, fmt.Errorf("chart %s %s of addon %s does not match %s (digest %s, locked %s); pass --update to accept it",
+			entry.Chart, entry.Version, name, lock.FileName, entry.Digest, prev.Digest)
+	}
+	return entry, nil
+}
+
+// lockValues records the hash of the values the release of in was
+// installed with.
+func lockValues(ctx context.Context, hc *helm.HelmClient, in addonInstall, entry *lock.Addon) {
+	values, err := hc.ReleaseValues(ctx, in.addon.Name(), in.addon.Namespace())
+	if err == nil {
+		entry.ValuesHash, err = lock.ValuesHash(values)
+	}
+	if err != nil {
+		utils.Warn("cannot record the values of addon %s in %s: %v", in.addon.Name(), lock.FileName, err)
+	}
+}
+
+// writeLock records locked in lockPath, or reports that it would in dry-run
+// mode.
+func writeLock(locked *lock.File, lockPath string, dryRun bool) error {
+	if dryRun {
+		utils.Info("DRY-RUN: record the installed charts in %s", lockPath)
+		return nil
+	}
+	if err := locked.Write(lockPath); err != nil {
+		return fmt.Errorf("write %s: %w", lockPath, err)
+	}
+	utils.Info("recorded the installed charts in %s", lockPath)
+	return nil
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -14,10 +19,13 @@ import (
 	_ "github.com/christk1/kstack/pkg/addons/exampleapp"
 	_ "github.com/christk1/kstack/pkg/addons/grafana"
 	_ "github.com/christk1/kstack/pkg/addons/kafka"
-	pgaddon "github.com/christk1/kstack/pkg/addons/postgres"
+	_ "github.com/christk1/kstack/pkg/addons/postgres"
 	_ "github.com/christk1/kstack/pkg/addons/prometheus"
+	"github.com/christk1/kstack/pkg/bundle"
 	"github.com/christk1/kstack/pkg/cluster"
 	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/pkg/kubeconfig"
+	"github.com/christk1/kstack/pkg/lock"
 	"github.com/christk1/kstack/pkg/preflight"
 	"github.com/christk1/kstack/utils"
 )
@@ -35,12 +43,15 @@ type rootOptions struct {
 	addons      string
 	namespace   string
 	kubeconfig  string
+	kubeContext string
 	helmPath    string
+	k8sVersion  string
 	timeout     time.Duration
 	verbose     bool
 	debug       bool
 	noColor     bool
 	dryRun      bool
+	stackFile   string
 }
 
 func main() {
@@ -49,34 +60,64 @@ func main() {
 	rootCmd := &cobra.Command{
 		Use:           "kstack",
 		Short:         "Create local K8s clusters and install Helm-based addons",
-		Long:          "kstack is a developer-first CLI to spin up local kind/k3d clusters and install addons like Prometheus, Kafka, and Postgres via Helm.",
+		Long:          "kstack is a developer-first CLI to spin up local kind, k3d or minikube clusters and install addons like Prometheus, Kafka, and Postgres via Helm.",
 		SilenceUsage:  true,
 		SilenceErrors: true,
 	}
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&opts.provider, "provider", "kind", "Cluster provider: kind|k3d")
+	rootCmd.PersistentFlags().StringVar(&opts.provider, "provider", "kind", "Cluster provider: "+strings.Join(cluster.Names(), "|"))
 	rootCmd.PersistentFlags().StringVar(&opts.clusterName, "cluster", "kstack", "Cluster name")
 	rootCmd.PersistentFlags().StringVar(&opts.addons, "addons", "", "Comma-separated addons to install (e.g. prometheus,postgres)")
 	rootCmd.PersistentFlags().StringVar(&opts.namespace, "namespace", "kstack", "Kubernetes namespace for addons")
 	rootCmd.PersistentFlags().StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to kubeconfig (optional)")
+	rootCmd.PersistentFlags().StringVar(&opts.kubeContext, "context", "", "Kubeconfig context to use (optional)")
 	rootCmd.PersistentFlags().StringVar(&opts.helmPath, "helm", "helm", "Path to helm binary")
+	rootCmd.PersistentFlags().StringVar(&opts.k8sVersion, "k8s-version", "", "Kubernetes version for new clusters (e.g. 1.30 or 1.30.4); defaults to the provider's default")
 	rootCmd.PersistentFlags().DurationVar(&opts.timeout, "timeout", 10*time.Minute, "Overall operation timeout")
 	rootCmd.PersistentFlags().BoolVarP(&opts.verbose, "verbose", "v", false, "Verbose logging")
 	rootCmd.PersistentFlags().BoolVar(&opts.debug, "debug", false, "Print resolved configuration and extra diagnostics")
 	rootCmd.PersistentFlags().BoolVar(&opts.noColor, "no-color", false, "Disable ANSI colors in logs")
 	rootCmd.PersistentFlags().BoolVar(&opts.dryRun, "dry-run", false, "Print planned actions without executing external commands")
+	rootCmd.PersistentFlags().StringVarP(&opts.stackFile, "file", "f", "", "Path to a stack file (e.g. kstack.yaml) declaring provider, cluster and addons")
 
 	// Subcommands
 	rootCmd.AddCommand(newUpCmd(opts))
 	rootCmd.AddCommand(newDownCmd(opts))
 	rootCmd.AddCommand(newAddonsCmd(opts))
+	rootCmd.AddCommand(newDiffCmd(opts))
+	rootCmd.AddCommand(newTemplateCmd(opts))
 	rootCmd.AddCommand(newPreflightCmd(opts))
 	rootCmd.AddCommand(newStatusCmd(opts))
+	rootCmd.AddCommand(newConfigCmd(opts))
+	rootCmd.AddCommand(newKubeconfigCmd(opts))
+	rootCmd.AddCommand(newImageCmd(opts))
+	rootCmd.AddCommand(newCacheCmd(opts))
+	rootCmd.AddCommand(newBundleCmd(opts))
+	rootCmd.AddCommand(newLockCmd(opts))
+	rootCmd.AddCommand(newRegistryCmd(opts))
 	rootCmd.AddCommand(newVersionCmd())
 
-	if err := rootCmd.Execute(); err != nil {
+	// Ctrl-C or SIGTERM cancels the command's context: running helm, kind,
+	// k3d and minikube processes are asked to stop (see utils.Command) and
+	// the command reports what it left half-done. A second signal exits
+	// immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := rootCmd.ExecuteContext(ctx)
+	interrupted := ctx.Err() != nil
+	stop()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		if interrupted {
+			os.Exit(130)
+		}
+		if errors.Is(err, errDiffFound) {
+			os.Exit(2)
+		}
 		os.Exit(1)
 	}
 }
@@ -85,70 +126,119 @@ func newUpCmd(opts *rootOptions) *cobra.Command {
 	var setPairs []string
 	var extraValues []string
 	var ha bool
+	var registry bool
+	var cache bool
+	var preload bool
+	var chartVersions []string
+	var update bool
+	var recoverStuck bool
 
 	cmd := &cobra.Command{
 		Use:   "up",
 		Short: "Create cluster and install addons",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// Build configuration from flags and env
-			c := cfg.Defaults()
-			c.Provider = opts.provider
-			c.ClusterName = opts.clusterName
-			c.Addons = cfg.ParseAddonsCSV(opts.addons)
-			c.Namespace = opts.namespace
-			c.Kubeconfig = opts.kubeconfig
-			c.HelmPath = opts.helmPath
-			c.Timeout = opts.timeout
-			c.Verbose = opts.verbose
-			c.Debug = opts.debug
-			c = cfg.FromEnv(c)
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Build configuration from the stack file, flags and env
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
 
 			utils.SetVerbose(c.Verbose)
 			utils.SetColorEnabled(!opts.noColor)
 			if opts.dryRun {
 				utils.Info("DRY-RUN: no external commands will be executed")
 			}
-			utils.Debug("config: provider=%s cluster=%s ns=%s addons=%v kubeconfig=%s helm=%s timeout=%s verbose=%v", c.Provider, c.ClusterName, c.Namespace, c.Addons, c.Kubeconfig, c.HelmPath, c.Timeout, c.Verbose)
-
-			// Instantiate provider
-			var prov cluster.Provider
-			switch c.Provider {
-			case "kind":
-				prov = cluster.NewKindProvider(c.ClusterName)
-			case "k3d":
-				prov = cluster.NewK3dProvider(c.ClusterName)
-			default:
-				return fmt.Errorf("unknown provider: %s", c.Provider)
+			if registry {
+				c.Registry.Enabled = true
+			}
+			if cache {
+				c.Cache.Enabled = true
+			}
+			if preload {
+				c.PreloadImages = true
+			}
+			if err := applyChartVersions(&c, chartVersions); err != nil {
+				return err
+			}
+			utils.Debug("config: provider=%s cluster=%s ns=%s addons=%v kubeconfig=%s helm=%s timeout=%s verbose=%v stack=%s", c.Provider, c.ClusterName, c.Namespace, c.Addons, c.Kubeconfig, c.HelmPath, c.Timeout, c.Verbose, c.StackFile)
+			if err := c.Validate(); err != nil {
+				return err
 			}
 
-			// apply dry-run to providers if supported
-			cluster.SetDryRun(prov, opts.dryRun)
+			spec, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			if err := cluster.SetK8sVersion(prov, c.K8sVersion); err != nil {
+				return err
+			}
+			if err := cluster.SetRegistry(prov, c.Registry); err != nil {
+				return err
+			}
+			if err := cluster.SetCache(prov, c.Cache); err != nil {
+				return err
+			}
+			offline, err := bundle.Active()
+			if err != nil {
+				return fmt.Errorf("read loaded bundle: %w", err)
+			}
+			if offline != nil {
+				utils.Info("using the offline bundle in %s", bundle.Dir())
+				useBundleNodeImage(c, prov, offline)
+			}
 
 			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
 			defer cancel()
+			prog := &progress{}
+			defer func() { err = prog.interrupted(ctx, err) }()
 
 			// preflight checks
 			preflight.Verbose = c.Verbose
 			preflight.Debug = c.Debug
 
 			if !opts.dryRun {
-				if err := preflight.CheckProviderCLI(c.Provider); err != nil {
-					return err
-				}
-				if err := preflight.CheckDocker(ctx); err != nil {
+				if err := spec.Preflight(ctx); err != nil {
 					return err
 				}
 			} else {
-				utils.Info("DRY-RUN: check provider CLI for %s", c.Provider)
-				utils.Info("DRY-RUN: check docker info")
+				utils.Info("DRY-RUN: preflight checks for provider %s", spec.Name)
 			}
 
 			exists, err := prov.Exists(ctx)
 			if err != nil {
 				return fmt.Errorf("failed to query existing cluster: %w", err)
 			}
+			if !exists && !spec.Has(cluster.CapManaged) {
+				return prov.Create(ctx)
+			}
+			if !exists {
+				// fail before the registry and caches are started
+				if err := cluster.CheckK8sVersion(ctx, prov); err != nil {
+					return err
+				}
+			}
+			if c.Registry.Enabled {
+				if err := cluster.EnsureRegistry(ctx, c.Registry, registryKey(c), opts.dryRun); err != nil {
+					return err
+				}
+			}
+			if c.Cache.Enabled {
+				if err := cluster.EnsureCaches(ctx, c.Cache, opts.dryRun); err != nil {
+					return err
+				}
+			}
+			if !exists {
+				prog.plan("create cluster " + c.ClusterName)
+			}
+			for _, name := range c.Addons {
+				prog.plan("install addon " + name)
+			}
+			if exists && (c.Registry.Enabled || c.Cache.Enabled) {
+				utils.Warn("cluster %s already exists; its nodes only use the registry and caches if it was created with them", c.ClusterName)
+			}
 			if !exists {
 				utils.Info("creating cluster %s with provider %s", c.ClusterName, c.Provider)
+				prog.start("create cluster "+c.ClusterName, "run `kstack down` to remove what was created, then `kstack up` again")
 				var sp *utils.Spinner
 				if !opts.dryRun {
 					sp = utils.NewSpinner("Creating cluster")
@@ -163,120 +253,118 @@ func newUpCmd(opts *rootOptions) *cobra.Command {
 				if sp != nil {
 					sp.Stop()
 				}
+				prog.finish()
 			} else {
 				utils.Info("cluster %s already exists", c.ClusterName)
 			}
 
 			kubePath, err := prov.KubeconfigPath(ctx)
 			if err == nil && kubePath != "" {
-				utils.Info("kubeconfig available at: %s", kubePath)
+				utils.Info("kubeconfig available at: %s (run `kstack kubeconfig --merge` to add it to your kubeconfig)", kubePath)
+				if exists && c.K8sVersion != "" {
+					warnK8sVersionMismatch(ctx, kubePath, c.K8sVersion)
+				}
 			} else if err != nil {
 				utils.Debug("kubeconfig not available: %v", err)
 			}
 
+			if c.Registry.Enabled {
+				if err := cluster.AttachRegistry(ctx, prov, c.Registry, opts.dryRun); err != nil {
+					return err
+				}
+				if kubePath != "" || opts.dryRun {
+					if err := cluster.PublishRegistryHosting(ctx, kubePath, "", c.Registry, opts.dryRun); err != nil {
+						return err
+					}
+				}
+				utils.Info("local registry available at %s (e.g. docker push %s/my-app)", c.Registry.Host(), c.Registry.Host())
+			}
+			if c.Cache.Enabled {
+				if err := cluster.AttachCaches(ctx, prov, c.Cache, opts.dryRun); err != nil {
+					return err
+				}
+			}
+
 			if len(c.Addons) > 0 {
-				hc := helm.NewClient(c.HelmPath)
-				hc.DryRun = opts.dryRun
-				if ver, err := hc.Preflight(10 * time.Second); err != nil {
+				hc := newHelmClient(c, kubePath, opts.dryRun)
+				hc.RecoverStuck = recoverStuck
+				if ver, err := hc.Preflight(ctx, 10*time.Second); err != nil {
 					return fmt.Errorf("helm not available or fails preflight: %w", err)
 				} else {
 					utils.Debug("helm version: %s", ver)
 				}
 
-				// validate user-supplied values files first
-				for _, vf := range extraValues {
-					if vf == "" {
-						continue
-					}
-					info, err := os.Stat(vf)
-					if err != nil {
-						return fmt.Errorf("values file %s not found or unreadable: %w", vf, err)
-					}
-					if !info.Mode().IsRegular() {
-						return fmt.Errorf("values file %s is not a regular file", vf)
-					}
-				}
-
-				// validate --set pairs
-				var badSets []string
-				for _, s := range setPairs {
-					if s == "" || !strings.Contains(s, "=") {
-						badSets = append(badSets, s)
-						continue
-					}
-					parts := strings.SplitN(s, "=", 2)
-					if strings.TrimSpace(parts[0]) == "" {
-						badSets = append(badSets, s)
-					}
+				// validate user-supplied values files and --set pairs first
+				if err := cfg.ValidateValuesFiles(extraValues); err != nil {
+					return err
 				}
-				if len(badSets) > 0 {
-					return fmt.Errorf("invalid --set entries: %v; expected key=val with non-empty key", badSets)
+				if err := cfg.ValidateSetPairs(setPairs); err != nil {
+					return err
 				}
 
+				lockPath := lock.Path(c.StackFile)
+				locked, err := lock.Read(lockPath)
+				if err != nil {
+					return err
+				}
+				ins := make([]addonInstall, 0, len(c.Addons))
 				for _, name := range c.Addons {
-					utils.Info("installing addon %s...", name)
 					a, err := addons.Get(name)
 					if err != nil {
 						return err
 					}
-					var sp *utils.Spinner
-					if !opts.dryRun {
-						sp = utils.NewSpinner(fmt.Sprintf("Installing %s", a.Name()))
-						sp.Start()
+					in := resolveAddonInstall(a, ha, c.AddonOptions[name], extraValues, setPairs)
+					pinToLock(&in, locked, update)
+					useBundle(&in, offline, extraValues)
+					ins = append(ins, in)
+				}
+
+				// resolve every chart against the lockfile before installing anything
+				pullDir, err := os.MkdirTemp("", "kstack-charts-")
+				if err != nil {
+					return fmt.Errorf("create chart dir: %w", err)
+				}
+				defer os.RemoveAll(pullDir)
+				entries := make([]lock.Addon, len(ins))
+				for i := range ins {
+					if entries[i], err = lockChart(ctx, hc, &ins[i], locked, update, filepath.Join(pullDir, ins[i].addon.Name())); err != nil {
+						return err
 					}
+				}
 
-					chartName := a.Chart()
-					repoName := a.RepoName()
-					repoURL := a.RepoURL()
-					if ha && a.Name() == "postgres" {
-						chartName = "bitnami/postgresql-ha"
-						repoName = "bitnami"
-						repoURL = "https://charts.bitnami.com/bitnami"
+				if offline != nil && spec.Has(cluster.CapImageLoad) {
+					loadBundleImages(ctx, prov, offline, opts.dryRun)
+				} else if c.PreloadImages {
+					if spec.Has(cluster.CapImageLoad) {
+						preloadAddonImages(ctx, hc, prov, ins, opts.dryRun)
+					} else {
+						utils.Warn("provider %s cannot load images; skipping image preload", spec.Name)
 					}
+				}
 
-					if !(strings.HasPrefix(chartName, "./") || strings.HasPrefix(chartName, "/")) {
-						if err := hc.RepoAdd(repoName, repoURL); err != nil {
-							if sp != nil {
-								sp.Stop()
-							}
-							return err
-						}
-						if err := hc.RepoUpdate(); err != nil {
-							if sp != nil {
-								sp.Stop()
-							}
-							return err
-						}
+				for i, in := range ins {
+					name := in.addon.Name()
+					utils.Info("installing addon %s...", name)
+					prog.start("install addon "+name, "rerun `kstack up`; pass --recover-stuck if helm reports the release as locked")
+					var sp *utils.Spinner
+					if !opts.dryRun {
+						sp = utils.NewSpinner(fmt.Sprintf("Installing %s", name))
+						sp.Start()
 					}
-					vals := a.ValuesFiles()
-					if ha && a.Name() == "postgres" {
-						if haFile, err := pgaddon.HAValuesFile(); err == nil && haFile != "" {
-							vals = append(vals, haFile)
-						} else if err != nil {
-							utils.Debug("failed to load HA values for postgres: %v", err)
-						}
+					err := installAddon(ctx, hc, in, true, 15*time.Minute, false)
+					if sp != nil {
+						sp.Stop()
 					}
-					allValues := append(vals, extraValues...)
-					merged, cleanup, err := helm.MergeValues(allValues, nil)
 					if err != nil {
 						return err
 					}
-					if err := hc.InstallOrUpgrade(a.Name(), chartName, a.Namespace(), merged, true, 15*time.Minute, false, setPairs); err != nil {
-						if cerr := cleanup(); cerr != nil {
-							utils.Debug("cleanup error: %v", cerr)
-						}
-						if sp != nil {
-							sp.Stop()
-						}
-						return err
-					}
-					if cerr := cleanup(); cerr != nil {
-						utils.Debug("cleanup error: %v", cerr)
-					}
-					if sp != nil {
-						sp.Stop()
-					}
 					utils.Info("addon %s installed", name)
+					prog.finish()
+					lockValues(ctx, hc, in, &entries[i])
+					locked.Set(entries[i])
+				}
+				if err := writeLock(locked, lockPath, opts.dryRun); err != nil {
+					return err
 				}
 			} else {
 				utils.Info("no addons requested")
@@ -288,68 +376,91 @@ func newUpCmd(opts *rootOptions) *cobra.Command {
 	cmd.Flags().StringArrayVar(&setPairs, "set", nil, "Set values (key=val). Can be supplied multiple times")
 	cmd.Flags().StringArrayVar(&extraValues, "values", nil, "Additional values files to pass (-f) to Helm. Can be supplied multiple times")
 	cmd.Flags().BoolVar(&ha, "ha", false, "Install HA variant for supported addons (e.g. postgres)")
+	cmd.Flags().StringArrayVar(&chartVersions, "chart-version", nil, "Install a specific chart version of an addon (addon=version), overriding the pinned default. Can be supplied multiple times")
+	cmd.Flags().BoolVar(&recoverStuck, "recover-stuck", false, "Roll back or remove addon releases stuck in a pending state by an interrupted helm operation, then retry")
+	cmd.Flags().BoolVar(&update, "update", false, "Re-resolve chart versions instead of installing the ones recorded in kstack.lock, and rewrite it")
+	cmd.Flags().BoolVar(&registry, "registry", false, "Provision a local registry at localhost:5001 that the cluster pulls from")
+	cmd.Flags().BoolVar(&preload, "preload-images", false, "Pull the images the addon charts use and load them into the nodes before installing")
+	cmd.Flags().BoolVar(&cache, "cache", false, "Pull Docker Hub, ghcr.io and quay.io images through local pull-through caches")
 	return cmd
 }
 
+// registryKey identifies a cluster on the registry containers created for it.
+func registryKey(c cfg.Config) string { return c.Provider + "-" + c.ClusterName }
+
 func newDownCmd(opts *rootOptions) *cobra.Command {
 	var purgeAddons bool
+	var keepRegistry bool
 	cmd := &cobra.Command{
 		Use:   "down",
 		Short: "Delete cluster (and optionally uninstall addons)",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			c := cfg.Defaults()
-			c.Provider = opts.provider
-			c.ClusterName = opts.clusterName
-			c.Namespace = opts.namespace
-			c.Timeout = opts.timeout
-			c.Verbose = opts.verbose
-			c.Debug = opts.debug
-			c = cfg.FromEnv(c)
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
 
 			utils.SetVerbose(c.Verbose)
 			utils.SetColorEnabled(!opts.noColor)
 			if opts.dryRun {
 				utils.Info("DRY-RUN: no external commands will be executed")
 			}
+			if err := c.Validate(); err != nil {
+				return err
+			}
 
-			var prov cluster.Provider
-			switch c.Provider {
-			case "kind":
-				prov = cluster.NewKindProvider(c.ClusterName)
-			case "k3d":
-				prov = cluster.NewK3dProvider(c.ClusterName)
-			default:
-				return fmt.Errorf("unknown provider: %s", c.Provider)
+			spec, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
 			}
-			cluster.SetDryRun(prov, opts.dryRun)
 
 			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
 			defer cancel()
+			prog := &progress{}
+			defer func() { err = prog.interrupted(ctx, err) }()
 
 			if purgeAddons {
 				utils.Info("purging addons before cluster deletion")
-				hc := helm.NewClient(opts.helmPath)
-				hc.DryRun = opts.dryRun
-				if ver, err := hc.Preflight(10 * time.Second); err != nil {
+				hc := newHelmClient(c, providerKubeconfig(ctx, c, prov), opts.dryRun)
+				if ver, err := hc.Preflight(ctx, 10*time.Second); err != nil {
 					return fmt.Errorf("helm is required to purge addons: %w", err)
 				} else {
 					utils.Debug("helm version: %s", ver)
 				}
-				for _, name := range addons.List() {
+				// Purge only the addons the stack declares; fall back to every
+				// built-in addon when none were configured.
+				names := c.Addons
+				if len(names) == 0 {
+					names = addons.List()
+				}
+				for _, name := range names {
+					prog.plan("uninstall addon " + name)
+				}
+				for _, name := range names {
 					a, err := addons.Get(name)
 					if err != nil {
 						utils.Debug("skipping uninstall for %s: %v", name, err)
 						continue
 					}
-					if err := hc.Uninstall(a.Name(), a.Namespace(), true, 30*time.Second); err != nil {
+					prog.start("uninstall addon "+name, "rerun `kstack down --purge-addons`")
+					if err := hc.Uninstall(ctx, a.Name(), a.Namespace(), true, 30*time.Second); err != nil {
+						if ctx.Err() != nil {
+							return err
+						}
 						utils.Debug("failed to uninstall addon %s: %v", name, err)
 						continue
 					}
 					utils.Info("uninstalled addon %s", name)
+					prog.finish()
 				}
 			}
+			prog.plan("delete cluster " + c.ClusterName)
 
+			if !spec.Has(cluster.CapManaged) {
+				return prov.Delete(ctx)
+			}
 			utils.Info("deleting cluster %s (purgeAddons=%v)", c.ClusterName, purgeAddons)
+			prog.start("delete cluster "+c.ClusterName, "rerun `kstack down`")
 			var sp *utils.Spinner
 			if !opts.dryRun {
 				sp = utils.NewSpinner("Deleting cluster")
@@ -365,10 +476,37 @@ func newDownCmd(opts *rootOptions) *cobra.Command {
 				sp.Stop()
 			}
 			utils.Info("cluster %s deleted", c.ClusterName)
+			prog.finish()
+			if !opts.dryRun {
+				if err := cluster.RemoveKubeconfig(c.Provider, c.ClusterName); err != nil {
+					utils.Warn("%v", err)
+				}
+				if removed, target, err := unmergeKubeconfig(c); err != nil {
+					utils.Warn("failed to remove context %s from %s: %v", contextName(c), target, err)
+				} else if removed {
+					utils.Info("removed context %s from %s", contextName(c), target)
+				}
+			}
+			if !spec.Has(cluster.CapRegistry) {
+				return nil
+			}
+			if keepRegistry || c.Registry.Keep {
+				utils.Info("keeping the local registry, if any")
+				return nil
+			}
+			// the cluster is gone at this point, so a failed cleanup only warns
+			names, err := cluster.DeleteRegistries(ctx, registryKey(c), opts.dryRun)
+			if err != nil {
+				utils.Warn("failed to remove the local registry: %v", err)
+			}
+			for _, name := range names {
+				utils.Info("registry %s deleted", name)
+			}
 			return nil
 		},
 	}
 	cmd.Flags().BoolVar(&purgeAddons, "purge-addons", false, "Uninstall addons before cluster deletion")
+	cmd.Flags().BoolVar(&keepRegistry, "keep-registry", false, "Keep the local registry (and its images) created by `up --registry`")
 	return cmd
 }
 
@@ -382,21 +520,34 @@ func newAddonsCmd(opts *rootOptions) *cobra.Command {
 	var extraValues []string
 
 	var installHA bool
+	var installVersion string
+	var installRecover bool
+	var installUpdate bool
 	installCmd := &cobra.Command{
 		Use:   "install [name]",
 		Short: "Install an addon",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			name := args[0]
-			utils.SetVerbose(opts.verbose)
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
 			utils.SetColorEnabled(!opts.noColor)
 			if opts.dryRun {
 				utils.Info("DRY-RUN: no external commands will be executed")
 			}
 
-			hc := helm.NewClient(opts.helmPath)
-			hc.DryRun = opts.dryRun
-			if ver, err := hc.Preflight(10 * time.Second); err != nil {
+			_, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			hc := newHelmClient(c, providerKubeconfig(ctx, c, prov), opts.dryRun)
+			hc.RecoverStuck = installRecover
+			if ver, err := hc.Preflight(ctx, 10*time.Second); err != nil {
 				return fmt.Errorf("helm not available or fails preflight: %w", err)
 			} else {
 				utils.Debug("helm version: %s", ver)
@@ -407,78 +558,45 @@ func newAddonsCmd(opts *rootOptions) *cobra.Command {
 				return err
 			}
 
-			chartName := a.Chart()
-			repoName := a.RepoName()
-			repoURL := a.RepoURL()
-			if installHA && a.Name() == "postgres" {
-				chartName = "bitnami/postgresql-ha"
-				repoName = "bitnami"
-				repoURL = "https://charts.bitnami.com/bitnami"
+			if err := cfg.ValidateValuesFiles(extraValues); err != nil {
+				return err
 			}
-
-			if !(strings.HasPrefix(chartName, "./") || strings.HasPrefix(chartName, "/")) {
-				if err := hc.RepoAdd(repoName, repoURL); err != nil {
-					return err
-				}
-				if err := hc.RepoUpdate(); err != nil {
-					return err
-				}
+			if err := cfg.ValidateSetPairs(setPairs); err != nil {
+				return err
 			}
 
-			for _, vf := range extraValues {
-				if vf == "" {
-					continue
-				}
-				info, err := os.Stat(vf)
-				if err != nil {
-					return fmt.Errorf("values file %s not found or unreadable: %w", vf, err)
-				}
-				if !info.Mode().IsRegular() {
-					return fmt.Errorf("values file %s is not a regular file", vf)
-				}
+			// the stack file's options for the addon, with --chart-version on top
+			if installVersion != "" {
+				c.SetChartVersions(map[string]string{name: installVersion})
 			}
-
-			var badSets []string
-			for _, s := range setPairs {
-				if s == "" || !strings.Contains(s, "=") {
-					badSets = append(badSets, s)
-					continue
-				}
-				parts := strings.SplitN(s, "=", 2)
-				if strings.TrimSpace(parts[0]) == "" {
-					badSets = append(badSets, s)
-				}
+			addonOpts := c.AddonOptions[name]
+			if err := cfg.ValidateValuesFiles(addonOpts.Values); err != nil {
+				return fmt.Errorf("addon %q: %w", name, err)
 			}
-			if len(badSets) > 0 {
-				return fmt.Errorf("invalid --set entries: %v; expected key=val with non-empty key", badSets)
+			lockPath := lock.Path(c.StackFile)
+			locked, err := lock.Read(lockPath)
+			if err != nil {
+				return err
 			}
-
-			addonValues := a.ValuesFiles()
-			if installHA && a.Name() == "postgres" {
-				if haFile, err := pgaddon.HAValuesFile(); err == nil && haFile != "" {
-					addonValues = append(addonValues, haFile)
-				} else if err != nil {
-					utils.Debug("failed to load HA values for postgres: %v", err)
-				}
+			in := resolveAddonInstall(a, installHA, addonOpts, extraValues, setPairs)
+			pinToLock(&in, locked, installUpdate)
+			pullDir, err := os.MkdirTemp("", "kstack-charts-")
+			if err != nil {
+				return fmt.Errorf("create chart dir: %w", err)
 			}
-			allValues := append(addonValues, extraValues...)
-			merged, cleanup, err := helm.MergeValues(allValues, nil)
+			defer os.RemoveAll(pullDir)
+			entry, err := lockChart(ctx, hc, &in, locked, installUpdate, filepath.Join(pullDir, name))
 			if err != nil {
 				return err
 			}
 
-			release := a.Name()
-			if err := hc.InstallOrUpgrade(release, chartName, a.Namespace(), merged, waitForInstall, helmTimeout, atomicInstall, setPairs); err != nil {
-				if cerr := cleanup(); cerr != nil {
-					utils.Debug("cleanup after failed install had error: %v", cerr)
-				}
+			if err := installAddon(ctx, hc, in, waitForInstall, helmTimeout, atomicInstall); err != nil {
 				return err
 			}
-			utils.Info("installed addon %s (release=%s) in ns=%s", a.Name(), release, a.Namespace())
-			if cerr := cleanup(); cerr != nil {
-				utils.Debug("cleanup after install had error: %v", cerr)
-			}
-			return nil
+			utils.Info("installed addon %s (release=%s) in ns=%s", a.Name(), a.Name(), a.Namespace())
+			lockValues(ctx, hc, in, &entry)
+			locked.Set(entry)
+			return writeLock(locked, lockPath, opts.dryRun)
 		},
 	}
 	installCmd.Flags().BoolVar(&waitForInstall, "wait", false, "Wait for resources to become ready (passes --wait to helm)")
@@ -487,6 +605,9 @@ func newAddonsCmd(opts *rootOptions) *cobra.Command {
 	installCmd.Flags().StringArrayVar(&setPairs, "set", nil, "Set values (key=val). Can be supplied multiple times")
 	installCmd.Flags().StringArrayVar(&extraValues, "values", nil, "Additional values files to pass (-f) to Helm. Can be supplied multiple times")
 	installCmd.Flags().BoolVar(&installHA, "ha", false, "Install HA variant for supported addons (e.g. postgres)")
+	installCmd.Flags().BoolVar(&installRecover, "recover-stuck", false, "Roll back or remove the release if it is stuck in a pending state, then retry")
+	installCmd.Flags().StringVar(&installVersion, "chart-version", "", "Chart version to install instead of the addon's pinned default")
+	installCmd.Flags().BoolVar(&installUpdate, "update", false, "Re-resolve the chart version instead of installing the one recorded in kstack.lock, and rewrite its entry")
 
 	var uninstallWait bool
 	var uninstallTimeout time.Duration
@@ -496,14 +617,23 @@ func newAddonsCmd(opts *rootOptions) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			name := args[0]
-			utils.SetVerbose(opts.verbose)
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
 			utils.SetColorEnabled(!opts.noColor)
 			if opts.dryRun {
 				utils.Info("DRY-RUN: no external commands will be executed")
 			}
-			hc := helm.NewClient(opts.helmPath)
-			hc.DryRun = opts.dryRun
-			if ver, err := hc.Preflight(10 * time.Second); err != nil {
+			_, prov, err := newProvider(c, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			hc := newHelmClient(c, providerKubeconfig(ctx, c, prov), opts.dryRun)
+			if ver, err := hc.Preflight(ctx, 10*time.Second); err != nil {
 				return fmt.Errorf("helm not available or fails preflight: %w", err)
 			} else {
 				utils.Debug("helm version: %s", ver)
@@ -512,7 +642,7 @@ func newAddonsCmd(opts *rootOptions) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			if err := hc.Uninstall(a.Name(), a.Namespace(), uninstallWait, uninstallTimeout); err != nil {
+			if err := hc.Uninstall(ctx, a.Name(), a.Namespace(), uninstallWait, uninstallTimeout); err != nil {
 				return err
 			}
 			utils.Info("uninstalled addon %s from ns=%s", a.Name(), a.Namespace())
@@ -530,7 +660,7 @@ func newAddonsCmd(opts *rootOptions) *cobra.Command {
 		return nil
 	}}
 
-	addonsCmd.AddCommand(installCmd, uninstallCmd, listCmd)
+	addonsCmd.AddCommand(installCmd, uninstallCmd, listCmd, newAddonsHistoryCmd(opts), newAddonsRollbackCmd(opts))
 	return addonsCmd
 }
 
@@ -545,57 +675,61 @@ func newStatusCmd(opts *rootOptions) *cobra.Command {
 				utils.Info("DRY-RUN: no external commands will be executed")
 			}
 
-			c := cfg.Defaults()
-			c.Provider = opts.provider
-			c.ClusterName = opts.clusterName
-			c.Namespace = opts.namespace
-			c.Kubeconfig = opts.kubeconfig
-			c.HelmPath = opts.helmPath
-			c.Timeout = opts.timeout
-			c.Verbose = opts.verbose
-			c.Debug = opts.debug
-			c = cfg.FromEnv(c)
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			if err := c.Validate(); err != nil {
+				return err
+			}
 
 			utils.Info("status for %s cluster '%s' (ns=%s)", c.Provider, c.ClusterName, c.Namespace)
 
-			var prov cluster.Provider
-			switch c.Provider {
-			case "kind":
-				prov = cluster.NewKindProvider(c.ClusterName)
-			case "k3d":
-				prov = cluster.NewK3dProvider(c.ClusterName)
-			default:
-				return fmt.Errorf("unknown provider: %s", c.Provider)
+			_, prov, err := newProvider(c, false)
+			if err != nil {
+				return err
 			}
 			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
 			defer cancel()
+			var kubePath string
 			exists, err := prov.Exists(ctx)
 			if err != nil {
 				utils.Info("- cluster: error checking existence: %v", err)
 			} else if exists {
 				utils.Info("- cluster: exists")
 				if kp, err := prov.KubeconfigPath(ctx); err == nil && kp != "" {
+					kubePath = kp
+					if c.Kubeconfig != "" {
+						// --context names a context of the explicit kubeconfig
+						kp = c.Kubeconfig
+					}
 					utils.Info("  kubeconfig: %s", kp)
+					if v, err := kubeconfig.ServerVersion(ctx, kp, c.KubeContext); err != nil {
+						utils.Info("  kubernetes: unknown (%v)", err)
+					} else {
+						utils.Info("  kubernetes: %s", v.GitVersion)
+					}
 				}
 			} else {
 				utils.Info("- cluster: not found")
 			}
 
-			hc := helm.NewClient(c.HelmPath)
-			hc.DryRun = opts.dryRun
-			if ver, err := hc.Preflight(5 * time.Second); err != nil {
+			hc := newHelmClient(c, kubePath, opts.dryRun)
+			if ver, err := hc.Preflight(ctx, 5*time.Second); err != nil {
 				utils.Info("- helm: not available (%v)", err)
 			} else {
 				utils.Debug("helm version: %s", ver)
-				rels, err := hc.ListReleases(c.Namespace)
-				if err != nil {
-					utils.Info("- addons: failed to list releases: %v", err)
-				} else if len(rels) == 0 {
-					utils.Info("- addons: none (namespace=%s)", c.Namespace)
-				} else {
-					utils.Info("- addons (namespace=%s):", c.Namespace)
-					for _, r := range rels {
-						utils.Info("  - %s: %s (chart=%s) updated=%s", r.Name, r.Status, r.Chart, r.Updated)
+				for _, ns := range statusNamespaces(c) {
+					rels, err := hc.ListReleases(ctx, ns)
+					if err != nil {
+						utils.Info("- addons: failed to list releases: %v", err)
+					} else if len(rels) == 0 {
+						utils.Info("- addons: none (namespace=%s)", ns)
+					} else {
+						utils.Info("- addons (namespace=%s):", ns)
+						for _, r := range rels {
+							utils.Info("  - %s: %s (chart=%s) updated=%s", r.Name, r.Status, r.Chart, r.Updated)
+						}
 					}
 				}
 			}
@@ -605,6 +739,110 @@ func newStatusCmd(opts *rootOptions) *cobra.Command {
 	return cmd
 }
 
+// newProvider looks up the configured provider in the registry and
+// constructs it for the configured cluster, applying dry-run if supported.
+func newProvider(c cfg.Config, dryRun bool) (cluster.Spec, cluster.Provider, error) {
+	spec, err := cluster.Lookup(c.Provider)
+	if err != nil {
+		return cluster.Spec{}, nil, err
+	}
+	prov := spec.New(cluster.Options{Name: c.ClusterName, Kubeconfig: c.Kubeconfig, Context: c.KubeContext, Settings: c.ProviderSettings()})
+	cluster.SetDryRun(prov, dryRun)
+	return spec, prov, nil
+}
+
+// applyChartVersions applies --chart-version addon=version overrides to the
+// selected addons of c.
+func applyChartVersions(c *cfg.Config, pairs []string) error {
+	versions, err := cfg.ParseChartVersions(pairs)
+	if err != nil {
+		return err
+	}
+	for name := range versions {
+		if !slices.Contains(c.Addons, name) {
+			return fmt.Errorf("--chart-version %s: addon %q is not selected", versions[name], name)
+		}
+	}
+	c.SetChartVersions(versions)
+	return nil
+}
+
+// newHelmClient returns a helm client targeting the configured --kubeconfig,
+// falling back to kubePath (the provider's kubeconfig for the cluster), and
+// the configured --context. An explicit kubeconfig always wins, since
+// --context names a context in it. Chart repositories and OCI registry
+// logins are kept in kstack's own helm configuration under the state
+// directory.
+func newHelmClient(c cfg.Config, kubePath string, dryRun bool) *helm.HelmClient {
+	hc := helm.NewClient(c.HelmPath)
+	hc.DryRun = dryRun
+	hc.Kubeconfig = c.Kubeconfig
+	if hc.Kubeconfig == "" {
+		hc.Kubeconfig = kubePath
+	}
+	hc.KubeContext = c.KubeContext
+	hc.RepositoryConfig = filepath.Join(utils.StateDir(), "helm", "repositories.yaml")
+	hc.RepositoryCache = filepath.Join(utils.StateDir(), "helm", "repository")
+	hc.RegistryConfig = filepath.Join(utils.StateDir(), "helm", "registry", "config.json")
+	return hc
+}
+
+// providerKubeconfig returns the provider's kubeconfig for the cluster, or
+// "" with a warning when it cannot produce one. It is not consulted when a
+// kubeconfig is configured explicitly.
+func providerKubeconfig(ctx context.Context, c cfg.Config, prov cluster.Provider) string {
+	if c.Kubeconfig != "" {
+		return ""
+	}
+	kp, err := prov.KubeconfigPath(ctx)
+	if err != nil {
+		utils.Warn("could not get the kubeconfig of %s cluster %s: %v", c.Provider, c.ClusterName, err)
+		return ""
+	}
+	return kp
+}
+
+// warnK8sVersionMismatch warns when an existing cluster runs a different
+// Kubernetes minor version than the one pinned in the configuration.
+func warnK8sVersionMismatch(ctx context.Context, kubePath, want string) {
+	wantMinor, _, err := cluster.ParseK8sVersion(want)
+	if err != nil {
+		return
+	}
+	v, err := kubeconfig.ServerVersion(ctx, kubePath, "")
+	if err != nil {
+		utils.Debug("could not determine running Kubernetes version: %v", err)
+		return
+	}
+	gotMinor, _, err := cluster.ParseK8sVersion(strings.SplitN(v.GitVersion, "+", 2)[0])
+	if err == nil && gotMinor != wantMinor {
+		utils.Warn("cluster already exists and runs Kubernetes %s, not the pinned %s; recreate it with `kstack down` to change versions", v.GitVersion, want)
+	}
+}
+
+// statusNamespaces returns the namespaces whose releases status should list:
+// the namespaces of the configured addons, or the configured namespace when
+// no addons are declared.
+func statusNamespaces(c cfg.Config) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, name := range c.Addons {
+		a, err := addons.Get(name)
+		if err != nil {
+			utils.Debug("status: skipping unknown addon %s: %v", name, err)
+			continue
+		}
+		if !seen[a.Namespace()] {
+			seen[a.Namespace()] = true
+			out = append(out, a.Namespace())
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, c.Namespace)
+	}
+	return out
+}
+
 func newPreflightCmd(opts *rootOptions) *cobra.Command {
 	var verboseFlag bool
 	var debugFlag bool
@@ -612,15 +850,12 @@ func newPreflightCmd(opts *rootOptions) *cobra.Command {
 		Use:   "preflight",
 		Short: "Run environment preflight checks (CLIs, Docker, Helm, provider)",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c := cfg.Defaults()
-			c.Provider = opts.provider
-			c.HelmPath = opts.helmPath
-			c.Timeout = opts.timeout
-			c.Verbose = opts.verbose
-			c.Debug = opts.debug
-			c = cfg.FromEnv(c)
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
 
-			utils.SetVerbose(opts.verbose)
+			utils.SetVerbose(c.Verbose)
 			utils.SetColorEnabled(!opts.noColor)
 			if opts.dryRun {
 				utils.Info("DRY-RUN: no external commands will be executed")
@@ -629,27 +864,23 @@ func newPreflightCmd(opts *rootOptions) *cobra.Command {
 			preflight.Verbose = verboseFlag || c.Verbose
 			preflight.Debug = debugFlag || c.Debug
 
-			if !opts.dryRun {
-				if err := preflight.CheckProviderCLI(c.Provider); err != nil {
-					return err
-				}
-			} else {
-				utils.Info("DRY-RUN: preflight provider CLI check for %s", c.Provider)
+			spec, err := cluster.Lookup(c.Provider)
+			if err != nil {
+				return err
 			}
-
 			ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Second)
 			defer cancel()
 			if !opts.dryRun {
-				if err := preflight.CheckDocker(ctx); err != nil {
+				if err := spec.Preflight(ctx); err != nil {
 					return err
 				}
 			} else {
-				utils.Info("DRY-RUN: preflight docker check")
+				utils.Info("DRY-RUN: preflight checks for provider %s", spec.Name)
 			}
 
 			hc := helm.NewClient(c.HelmPath)
 			hc.DryRun = opts.dryRun
-			if ver, err := hc.Preflight(5 * time.Second); err != nil {
+			if ver, err := hc.Preflight(ctx, 5*time.Second); err != nil {
 				return fmt.Errorf("helm preflight failed: %w", err)
 			} else {
 				fmt.Printf("helm: %s\n", ver)
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/christk1/kstack/pkg/bundle"
+	"github.com/christk1/kstack/pkg/cluster"
+	"github.com/christk1/kstack/pkg/helm"
 )
 
 // NOTE: These tests exercise Cobra command flows in dry-run mode to avoid
@@ -372,3 +384,804 @@ func TestStatus_HelmListParseError(t *testing.T) {
 		t.Fatalf("status should not fail on helm list parse error: %v", err)
 	}
 }
+
+func TestUp_DryRun_StackFile(t *testing.T) {
+	dir := t.TempDir()
+	stack := filepath.Join(dir, "kstack.yaml")
+	content := "provider: k3d\ncluster: gc-stack\naddons:\n  - example-app\n  - name: postgres\n    ha: true\n    set: [auth.postgresPassword=dev]\n"
+	if err := os.WriteFile(stack, []byte(content), 0o644); err != nil {
+		t.Fatalf("write stack file: %v", err)
+	}
+	opts := &rootOptions{stackFile: stack, dryRun: true, noColor: true}
+	for _, cmd := range []*cobra.Command{newUpCmd(opts), newStatusCmd(opts), newDownCmd(opts)} {
+		cmd.SetContext(context.Background())
+		if cmd.Name() == "down" {
+			cmd.Flags().Set("purge-addons", "true")
+		}
+		if err := cmd.RunE(cmd, nil); err != nil {
+			t.Fatalf("%s dry-run with stack file failed: %v", cmd.Name(), err)
+		}
+	}
+}
+
+func TestUp_StackFile_ValidationError(t *testing.T) {
+	dir := t.TempDir()
+	stack := filepath.Join(dir, "kstack.yaml")
+	if err := os.WriteFile(stack, []byte("addons:\n  - name: kafka\n    values: [nope.yaml]\n"), 0o644); err != nil {
+		t.Fatalf("write stack file: %v", err)
+	}
+	opts := &rootOptions{stackFile: stack, dryRun: true, noColor: true}
+	cmd := newUpCmd(opts)
+	cmd.SetContext(context.Background())
+	if err := cmd.RunE(cmd, nil); err == nil {
+		t.Fatalf("expected validation error for missing values file")
+	}
+}
+
+func TestConfigView_ShowOrigin(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("GO_CLOUD_CLUSTER", "from-env")
+	opts := &rootOptions{clusterName: "from-flag"}
+	cmd := newConfigCmd(opts)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"view", "--show-origin"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("config view failed: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"cluster", "from-flag", "flag --cluster", "provider", "default"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in output:\n%s", want, got)
+		}
+	}
+}
+
+func TestUpDown_ExistingProvider_Unreachable(t *testing.T) {
+	kc := filepath.Join(t.TempDir(), "kubeconfig")
+	content := "apiVersion: v1\nkind: Config\ncurrent-context: ci\nclusters:\n- {name: ci, cluster: {server: \"http://127.0.0.1:1\"}}\ncontexts:\n- {name: ci, context: {cluster: ci, user: ci}}\nusers:\n- {name: ci, user: {}}\n"
+	if err := os.WriteFile(kc, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts := &rootOptions{provider: "existing", clusterName: "ci", kubeconfig: kc, kubeContext: "ci", namespace: "gc", timeout: 5 * time.Second, noColor: true}
+	up := newUpCmd(opts)
+	up.SetContext(context.Background())
+	if err := up.RunE(up, nil); err == nil || !strings.Contains(err.Error(), "does not create clusters") {
+		t.Fatalf("expected unreachable existing cluster error, got %v", err)
+	}
+	down := newDownCmd(opts)
+	down.SetContext(context.Background())
+	if err := down.RunE(down, nil); err != nil {
+		t.Fatalf("down should leave an existing cluster in place: %v", err)
+	}
+}
+
+func TestUp_HelmTargetsProviderKubeconfig(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "helm-args")
+	writeFake(t, "kind", "#!/usr/bin/env bash\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"clusters\" ]; then echo gc-kc; exit 0; fi\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"kubeconfig\" ]; then echo 'apiVersion: v1'; exit 0; fi\nexit 0\n")
+	writeFake(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\nif [ \"$1\" = \"version\" ]; then echo v3.14.0; fi\nexit 0\n")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-kc", addons: "example-app", namespace: "gc", helmPath: helm, timeout: 5 * time.Second, noColor: true}
+	cmd := newUpCmd(opts)
+	cmd.SetContext(context.Background())
+	if err := cmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	b, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var upgrade string
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(l, "upgrade ") {
+			upgrade = l
+		}
+	}
+	if want := "--kubeconfig " + cluster.KubeconfigFile("kind", "gc-kc", false); !strings.Contains(upgrade, want) {
+		t.Fatalf("helm upgrade should target the kind kubeconfig, got %q", upgrade)
+	}
+
+	// an explicit --kubeconfig wins over the provider's, with --context applied to it
+	os.Remove(argsFile)
+	explicit := filepath.Join(t.TempDir(), "config")
+	opts.kubeconfig, opts.kubeContext = explicit, "team"
+	for _, args := range [][]string{nil, {"uninstall", "example-app"}} {
+		var cmd *cobra.Command
+		if args == nil {
+			cmd = newUpCmd(opts)
+		} else {
+			cmd = newAddonsCmd(opts)
+			cmd.SetArgs(args)
+		}
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	b, _ = os.ReadFile(argsFile)
+	seen := 0
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if strings.HasPrefix(l, "upgrade ") || strings.HasPrefix(l, "uninstall ") {
+			if !strings.HasSuffix(l, "--kubeconfig "+explicit+" --kube-context team") {
+				t.Fatalf("helm should target the explicit kubeconfig, got %q", l)
+			}
+			seen++
+		}
+	}
+	if seen != 2 {
+		t.Fatalf("expected an upgrade and an uninstall, got:\n%s", b)
+	}
+}
+
+func TestKubeconfigCmd_PathMergeUnmerge(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "kind-args")
+	kc := "apiVersion: v1\nkind: Config\ncurrent-context: kind-gc-kc\nclusters:\n- {name: kind-gc-kc, cluster: {server: \"https://127.0.0.1:40000\"}}\ncontexts:\n- {name: kind-gc-kc, context: {cluster: kind-gc-kc, user: kind-gc-kc}}\nusers:\n- {name: kind-gc-kc, user: {token: t}}\n"
+	writeFake(t, "kind", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"kubeconfig\" ]; then cat <<'EOF'\n"+kc+"EOF\nfi\nexit 0\n")
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "config"))
+	opts := &rootOptions{provider: "kind", clusterName: "gc-kc", timeout: 5 * time.Second, noColor: true}
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := newKubeconfigCmd(opts)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("kubeconfig %v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	if got, want := strings.TrimSpace(run()), cluster.KubeconfigFile("kind", "gc-kc", false); got != want {
+		t.Fatalf("kubeconfig path = %q, want %q", got, want)
+	}
+	if got := run("--print"); !strings.Contains(got, "127.0.0.1:40000") {
+		t.Fatalf("--print output missing server: %q", got)
+	}
+	if got := strings.TrimSpace(run("--internal")); got != cluster.KubeconfigFile("kind", "gc-kc", true) {
+		t.Fatalf("--internal path = %q", got)
+	}
+	if b, _ := os.ReadFile(argsFile); !strings.Contains(string(b), "get kubeconfig --name gc-kc --internal") {
+		t.Fatalf("--internal should ask kind for the internal kubeconfig: %s", b)
+	}
+
+	run("--merge")
+	merged, err := os.ReadFile(os.Getenv("KUBECONFIG"))
+	if err != nil || !strings.Contains(string(merged), "current-context: kstack-gc-kc") {
+		t.Fatalf("merge did not write context: %v\n%s", err, merged)
+	}
+	run("--unmerge")
+	merged, _ = os.ReadFile(os.Getenv("KUBECONFIG"))
+	if strings.Contains(string(merged), "kstack-gc-kc") {
+		t.Fatalf("unmerge left the context behind:\n%s", merged)
+	}
+
+	cmd := newKubeconfigCmd(opts)
+	cmd.SetArgs([]string{"--merge", "--print"})
+	if err := cmd.ExecuteContext(context.Background()); err == nil {
+		t.Fatalf("expected --merge and --print to be mutually exclusive")
+	}
+}
+
+func TestImageLoad_DryRunAndUnsupported(t *testing.T) {
+	opts := &rootOptions{provider: "k3d", clusterName: "gc", timeout: 5 * time.Second, dryRun: true, noColor: true}
+	cmd := newImageCmd(opts)
+	cmd.SetArgs([]string{"load", "my-app:latest"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("image load dry-run failed: %v", err)
+	}
+
+	opts = &rootOptions{provider: "existing", clusterName: "gc", timeout: 5 * time.Second, dryRun: true, noColor: true}
+	cmd = newImageCmd(opts)
+	cmd.SetArgs([]string{"load", "my-app:latest"})
+	if err := cmd.ExecuteContext(context.Background()); err == nil || !strings.Contains(err.Error(), "cannot load images") {
+		t.Fatalf("expected unsupported provider error, got %v", err)
+	}
+}
+
+func TestUpDown_DryRun_Registry(t *testing.T) {
+	opts := &rootOptions{provider: "k3d", clusterName: "gc", timeout: 5 * time.Second, dryRun: true, noColor: true}
+	cmd := newUpCmd(opts)
+	cmd.SetArgs([]string{"--registry"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("up --registry dry-run failed: %v", err)
+	}
+	cmd = newDownCmd(opts)
+	cmd.SetArgs([]string{"--keep-registry"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("down --keep-registry dry-run failed: %v", err)
+	}
+
+	opts = &rootOptions{provider: "minikube", clusterName: "gc", timeout: 5 * time.Second, dryRun: true, noColor: true}
+	cmd = newUpCmd(opts)
+	cmd.SetArgs([]string{"--registry"})
+	if err := cmd.ExecuteContext(context.Background()); err == nil || !strings.Contains(err.Error(), "does not support a local registry") {
+		t.Fatalf("expected unsupported registry error, got %v", err)
+	}
+}
+
+func TestUp_UnsupportedK8sVersion_FailsBeforeRegistry(t *testing.T) {
+	dockerArgs := filepath.Join(t.TempDir(), "docker-args")
+	writeFake(t, "kind", "#!/usr/bin/env bash\nif [ \"$1\" = \"version\" ]; then echo 'kind v0.22.0 go1.21 linux/amd64'; fi\nexit 0\n")
+	writeFake(t, "docker", "#!/usr/bin/env bash\necho \"$@\" >> "+dockerArgs+"\nexit 0\n")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-pin", k8sVersion: "1.30", timeout: 5 * time.Second, noColor: true}
+	cmd := newUpCmd(opts)
+	cmd.SetArgs([]string{"--registry"})
+	if err := cmd.ExecuteContext(context.Background()); err == nil || !strings.Contains(err.Error(), "does not support Kubernetes 1.30") {
+		t.Fatalf("expected unsupported version error, got %v", err)
+	}
+	if b, _ := os.ReadFile(dockerArgs); strings.Contains(string(b), "kstack-registry") {
+		t.Fatalf("the registry must not be touched for an unsupported version:\n%s", b)
+	}
+}
+
+func TestCacheCmd_StatusAndPrune(t *testing.T) {
+	writeFake(t, "docker", "#!/usr/bin/env bash\ncase \"$1\" in\n"+
+		"  ps) printf 'kstack-cache-docker-io\\tdocker.io\\trunning\\n';;\n"+
+		"  exec) printf '3072\\t/var/lib/registry\\n';;\nesac\nexit 0\n")
+	opts := &rootOptions{timeout: 5 * time.Second, noColor: true}
+	cmd := newCacheCmd(opts)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"status"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("cache status failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "docker.io") || !strings.Contains(out.String(), "3.0MiB") {
+		t.Fatalf("unexpected cache status output:\n%s", out.String())
+	}
+
+	opts.dryRun = true
+	cmd = newCacheCmd(opts)
+	cmd.SetArgs([]string{"prune", "docker.io"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("cache prune dry-run failed: %v", err)
+	}
+}
+
+func TestUp_PreloadImages_WithFakes(t *testing.T) {
+	dir := t.TempDir()
+	dockerArgs := filepath.Join(dir, "docker-args")
+	kindArgs := filepath.Join(dir, "kind-args")
+	writeFake(t, "kind", "#!/usr/bin/env bash\necho \"$@\" >> "+kindArgs+"\nif [ \"$1 $2\" = \"get clusters\" ]; then echo gc-pre; fi\nif [ \"$1 $2\" = \"get kubeconfig\" ]; then echo 'apiVersion: v1'; fi\nif [ \"$1 $2\" = \"get nodes\" ]; then echo gc-pre-control-plane; fi\nexit 0\n")
+	// app:1 is local, bad:1 cannot be pulled, sidecar:1 pulls fine
+	writeFake(t, "docker", "#!/usr/bin/env bash\necho \"$@\" >> "+dockerArgs+"\n"+
+		"if [ \"$1 $2\" = \"image inspect\" ]; then [ \"$3\" = app:1 ] || [ -f "+dir+"/pulled-$3 ] && exit 0; exit 1; fi\n"+
+		"if [ \"$1\" = pull ]; then [ \"$2\" = bad:1 ] && { echo 'denied' >&2; exit 1; }; touch "+dir+"/pulled-$2; fi\nexit 0\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\nif [ \"$1\" = \"version\" ]; then echo v3.14.0; fi\n"+
+		"if [ \"$1\" = \"template\" ]; then printf 'kind: Deployment\\nspec:\\n  containers:\\n  - image: app:1\\n  - image: bad:1\\n  - image: sidecar:1\\n'; fi\nexit 0\n")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-pre", addons: "example-app", namespace: "gc", helmPath: helm, timeout: 5 * time.Second, noColor: true}
+	cmd := newUpCmd(opts)
+	cmd.SetArgs([]string{"--preload-images"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("up --preload-images failed: %v", err)
+	}
+	b, _ := os.ReadFile(dockerArgs)
+	if strings.Contains(string(b), "pull app:1") || !strings.Contains(string(b), "pull sidecar:1") {
+		t.Fatalf("unexpected docker invocations:\n%s", b)
+	}
+	b, _ = os.ReadFile(kindArgs)
+	if !strings.Contains(string(b), "load docker-image app:1 sidecar:1 --name gc-pre") {
+		t.Fatalf("expected kind to load the pullable images:\n%s", b)
+	}
+}
+
+func TestBundle_CreateLoadAndOfflineUp(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	helmArgs := filepath.Join(dir, "helm-args")
+	kindArgs := filepath.Join(dir, "kind-args")
+	writeFake(t, "docker", "#!/usr/bin/env bash\nif [ \"$1\" = save ]; then echo images > \"$3\"; fi\nexit 0\n")
+	writeFake(t, "kind", "#!/usr/bin/env bash\necho \"$@\" >> "+kindArgs+"\n"+
+		"case \"$1 $2\" in\n  'version '*|version) echo 'kind v0.23.0 go1.22 linux/amd64';;\n  'get kubeconfig') echo 'apiVersion: v1';;\n  'get nodes') echo gc-off-control-plane;;\nesac\nexit 0\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\necho \"$@\" >> "+helmArgs+"\n"+
+		"case \"$1\" in\n  version) echo v3.14.0;;\n"+
+		"  pull) touch \"${@: -1}/prometheus-25.0.0.tgz\";;\n"+
+		"  package) touch \"${@: -1}/example-app-0.1.0.tgz\";;\n"+
+		"  template) printf 'spec:\\n  containers:\\n  - image: app:1\\n';;\nesac\nexit 0\n")
+	out := filepath.Join(dir, "stack.tar.gz")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-off", addons: "prometheus,example-app", namespace: "gc", helmPath: helm, timeout: 5 * time.Second, noColor: true}
+
+	cmd := newBundleCmd(opts)
+	cmd.SetArgs([]string{"create", "--out", out})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("bundle create failed: %v", err)
+	}
+	cmd = newBundleCmd(opts)
+	cmd.SetArgs([]string{"load", out})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("bundle load failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(bundle.Dir()) })
+
+	os.Remove(helmArgs)
+	if err := newUpCmd(opts).ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("offline up failed: %v", err)
+	}
+	b, _ := os.ReadFile(helmArgs)
+	if strings.Contains(string(b), "repo ") {
+		t.Fatalf("offline up should not touch repositories:\n%s", b)
+	}
+	if !strings.Contains(string(b), "upgrade --install prometheus "+filepath.Join(bundle.Dir(), "charts", "prometheus", "prometheus-25.0.0.tgz")) {
+		t.Fatalf("expected install from the bundled archive:\n%s", b)
+	}
+	b, _ = os.ReadFile(kindArgs)
+	if !strings.Contains(string(b), "create cluster --name gc-off --image kindest/node:v1.30.0") || !strings.Contains(string(b), "load docker-image app:1 --name gc-off") {
+		t.Fatalf("expected bundled node image and images to be used:\n%s", b)
+	}
+}
+
+// writeChartArchive packages a minimal chart name-version.tgz into dir, as
+// `helm pull` would, and returns its path.
+func writeChartArchive(t *testing.T, dir, name, version, appVersion string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	chartYAML := "apiVersion: v2\nname: " + name + "\nversion: " + version + "\nappVersion: \"" + appVersion + "\"\n"
+	if err := tw.WriteHeader(&tar.Header{Name: name + "/Chart.yaml", Mode: 0o644, Size: int64(len(chartYAML))}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte(chartYAML))
+	tw.Close()
+	gz.Close()
+	p := filepath.Join(dir, name+"-"+version+".tgz")
+	if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// fakeHelmPull is a fake helm case that "pulls" <chart>-<version>.tgz
+// from charts into the --destination directory.
+func fakeHelmPull(charts string) string {
+	return "  pull) cp " + charts + "/\"$(basename \"$2\")-$4.tgz\" \"${@: -1}/\";;\n"
+}
+
+func TestUp_ChartVersions_WithFakes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "helm-args")
+	writeChartArchive(t, dir, "prometheus", "25.27.0", "v2.54.1")
+	writeChartArchive(t, dir, "grafana", "8.4.0", "11.1.0")
+	writeFake(t, "kind", "#!/usr/bin/env bash\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"clusters\" ]; then echo gc-ver; exit 0; fi\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"kubeconfig\" ]; then echo 'apiVersion: v1'; exit 0; fi\nexit 0\n")
+	writeFake(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\ncase \"$1\" in\n  version) echo v3.14.0;;\n"+fakeHelmPull(dir)+"esac\nexit 0\n")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-ver", addons: "prometheus,grafana", namespace: "gc", helmPath: helm, timeout: 5 * time.Second, noColor: true}
+
+	cmd := newUpCmd(opts)
+	cmd.SetArgs([]string{"--chart-version", "kafka=30.0.0"})
+	if err := cmd.ExecuteContext(context.Background()); err == nil || !strings.Contains(err.Error(), `addon "kafka" is not selected`) {
+		t.Fatalf("expected error for unselected addon, got %v", err)
+	}
+
+	cmd = newUpCmd(opts)
+	cmd.SetArgs([]string{"--chart-version", "grafana=8.4.0"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	b, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"pull prometheus-community/prometheus --version 25.27.0 ",
+		"pull grafana/grafana --version 8.4.0 ",
+		"/grafana/grafana-8.4.0.tgz -n monitoring",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in helm invocations:\n%s", want, b)
+		}
+	}
+}
+
+func TestUp_Lockfile_WithFakes(t *testing.T) {
+	dir := t.TempDir()
+	charts := filepath.Join(dir, "charts")
+	os.MkdirAll(charts, 0o755)
+	argsFile := filepath.Join(dir, "helm-args")
+	listFile := filepath.Join(dir, "list.json")
+	writeChartArchive(t, charts, "grafana", "8.5.1", "11.2.0")
+	writeFake(t, "kind", "#!/usr/bin/env bash\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"clusters\" ]; then echo gc-lock; exit 0; fi\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"kubeconfig\" ]; then echo 'apiVersion: v1'; exit 0; fi\nexit 0\n")
+	writeFake(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\ncase \"$1\" in\n  version) echo v3.14.0;;\n"+fakeHelmPull(charts)+
+		"  get) echo '{\"adminUser\": \"admin\"}';;\n  list) cat "+listFile+";;\nesac\nexit 0\n")
+	stack := filepath.Join(dir, "kstack.yaml")
+	os.WriteFile(stack, []byte("cluster: gc-lock\naddons: [grafana]\n"), 0o644)
+	lockPath := filepath.Join(dir, "kstack.lock")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-lock", namespace: "gc", helmPath: helm, timeout: 5 * time.Second, noColor: true, stackFile: stack}
+	up := func(args ...string) error {
+		cmd := newUpCmd(opts)
+		cmd.SetArgs(args)
+		return cmd.ExecuteContext(context.Background())
+	}
+	verify := func() error {
+		cmd := newLockCmd(opts)
+		cmd.SetArgs([]string{"verify"})
+		return cmd.ExecuteContext(context.Background())
+	}
+
+	if err := up(); err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	b, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatalf("kstack.lock not written: %v", err)
+	}
+	for _, want := range []string{"name: grafana", "chart: grafana/grafana", "repo: https://grafana.github.io/helm-charts", "version: 8.5.1", "appVersion: 11.2.0", "digest: sha256:", "valuesHash: sha256:"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in kstack.lock:\n%s", want, b)
+		}
+	}
+
+	os.WriteFile(listFile, []byte(`[{"name":"grafana","namespace":"monitoring","chart":"grafana-8.5.1","app_version":"11.2.0"}]`), 0o644)
+	if err := verify(); err != nil {
+		t.Fatalf("lock verify should pass: %v", err)
+	}
+	os.WriteFile(listFile, []byte(`[{"name":"grafana","namespace":"monitoring","chart":"grafana-8.6.0","app_version":"11.3.0"}]`), 0o644)
+	if err := verify(); err == nil || !strings.Contains(err.Error(), "1 of 1 addon(s) drifted") {
+		t.Fatalf("expected drift, got %v", err)
+	}
+
+	// the lock wins over a requested version
+	os.Remove(argsFile)
+	if err := up("--chart-version", "grafana=9.0.0"); err != nil {
+		t.Fatalf("locked up failed: %v", err)
+	}
+	if b, _ := os.ReadFile(argsFile); !strings.Contains(string(b), "pull grafana/grafana --version 8.5.1 ") {
+		t.Fatalf("expected the locked version to be pulled:\n%s", b)
+	}
+
+	// a republished chart no longer matches the locked digest
+	writeChartArchive(t, charts, "grafana", "8.5.1", "11.2.1")
+	if err := up(); err == nil || !strings.Contains(err.Error(), "does not match kstack.lock") {
+		t.Fatalf("expected digest mismatch, got %v", err)
+	}
+	if err := up("--update"); err != nil {
+		t.Fatalf("up --update failed: %v", err)
+	}
+	if b, _ := os.ReadFile(lockPath); !strings.Contains(string(b), "appVersion: 11.2.1") {
+		t.Fatalf("expected --update to rewrite the lock:\n%s", b)
+	}
+}
+
+func TestUp_OCIChart_StoredCredentials_WithFakes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "helm-args")
+	charts := filepath.Join(dir, "charts")
+	os.MkdirAll(charts, 0o755)
+	writeChartArchive(t, charts, "kafka", "30.1.0", "3.8.0")
+	writeFake(t, "kind", "#!/usr/bin/env bash\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"clusters\" ]; then echo gc-oci; exit 0; fi\nif [ \"$1\" = \"get\" ] && [ \"$2\" = \"kubeconfig\" ]; then echo 'apiVersion: v1'; exit 0; fi\nexit 0\n")
+	writeFake(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\nif [ \"$1\" = registry ]; then echo \"$* $(cat)\" >> "+argsFile+"; exit 0; fi\necho \"$@\" >> "+argsFile+"\ncase \"$1\" in\n  version) echo v3.14.0;;\n"+fakeHelmPull(charts)+"esac\nexit 0\n")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-oci", addons: "kafka", namespace: "gc", helmPath: helm, timeout: 5 * time.Second, noColor: true}
+
+	login := newRegistryCmd(opts)
+	login.SetIn(strings.NewReader("t0ken\n"))
+	login.SetArgs([]string{"login", "registry-1.docker.io", "-u", "bot", "--password-stdin"})
+	if err := login.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("registry login failed: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(credentialsPath()) })
+	var out bytes.Buffer
+	list := newRegistryCmd(opts)
+	list.SetOut(&out)
+	list.SetArgs([]string{"list"})
+	if err := list.ExecuteContext(context.Background()); err != nil || !strings.Contains(out.String(), "registry-1.docker.io  bot") {
+		t.Fatalf("registry list: %v\n%s", err, out.String())
+	}
+
+	os.Remove(argsFile)
+	if err := newUpCmd(opts).ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	b, _ := os.ReadFile(argsFile)
+	if strings.Contains(string(b), "repo ") {
+		t.Fatalf("OCI charts need no repository:\n%s", b)
+	}
+	for _, want := range []string{
+		"registry login registry-1.docker.io --username bot --password-stdin t0ken",
+		"pull oci://registry-1.docker.io/bitnamicharts/kafka --version 30.1.0 ",
+		"/kafka/kafka-30.1.0.tgz -n kafka",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in helm invocations:\n%s", want, b)
+		}
+	}
+
+	logout := newRegistryCmd(opts)
+	logout.SetArgs([]string{"logout", "registry-1.docker.io"})
+	if err := logout.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("registry logout failed: %v", err)
+	}
+	if b, _ := os.ReadFile(credentialsPath()); strings.Contains(string(b), "registry-1.docker.io") {
+		t.Fatalf("credentials not removed:\n%s", b)
+	}
+}
+
+func TestAddons_Install_StuckRelease_Hint(t *testing.T) {
+	helmPath := writeFake(t, "helm", "#!/usr/bin/env bash\ncase \"$1\" in\n version) echo v3.12.1;;\n upgrade) echo 'Error: UPGRADE FAILED: another operation (install/upgrade/rollback) is in progress'; exit 1;;\n esac\nexit 0\n")
+	opts := &rootOptions{helmPath: helmPath, dryRun: false}
+	cmd := newAddonsCmd(opts)
+	cmd.SetContext(context.Background())
+	cmd.SetArgs([]string{"install", "example-app"})
+	err := cmd.Execute()
+	if !errors.Is(err, helm.ErrReleaseLocked) || !strings.Contains(err.Error(), "rerun with --recover-stuck") {
+		t.Fatalf("expected a locked-release error with a hint, got %v", err)
+	}
+}
+
+func TestUp_Interrupted_ReportsProgress(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	started := filepath.Join(dir, "started")
+	writeChartArchive(t, dir, "grafana", "8.5.1", "11.2.0")
+	writeFake(t, "kind", "#!/usr/bin/env bash\nif [ \"$1 $2\" = \"get kubeconfig\" ]; then echo 'apiVersion: v1'; fi\nexit 0\n")
+	writeFake(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\ncase \"$1\" in\n  version) echo v3.14.0;;\n"+fakeHelmPull(dir)+
+		"  upgrade) trap 'kill $pid; exit 1' TERM; touch "+started+"; sleep 30 & pid=$!; wait $pid;;\nesac\nexit 0\n")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-int", addons: "example-app,grafana", namespace: "gc", helmPath: helm, timeout: time.Minute, noColor: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			if _, err := os.Stat(started); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	cmd := newUpCmd(opts)
+	cmd.SetArgs(nil)
+	err := cmd.ExecuteContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled up, got %v", err)
+	}
+	for _, want := range []string{
+		"interrupted while trying to install addon example-app",
+		"done: create cluster gc-int",
+		"left half-done: install addon example-app (rerun `kstack up`",
+		"not started: install addon grafana",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestDiff_WithFakes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	rendered := filepath.Join(dir, "rendered.yaml")
+	deployed := filepath.Join(dir, "deployed.yaml")
+	writeFake(t, "kind", "#!/usr/bin/env bash\nif [ \"$1 $2\" = \"get kubeconfig\" ]; then echo 'apiVersion: v1'; fi\nexit 0\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\ncase \"$1\" in\n  version) echo v3.14.0;;\n  upgrade) echo \"$@\" > "+rendered+".args; cat "+rendered+";;\n"+
+		"  get) [ -f "+deployed+" ] || { echo 'Error: release: not found' >&2; exit 1; }; cat "+deployed+";;\nesac\nexit 0\n")
+	opts := &rootOptions{provider: "kind", clusterName: "gc-diff", namespace: "gc", helmPath: helm, timeout: 5 * time.Second, noColor: true}
+	diff := func() (string, error) {
+		var out bytes.Buffer
+		cmd := newDiffCmd(opts)
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{"example-app"})
+		err := cmd.ExecuteContext(context.Background())
+		return out.String(), err
+	}
+	cm := func(v string) string {
+		return "---\n# Source: app/templates/cm.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  key: " + v + "\n"
+	}
+	render := func(manifest string) {
+		b, _ := json.Marshal(map[string]string{"manifest": manifest})
+		os.WriteFile(rendered, b, 0o644)
+	}
+	render(cm("new") + "---\napiVersion: v1\nkind: Service\nmetadata:\n  name: app\n")
+
+	out, err := diff()
+	if !errors.Is(err, errDiffFound) || !strings.Contains(err.Error(), "2 object(s) would change") || !strings.Contains(out, "@@ -0,0 +1,") {
+		t.Fatalf("expected every object of a new release to be created, got %v:\n%s", err, out)
+	}
+	if b, _ := os.ReadFile(rendered + ".args"); !strings.Contains(string(b), "--dry-run=server -o json") {
+		t.Fatalf("expected a server-side dry run, got %q", b)
+	}
+
+	os.WriteFile(deployed, []byte(cm("old")+"---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: gone\n"), 0o644)
+	out, err = diff()
+	if err == nil || !strings.Contains(err.Error(), "3 object(s) would change") {
+		t.Fatalf("expected 3 changed objects, got %v:\n%s", err, out)
+	}
+	for _, want := range []string{
+		"--- ConfigMap app (deployed)\n+++ ConfigMap app (rendered)\n",
+		"-  key: old\n+  key: new\n",
+		"+++ Service app (rendered)\n@@ -0,0 +1,4 @@\n",
+		"--- Secret gone (deployed)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in diff:\n%s", want, out)
+		}
+	}
+
+	os.WriteFile(deployed, []byte(cm("new")+"---\napiVersion: v1\nkind: Service\nmetadata:\n  name: app\n"), 0o644)
+	if out, err = diff(); err != nil || out != "" {
+		t.Fatalf("expected no changes, got %v:\n%s", err, out)
+	}
+
+	secret := func(password string) string {
+		return "---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: app\ndata:\n  password: " + password + "\n  user: YWRtaW4=\n"
+	}
+	os.WriteFile(deployed, []byte(secret("b2xk")), 0o644)
+	render(secret("bmV3"))
+	out, err = diff()
+	if err == nil || strings.Contains(out, "b2xk") || strings.Contains(out, "bmV3") || strings.Contains(out, "YWRtaW4=") {
+		t.Fatalf("expected a redacted Secret diff, got %v:\n%s", err, out)
+	}
+	if !strings.Contains(out, "-  password: <redacted>\n+  password: <redacted, changed>\n") {
+		t.Fatalf("expected the changed Secret key to show, got:\n%s", out)
+	}
+}
+
+func TestTemplate_WithFakes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "helm-args")
+	// no cluster provider may be called
+	writeFake(t, "kind", "#!/usr/bin/env bash\necho 'kind must not run' >&2\nexit 1\n")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\ncase \"$1\" in\n  version) echo v3.14.0;;\n"+
+		"  template) printf -- '---\\n# Source: app/templates/deploy.yaml\\napiVersion: apps/v1\\nkind: Deployment\\nmetadata:\\n  name: app\\n"+
+		"---\\napiVersion: apiextensions.k8s.io/v1\\nkind: CustomResourceDefinition\\nmetadata:\\n  name: widgets.example.com\\n"+
+		"---\\napiVersion: v1\\nkind: Pod\\nmetadata:\\n  name: app-test\\n  annotations:\\n    helm.sh/hook: test\\n';;\nesac\nexit 0\n")
+	out := filepath.Join(dir, "rendered")
+	stale := filepath.Join(out, "app", "example-app", "service-old.yaml")
+	os.MkdirAll(filepath.Dir(stale), 0o755)
+	os.WriteFile(stale, []byte("kind: Service\n"), 0o644)
+
+	opts := &rootOptions{provider: "kind", clusterName: "gc-tpl", addons: "example-app", helmPath: helm, timeout: 5 * time.Second, noColor: true}
+	cmd := newTemplateCmd(opts)
+	cmd.SetArgs([]string{"--out", out, "--set", "replicas=2"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("template failed: %v", err)
+	}
+	addonDir := filepath.Join(out, "app", "example-app")
+	entries, _ := os.ReadDir(addonDir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "customresourcedefinition-widgets.example.com.yaml,deployment-app.yaml" {
+		t.Fatalf("unexpected manifests %v", names)
+	}
+	b, _ := os.ReadFile(filepath.Join(addonDir, "deployment-app.yaml"))
+	if !strings.HasPrefix(string(b), "# Source: app/templates/deploy.yaml\napiVersion: apps/v1\n") {
+		t.Fatalf("unexpected manifest:\n%s", b)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if !strings.Contains(string(args), "-n app") || !strings.Contains(string(args), "--set replicas=2 --include-crds") || strings.Contains(string(args), "--kubeconfig") {
+		t.Fatalf("unexpected helm invocations:\n%s", args)
+	}
+}
+
+func TestAddons_HistoryAndRollback_WithFakes(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "args")
+	writeFake(t, "kind", "#!/usr/bin/env bash\nif [ \"$1 $2\" = \"get kubeconfig\" ]; then echo 'apiVersion: v1'; fi\nexit 0\n")
+	helm := writeFake(t, "helm", `#!/usr/bin/env bash
+echo "$@" >> `+log+`
+case "$1" in
+  version) echo v3.14.0;;
+  history)
+    [ "$2" = grafana ] || { echo 'Error: release: not found' >&2; exit 1; }
+    echo '[{"revision":3,"updated":"2026-10-15T17:40:31Z","status":"deployed","chart":"grafana-8.5.2","app_version":"11.2.1","description":"Upgrade complete"},
+      {"revision":2,"updated":"2026-10-14T08:00:00Z","status":"superseded","chart":"grafana-8.5.1","app_version":"11.2.0","description":"Upgrade complete"}]';;
+  get)
+    case "$*" in
+      *"--revision 2"*) echo '{"adminPassword":"a","replicas":1}';;
+      *) echo '{"adminPassword":"b","persistence":{"enabled":true}}';;
+    esac;;
+esac
+exit 0
+`)
+	opts := &rootOptions{provider: "kind", clusterName: "gc-history", namespace: "gc", helmPath: helm, timeout: time.Minute, noColor: true}
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		cmd := newAddonsCmd(opts)
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+		err := cmd.ExecuteContext(context.Background())
+		return out.String(), err
+	}
+
+	out, err := run("history", "grafana")
+	if err != nil {
+		t.Fatalf("addons history: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "REVISION") {
+		t.Fatalf("unexpected history table:\n%s", out)
+	}
+	if f := strings.Fields(lines[1]); f[0] != "2" || f[3] != "superseded" || f[4] != "grafana-8.5.1" || f[6] != "-" {
+		t.Fatalf("unexpected oldest revision row: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "+persistence.enabled ~adminPassword -replicas") || !strings.Contains(lines[2], "grafana-8.5.2") {
+		t.Fatalf("expected a values summary for revision 3: %q", lines[2])
+	}
+
+	if _, err := run("history", "prometheus"); err == nil || !strings.Contains(err.Error(), "addon prometheus is not installed in namespace monitoring") {
+		t.Fatalf("expected a not-installed error, got %v", err)
+	}
+	if _, err := run("rollback", "grafana", "zero"); err == nil || !strings.Contains(err.Error(), "invalid revision") {
+		t.Fatalf("expected an invalid revision error, got %v", err)
+	}
+
+	if _, err := run("rollback", "grafana", "2", "--wait", "--helm-timeout", "20s"); err != nil {
+		t.Fatalf("addons rollback: %v", err)
+	}
+	if _, err := run("rollback", "grafana"); err != nil {
+		t.Fatalf("addons rollback to previous: %v", err)
+	}
+	b, _ := os.ReadFile(log)
+	args := string(b)
+	for _, want := range []string{
+		"history grafana -n monitoring -o json --kubeconfig ",
+		"get values grafana -n monitoring -o json --revision 3 --kubeconfig ",
+		"rollback grafana 2 -n monitoring --wait --timeout 20s --kubeconfig ",
+		"rollback grafana -n monitoring --kubeconfig ",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("expected helm to be called with %q, got:\n%s", want, args)
+		}
+	}
+}
+
+func TestAddons_Install_StackFileOptionsAndLock_WithFakes(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "helm-args")
+	writeChartArchive(t, dir, "grafana", "8.4.0", "11.1.0")
+	writeChartArchive(t, dir, "grafana", "8.5.0", "11.2.0")
+	helm := writeFake(t, "helm", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\ncase \"$1\" in\n  version) echo v3.14.0;;\n"+fakeHelmPull(dir)+
+		"  get) echo '{\"adminUser\": \"dev\"}';;\nesac\nexit 0\n")
+	stack := filepath.Join(dir, "kstack.yaml")
+	os.WriteFile(stack, []byte("addons:\n  - name: grafana\n    chartVersion: 8.4.0\n    set: [adminUser=dev]\n"), 0o644)
+	lockPath := filepath.Join(dir, "kstack.lock")
+	opts := &rootOptions{provider: "existing", helmPath: helm, timeout: 5 * time.Second, noColor: true, stackFile: stack}
+	install := func(args ...string) string {
+		os.Remove(argsFile)
+		cmd := newAddonsCmd(opts)
+		cmd.SetArgs(append([]string{"install", "grafana"}, args...))
+		if err := cmd.ExecuteContext(context.Background()); err != nil {
+			t.Fatalf("addons install %v: %v", args, err)
+		}
+		b, _ := os.ReadFile(argsFile)
+		return string(b)
+	}
+	locked := func() string {
+		b, err := os.ReadFile(lockPath)
+		if err != nil {
+			t.Fatalf("kstack.lock not written: %v", err)
+		}
+		return string(b)
+	}
+
+	// the stack file's options apply, and the installed chart is locked
+	got := install()
+	if !strings.Contains(got, "pull grafana/grafana --version 8.4.0 ") || !strings.Contains(got, "grafana-8.4.0.tgz -n monitoring") || !strings.Contains(got, "--set adminUser=dev") {
+		t.Fatalf("expected the stack file's options:\n%s", got)
+	}
+	if l := locked(); !strings.Contains(l, "version: 8.4.0") || !strings.Contains(l, "valuesHash: sha256:") {
+		t.Fatalf("expected the install to be locked:\n%s", l)
+	}
+
+	// the lock wins over --chart-version unless --update is passed
+	if got := install("--chart-version", "8.5.0"); !strings.Contains(got, "pull grafana/grafana --version 8.4.0 ") {
+		t.Fatalf("expected the locked version:\n%s", got)
+	}
+	got = install("--chart-version", "8.5.0", "--update")
+	if !strings.Contains(got, "pull grafana/grafana --version 8.5.0 ") || !strings.Contains(got, "--set adminUser=dev") {
+		t.Fatalf("expected --chart-version over the stack file's:\n%s", got)
+	}
+	if l := locked(); !strings.Contains(l, "version: 8.5.0") {
+		t.Fatalf("expected --update to rewrite the lock:\n%s", l)
+	}
+	if got := install(); !strings.Contains(got, "pull grafana/grafana --version 8.5.0 ") {
+		t.Fatalf("expected the newly locked version:\n%s", got)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/christk1/kstack/pkg/cluster"
+	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/utils"
+)
+
+// preloadAddonImages renders every addon's chart, pulls the images it uses
+// into the local Docker daemon and loads them into the cluster's nodes, so
+// that Helm's --wait does not time out on slow image pulls. Preloading is
+// an optimization: failures are reported as warnings and the installs
+// proceed, pulling whatever is missing from inside the cluster.
+func preloadAddonImages(ctx context.Context, hc *helm.HelmClient, prov cluster.Provider, ins []addonInstall, dryRun bool) {
+	seen := map[string]bool{}
+	var images []string
+	for _, in := range ins {
+		imgs, err := addonImages(ctx, hc, in)
+		if err != nil {
+			utils.Warn("cannot work out the images of addon %s; skipping its preload: %v", in.addon.Name(), err)
+			continue
+		}
+		utils.Debug("addon %s uses images: %s", in.addon.Name(), strings.Join(imgs, ", "))
+		for _, img := range imgs {
+			if !seen[img] {
+				seen[img] = true
+				images = append(images, img)
+			}
+		}
+	}
+	if dryRun {
+		utils.Info("DRY-RUN: pull the images rendered by the addon charts and load them into the cluster's nodes")
+		return
+	}
+	if len(images) == 0 {
+		return
+	}
+	sort.Strings(images)
+
+	utils.Info("preloading %d image(s) for addons", len(images))
+	pulled, failed, err := cluster.PullMissingImages(ctx, images, false)
+	if len(pulled) > 0 {
+		utils.Info("pulled %s", strings.Join(pulled, ", "))
+	}
+	if err != nil {
+		utils.Warn("some addon images could not be pulled and are left to the cluster: %v", err)
+		images = without(images, failed)
+		if len(images) == 0 {
+			return
+		}
+	}
+	nodes, err := cluster.LoadImages(ctx, prov, images)
+	if err != nil {
+		utils.Warn("loading addon images into the cluster failed: %v", err)
+		return
+	}
+	utils.Info("loaded %d image(s) into %d node(s)", len(images), len(nodes))
+}
+
+// without returns the elements of list that are not in drop.
+func without(list, drop []string) []string {
+	skip := make(map[string]bool, len(drop))
+	for _, d := range drop {
+		skip[d] = true
+	}
+	var out []string
+	for _, s := range list {
+		if !skip[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
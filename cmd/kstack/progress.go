@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// progress records the steps of a command that changes the cluster, so that
+// a run interrupted by Ctrl-C or --timeout can tell what it finished, what
+// it left half-done and what it never started.
+type progress struct {
+	done    []string
+	pending []string
+	// current is the step in flight and recover how to repair it when it
+	// is cut short.
+	current string
+	recover string
+}
+
+// plan adds steps that have not started yet.
+func (p *progress) plan(steps ...string) { p.pending = append(p.pending, steps...) }
+
+// start marks step as in flight, replacing a previous step that was neither
+// finished nor interrupted (e.g. one whose failure was only logged); recover
+// tells the user how to repair it if it is interrupted.
+func (p *progress) start(step, recover string) {
+	p.pending = slices.DeleteFunc(p.pending, func(s string) bool { return s == step })
+	p.current, p.recover = step, recover
+}
+
+// finish marks the step in flight as done.
+func (p *progress) finish() {
+	if p.current != "" {
+		p.done = append(p.done, p.current)
+	}
+	p.current, p.recover = "", ""
+}
+
+// interrupted returns err unchanged unless ctx was cancelled or timed out,
+// in which case the error also reports the progress made so far.
+func (p *progress) interrupted(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	reason := "interrupted"
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		reason = "timed out (see --timeout)"
+	}
+	var b strings.Builder
+	if p.current != "" {
+		fmt.Fprintf(&b, "%s while trying to %s: %v", reason, p.current, err)
+	} else {
+		fmt.Fprintf(&b, "%s: %v", reason, err)
+	}
+	if len(p.done) > 0 {
+		fmt.Fprintf(&b, "\n  done: %s", strings.Join(p.done, ", "))
+	}
+	if p.current != "" {
+		fmt.Fprintf(&b, "\n  left half-done: %s", p.current)
+		if p.recover != "" {
+			fmt.Fprintf(&b, " (%s)", p.recover)
+		}
+	}
+	if len(p.pending) > 0 {
+		fmt.Fprintf(&b, "\n  not started: %s", strings.Join(p.pending, ", "))
+	}
+	return &interruptedError{summary: b.String(), err: err}
+}
+
+// interruptedError is the error of an interrupted command; it unwraps to
+// the error of the step that was cut short.
+type interruptedError struct {
+	summary string
+	err     error
+}
+
+func (e *interruptedError) Error() string { return e.summary }
+func (e *interruptedError) Unwrap() error { return e.err }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/utils"
+)
+
+// credentialsPath is where `kstack registry login` stores OCI registry
+// credentials.
+func credentialsPath() string { return filepath.Join(utils.StateDir(), "credentials.yaml") }
+
+// registryLogin logs hc in to the OCI registry host with the stored
+// credentials; registries without any are pulled from anonymously.
+func registryLogin(ctx context.Context, hc *helm.HelmClient, host string) error {
+	creds, err := helm.LoadCredentials(credentialsPath())
+	if err != nil {
+		return err
+	}
+	cred, ok := creds[host]
+	if !ok {
+		utils.Debug("no stored credentials for %s; pulling anonymously", host)
+		return nil
+	}
+	return hc.RegistryLogin(ctx, host, cred.Username, cred.Password)
+}
+
+func newRegistryCmd(opts *rootOptions) *cobra.Command {
+	registryCmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Manage credentials for OCI chart registries",
+		Long: "Addons whose chart is an oci:// reference are pulled straight from their registry.\n" +
+			"`registry login` stores credentials that kstack uses to log in before pulling from a private registry.",
+	}
+
+	var username, password string
+	var passwordStdin bool
+	loginCmd := &cobra.Command{
+		Use:   "login <host>",
+		Short: "Verify and store credentials for an OCI registry (e.g. ghcr.io or localhost:5001)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			host := strings.TrimPrefix(args[0], "oci://")
+			if username == "" {
+				return fmt.Errorf("--username is required")
+			}
+			if passwordStdin {
+				b, err := io.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return fmt.Errorf("read password: %w", err)
+				}
+				password = strings.TrimRight(string(b), "\r\n")
+			}
+			if password == "" {
+				return fmt.Errorf("pass the password with --password-stdin or --password")
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			hc := newHelmClient(c, "", opts.dryRun)
+			if err := hc.RegistryLogin(ctx, host, username, password); err != nil {
+				return err
+			}
+			if opts.dryRun {
+				utils.Info("DRY-RUN: store credentials for %s in %s", host, credentialsPath())
+				return nil
+			}
+			creds, err := helm.LoadCredentials(credentialsPath())
+			if err != nil {
+				return err
+			}
+			creds[host] = helm.Credential{Username: username, Password: password}
+			if err := creds.Save(credentialsPath()); err != nil {
+				return fmt.Errorf("store credentials: %w", err)
+			}
+			utils.Info("logged in to %s; credentials stored in %s", host, credentialsPath())
+			return nil
+		},
+	}
+	loginCmd.Flags().StringVarP(&username, "username", "u", "", "Registry username")
+	loginCmd.Flags().StringVarP(&password, "password", "p", "", "Registry password or token (prefer --password-stdin)")
+	loginCmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password or token from stdin")
+	loginCmd.MarkFlagsMutuallyExclusive("password", "password-stdin")
+
+	logoutCmd := &cobra.Command{
+		Use:   "logout <host>",
+		Short: "Forget the stored credentials of an OCI registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			host := strings.TrimPrefix(args[0], "oci://")
+			creds, err := helm.LoadCredentials(credentialsPath())
+			if err != nil {
+				return err
+			}
+			if _, ok := creds[host]; !ok {
+				utils.Info("no credentials stored for %s", host)
+				return nil
+			}
+			if opts.dryRun {
+				utils.Info("DRY-RUN: remove the credentials for %s from %s", host, credentialsPath())
+				return nil
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			if err := newHelmClient(c, "", false).RegistryLogout(ctx, host); err != nil {
+				utils.Debug("%v", err)
+			}
+			delete(creds, host)
+			if err := creds.Save(credentialsPath()); err != nil {
+				return fmt.Errorf("store credentials: %w", err)
+			}
+			utils.Info("removed the credentials for %s", host)
+			return nil
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the registries with stored credentials",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			creds, err := helm.LoadCredentials(credentialsPath())
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "REGISTRY\tUSERNAME")
+			for _, host := range creds.Hosts() {
+				fmt.Fprintf(w, "%s\t%s\n", host, creds[host].Username)
+			}
+			return w.Flush()
+		},
+	}
+
+	registryCmd.AddCommand(loginCmd, logoutCmd, listCmd)
+	return registryCmd
+}
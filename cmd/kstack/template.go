@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+
+	cfg "github.com/christk1/kstack/internal/config"
+	"github.com/christk1/kstack/pkg/addons"
+	"github.com/christk1/kstack/pkg/helm"
+	"github.com/christk1/kstack/pkg/lock"
+	"github.com/christk1/kstack/utils"
+)
+
+func newTemplateCmd(opts *rootOptions) *cobra.Command {
+	var setPairs []string
+	var extraValues []string
+	var ha bool
+	var chartVersions []string
+	var out string
+
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Render the selected addons to plain Kubernetes manifests, without a cluster",
+		Long: "Render the chart of every selected addon with the values `kstack up` would use (addon defaults, HA variants,\n" +
+			"the stack file, --values and --set) and the versions in kstack.lock. Each addon is written to\n" +
+			"<out>/<namespace>/<addon>/, one YAML file per Kubernetes object, replacing what an earlier run wrote there.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+			utils.SetVerbose(c.Verbose)
+			utils.SetColorEnabled(!opts.noColor)
+			if opts.dryRun {
+				utils.Info("DRY-RUN: no external commands will be executed")
+			}
+			if len(c.Addons) == 0 {
+				return fmt.Errorf("no addons to render; select them with --addons or a stack file")
+			}
+			if err := applyChartVersions(&c, chartVersions); err != nil {
+				return err
+			}
+			if err := c.Validate(); err != nil {
+				return err
+			}
+			if err := cfg.ValidateValuesFiles(extraValues); err != nil {
+				return err
+			}
+			if err := cfg.ValidateSetPairs(setPairs); err != nil {
+				return err
+			}
+			locked, err := lock.Read(lock.Path(c.StackFile))
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
+			defer cancel()
+			hc := newHelmClient(c, "", opts.dryRun)
+			if ver, err := hc.Preflight(ctx, 10*time.Second); err != nil {
+				return fmt.Errorf("helm not available or fails preflight: %w", err)
+			} else {
+				utils.Debug("helm version: %s", ver)
+			}
+
+			for _, name := range c.Addons {
+				a, err := addons.Get(name)
+				if err != nil {
+					return err
+				}
+				in := resolveAddonInstall(a, ha, c.AddonOptions[name], extraValues, setPairs)
+				pinToLock(&in, locked, false)
+				if err := templateAddon(ctx, hc, in, out, opts.dryRun); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&out, "out", "o", "rendered", "Directory to write the manifests to")
+	cmd.Flags().StringArrayVar(&setPairs, "set", nil, "Set values (key=val). Can be supplied multiple times")
+	cmd.Flags().StringArrayVar(&extraValues, "values", nil, "Additional values files to pass (-f) to Helm. Can be supplied multiple times")
+	cmd.Flags().BoolVar(&ha, "ha", false, "Render the HA variant for supported addons (e.g. postgres)")
+	cmd.Flags().StringArrayVar(&chartVersions, "chart-version", nil, "Render a specific chart version of an addon (addon=version). Can be supplied multiple times")
+	return cmd
+}
+
+// templateAddon renders in, CRDs included, into out/<namespace>/<addon>/
+// with one file per object. Test hooks are left out: they only run under
+// `helm test`.
+func templateAddon(ctx context.Context, hc *helm.HelmClient, in addonInstall, out string, dryRun bool) error {
+	name := in.addon.Name()
+	dir := filepath.Join(out, in.addon.Namespace(), name)
+	manifests, err := renderAddon(ctx, hc, in, true)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		utils.Info("DRY-RUN: write the manifests of addon %s to %s", name, dir)
+		return nil
+	}
+	objs, err := helm.SplitManifest(manifests)
+	if err != nil {
+		return fmt.Errorf("addon %s: %w", name, err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	written := 0
+	seen := map[string]int{}
+	for _, o := range objs {
+		if strings.HasPrefix(o.Hook, "test") {
+			continue
+		}
+		file := manifestFileName(o)
+		if seen[file]++; seen[file] > 1 {
+			file = fmt.Sprintf("%s-%d.yaml", strings.TrimSuffix(file, ".yaml"), seen[file])
+		}
+		content := o.YAML
+		if o.Source != "" {
+			content = "# Source: " + o.Source + "\n" + content
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			return err
+		}
+		written++
+	}
+	utils.Info("rendered addon %s: %d manifest(s) in %s", name, written, dir)
+	return nil
+}
+
+// manifestFileName names the file of an object after its kind and name,
+// e.g. deployment-grafana.yaml.
+func manifestFileName(o helm.Object) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, o.Kind+"-"+o.Name)
+	return name + ".yaml"
+}
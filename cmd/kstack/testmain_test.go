@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain keeps managed kubeconfigs, merged contexts and kstack.lock files
+// written by the tests out of the real kstack state directory,
+// ~/.kube/config and the source tree.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "kstack-home-*")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("KSTACK_HOME", dir)
+	os.Setenv("KUBECONFIG", filepath.Join(dir, "kube", "config"))
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/christk1/kstack/pkg/cluster"
 )
 
 // Config holds runtime options for kstack operations.
@@ -11,14 +18,39 @@ type Config struct {
 	Provider    string
 	ClusterName string
 	Addons      []string
-	Namespace   string
-	Kubeconfig  string
+	// AddonOptions holds per-addon settings keyed by addon name. It is only
+	// populated from a stack file; addons without an entry use defaults.
+	AddonOptions map[string]AddonOptions
+	Namespace    string
+	Kubeconfig   string
+	// KubeContext selects a kubeconfig context; empty means the current one.
+	KubeContext string
 	HelmPath    string
 	Timeout     time.Duration
 	Verbose     bool
 	Debug       bool
+	// K8sVersion pins the Kubernetes version (e.g. 1.30 or 1.30.4); empty
+	// uses the provider's default.
+	K8sVersion string
+	// Settings holds provider settings from the stack file (e.g. kind node
+	// counts, ports and mounts) keyed by provider name. Only those of the
+	// selected provider are valid; see ProviderSettings.
+	Settings map[string]cluster.Settings
+	// Registry is the optional local registry provisioned by `up`.
+	Registry cluster.LocalRegistry
+	// Cache is the optional set of pull-through registry caches used by `up`.
+	Cache cluster.Cache
+	// PreloadImages makes `up` pull the images used by the addon charts and
+	// load them into the nodes before installing.
+	PreloadImages bool
+	// StackFile is the path of the stack file the config was loaded from, if any.
+	StackFile string
 }
 
+// clusterNameRe matches names accepted by both kind and k3d (lowercase
+// RFC 1123 labels).
+var clusterNameRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
 // Defaults returns baseline defaults for the CLI.
 func Defaults() Config {
 	return Config{
@@ -32,41 +64,14 @@ func Defaults() Config {
 	}
 }
 
-// FromEnv overlays values from environment variables (if set).
-// Environment variables:
+// FromEnv overlays values from environment variables (if set). Each setting
+// is read from KSTACK_<NAME>, falling back to the legacy GO_CLOUD_<NAME>:
+//
+//	PROVIDER, CLUSTER, ADDONS, NAMESPACE, KUBECONFIG, HELM, TIMEOUT, VERBOSE, DEBUG
 //
-//	GO_CLOUD_PROVIDER, GO_CLOUD_CLUSTER, GO_CLOUD_ADDONS, GO_CLOUD_NAMESPACE,
-//	GO_CLOUD_KUBECONFIG, GO_CLOUD_HELM, GO_CLOUD_TIMEOUT, GO_CLOUD_VERBOSE, GO_CLOUD_DEBUG
+// Unparseable values are ignored; use Load to have them reported.
 func FromEnv(base Config) Config {
-	if v := os.Getenv("GO_CLOUD_PROVIDER"); v != "" {
-		base.Provider = v
-	}
-	if v := os.Getenv("GO_CLOUD_CLUSTER"); v != "" {
-		base.ClusterName = v
-	}
-	if v := os.Getenv("GO_CLOUD_ADDONS"); v != "" {
-		base.Addons = ParseAddonsCSV(v)
-	}
-	if v := os.Getenv("GO_CLOUD_NAMESPACE"); v != "" {
-		base.Namespace = v
-	}
-	if v := os.Getenv("GO_CLOUD_KUBECONFIG"); v != "" {
-		base.Kubeconfig = v
-	}
-	if v := os.Getenv("GO_CLOUD_HELM"); v != "" {
-		base.HelmPath = v
-	}
-	if v := os.Getenv("GO_CLOUD_TIMEOUT"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			base.Timeout = d
-		}
-	}
-	if v := os.Getenv("GO_CLOUD_VERBOSE"); v != "" {
-		base.Verbose = strings.EqualFold(v, "true") || v == "1"
-	}
-	if v := os.Getenv("GO_CLOUD_DEBUG"); v != "" {
-		base.Debug = strings.EqualFold(v, "true") || v == "1"
-	}
+	_ = applyEnv(&base, nil)
 	return base
 }
 
@@ -86,3 +91,170 @@ func ParseAddonsCSV(s string) []string {
 	}
 	return out
 }
+
+// Validate checks the configuration for mistakes that would otherwise only
+// surface halfway through `up`. All problems are reported together.
+func (c Config) Validate() error {
+	var errs []error
+	if _, err := cluster.Lookup(c.Provider); err != nil {
+		errs = append(errs, err)
+	}
+	if !clusterNameRe.MatchString(c.ClusterName) {
+		errs = append(errs, fmt.Errorf("invalid cluster name %q: use lowercase letters, digits and '-'", c.ClusterName))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("timeout must be positive, got %s", c.Timeout))
+	}
+	if c.K8sVersion != "" {
+		if _, _, err := cluster.ParseK8sVersion(c.K8sVersion); err != nil {
+			errs = append(errs, err)
+		} else if spec, err := cluster.Lookup(c.Provider); err == nil && spec.ValidateK8sVersion != nil {
+			if err := spec.ValidateK8sVersion(c.K8sVersion); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if s := c.ProviderSettings(); s != nil && s.NodeImage() != "" {
+			errs = append(errs, errors.New("k8s-version cannot be combined with an explicit node image"))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Settings)) {
+		s := c.Settings[name]
+		if s == nil || s.IsZero() {
+			continue
+		}
+		if name != c.Provider {
+			errs = append(errs, fmt.Errorf("%s settings are only valid with provider %s (provider is %q)", name, name, c.Provider))
+		} else if err := s.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Registry.Enabled {
+		if spec, err := cluster.Lookup(c.Provider); err == nil && !spec.Has(cluster.CapRegistry) {
+			errs = append(errs, fmt.Errorf("provider %s does not support a local registry", c.Provider))
+		}
+		if err := c.Registry.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if s := c.ProviderSettings(); s != nil && s.ConfigPath() != "" {
+			errs = append(errs, fmt.Errorf("a local registry cannot be combined with a passed-through %s config", c.Provider))
+		}
+	}
+	if c.Cache.Enabled {
+		if spec, err := cluster.Lookup(c.Provider); err == nil && !spec.Has(cluster.CapRegistry) {
+			errs = append(errs, fmt.Errorf("provider %s does not support a registry cache", c.Provider))
+		}
+		if err := c.Cache.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if s := c.ProviderSettings(); s != nil && s.ConfigPath() != "" {
+			errs = append(errs, fmt.Errorf("a registry cache cannot be combined with a passed-through %s config", c.Provider))
+		}
+	}
+	seen := make(map[string]bool, len(c.Addons))
+	for i, name := range c.Addons {
+		if name == "" {
+			errs = append(errs, fmt.Errorf("addons[%d]: name is required", i))
+			continue
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("addon %q listed more than once", name))
+		}
+		seen[name] = true
+		opts := c.AddonOptions[name]
+		if err := ValidateValuesFiles(opts.Values); err != nil {
+			errs = append(errs, fmt.Errorf("addon %q: %w", name, err))
+		}
+		if err := ValidateSetPairs(opts.Set); err != nil {
+			errs = append(errs, fmt.Errorf("addon %q: %w", name, err))
+		}
+		if strings.ContainsAny(opts.ChartVersion, " \t") {
+			errs = append(errs, fmt.Errorf("addon %q: invalid chartVersion %q", name, opts.ChartVersion))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errors.Join(errs...)
+	if c.StackFile != "" {
+		return fmt.Errorf("invalid stack file %s:\n%w", c.StackFile, err)
+	}
+	return fmt.Errorf("invalid configuration:\n%w", err)
+}
+
+// ValidateValuesFiles ensures every non-empty path refers to a readable
+// regular file.
+func ValidateValuesFiles(files []string) error {
+	for _, vf := range files {
+		if vf == "" {
+			continue
+		}
+		info, err := os.Stat(vf)
+		if err != nil {
+			return fmt.Errorf("values file %s not found or unreadable: %w", vf, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("values file %s is not a regular file", vf)
+		}
+	}
+	return nil
+}
+
+// ValidateSetPairs ensures every entry has the form key=val with a non-empty key.
+func ValidateSetPairs(pairs []string) error {
+	var bad []string
+	for _, s := range pairs {
+		if s == "" || !strings.Contains(s, "=") {
+			bad = append(bad, s)
+			continue
+		}
+		parts := strings.SplitN(s, "=", 2)
+		if strings.TrimSpace(parts[0]) == "" {
+			bad = append(bad, s)
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("invalid --set entries: %v; expected key=val with non-empty key", bad)
+	}
+	return nil
+}
+
+// ParseChartVersions parses `addon=version` pairs from --chart-version into
+// a map keyed by addon name.
+func ParseChartVersions(pairs []string) (map[string]string, error) {
+	out := make(map[string]string, len(pairs))
+	var bad []string
+	for _, p := range pairs {
+		name, version, ok := strings.Cut(p, "=")
+		name, version = strings.TrimSpace(name), strings.TrimSpace(version)
+		if !ok || name == "" || version == "" || strings.ContainsAny(version, " \t") {
+			bad = append(bad, p)
+			continue
+		}
+		out[name] = version
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("invalid --chart-version entries: %v; expected addon=version", bad)
+	}
+	return out, nil
+}
+
+// ProviderSettings returns the settings of the selected provider, or nil.
+func (c Config) ProviderSettings() cluster.Settings {
+	return c.Settings[c.Provider]
+}
+
+// SetChartVersions applies --chart-version overrides on top of the stack
+// file's per-addon options.
+func (c *Config) SetChartVersions(versions map[string]string) {
+	if len(versions) == 0 {
+		return
+	}
+	if c.AddonOptions == nil {
+		c.AddonOptions = make(map[string]AddonOptions, len(versions))
+	}
+	for name, v := range versions {
+		o := c.AddonOptions[name]
+		o.ChartVersion = v
+		c.AddonOptions[name] = o
+	}
+}
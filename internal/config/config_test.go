@@ -2,6 +2,7 @@ package config
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -60,3 +61,23 @@ func TestParseAddonsCSV(t *testing.T) {
 		}
 	}
 }
+
+func TestChartVersions(t *testing.T) {
+	if _, err := ParseChartVersions([]string{"grafana", "=1.0.0", "kafka="}); err == nil || !strings.Contains(err.Error(), "expected addon=version") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+	v, err := ParseChartVersions([]string{"grafana=8.4.0", " kafka = 29.0.0 "})
+	if err != nil {
+		t.Fatalf("ParseChartVersions: %v", err)
+	}
+	c := Defaults()
+	c.Addons = []string{"grafana", "kafka"}
+	c.AddonOptions = map[string]AddonOptions{"grafana": {HA: true, ChartVersion: "8.5.1"}}
+	c.SetChartVersions(v)
+	if g := c.AddonOptions["grafana"]; g.ChartVersion != "8.4.0" || !g.HA {
+		t.Fatalf("flag should override the stack file version and keep other options: %#v", g)
+	}
+	if k := c.AddonOptions["kafka"]; k.ChartVersion != "29.0.0" {
+		t.Fatalf("unexpected kafka options: %#v", k)
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christk1/kstack/pkg/cluster"
+)
+
+// OriginDefault is the origin of settings no layer overrides. Other origins
+// name the file, environment variable or flag that supplied the value.
+const OriginDefault = "default"
+
+// addonOptionsKey is the Origins key recording which file supplied
+// Config.AddonOptions.
+const addonOptionsKey = "addons.options"
+
+// Origins maps a setting key (see Keys) to a human-readable description of
+// the layer that supplied its effective value.
+type Origins map[string]string
+
+// AddonOptions returns the origin of Config.AddonOptions, or "" if no file
+// declared per-addon options.
+func (o Origins) AddonOptions() string { return o[addonOptionsKey] }
+
+// Sources names the inputs that Load layers on top of the built-in defaults,
+// from lowest to highest precedence: user config file, project stack file,
+// environment variables, then flags.
+type Sources struct {
+	// UserFile is the user config file. Empty means UserConfigPath(); a
+	// missing file is skipped.
+	UserFile string
+	// StackFile is the project stack file. Empty means DefaultStackFile in
+	// the current directory if present. An explicitly named file must exist.
+	StackFile string
+	// Flags holds explicitly provided flag values keyed by setting key.
+	Flags map[string]string
+}
+
+// setting describes one layered configuration key. Keys double as flag
+// names and stack file keys.
+type setting struct {
+	key string
+	// env lists environment variables in precedence order (KSTACK_* first,
+	// then the legacy GO_CLOUD_* name for settings that predate kstack).
+	env []string
+	set func(c *Config, v string) error
+	get func(c Config) string
+}
+
+var settings = []setting{
+	{"provider", envNames("PROVIDER"), func(c *Config, v string) error { c.Provider = v; return nil }, func(c Config) string { return c.Provider }},
+	{"cluster", envNames("CLUSTER"), func(c *Config, v string) error { c.ClusterName = v; return nil }, func(c Config) string { return c.ClusterName }},
+	{"addons", envNames("ADDONS"), func(c *Config, v string) error { c.Addons = ParseAddonsCSV(v); return nil }, func(c Config) string { return strings.Join(c.Addons, ",") }},
+	{"namespace", envNames("NAMESPACE"), func(c *Config, v string) error { c.Namespace = v; return nil }, func(c Config) string { return c.Namespace }},
+	{"kubeconfig", envNames("KUBECONFIG"), func(c *Config, v string) error { c.Kubeconfig = v; return nil }, func(c Config) string { return c.Kubeconfig }},
+	{"context", envNames("CONTEXT"), func(c *Config, v string) error { c.KubeContext = v; return nil }, func(c Config) string { return c.KubeContext }},
+	{"helm", envNames("HELM"), func(c *Config, v string) error { c.HelmPath = v; return nil }, func(c Config) string { return c.HelmPath }},
+	{"k8s-version", envNames("K8S_VERSION"), func(c *Config, v string) error { c.K8sVersion = v; return nil }, func(c Config) string { return c.K8sVersion }},
+	{"timeout", envNames("TIMEOUT"), func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		c.Timeout = d
+		return nil
+	}, func(c Config) string { return c.Timeout.String() }},
+	{"verbose", envNames("VERBOSE"), func(c *Config, v string) error { c.Verbose = parseBool(v); return nil }, func(c Config) string { return strconv.FormatBool(c.Verbose) }},
+	{"debug", envNames("DEBUG"), func(c *Config, v string) error { c.Debug = parseBool(v); return nil }, func(c Config) string { return strconv.FormatBool(c.Debug) }},
+	{"registry", []string{"KSTACK_REGISTRY"}, func(c *Config, v string) error { c.Registry.Enabled = parseBool(v); return nil }, func(c Config) string { return strconv.FormatBool(c.Registry.Enabled) }},
+	{"registry.name", []string{"KSTACK_REGISTRY_NAME"}, func(c *Config, v string) error { c.Registry.Name = v; return nil }, func(c Config) string { return c.Registry.WithDefaults().Name }},
+	{"registry.port", []string{"KSTACK_REGISTRY_PORT"}, func(c *Config, v string) error {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.Registry.Port = p
+		return nil
+	}, func(c Config) string { return strconv.Itoa(c.Registry.WithDefaults().Port) }},
+	{"registry.keep", []string{"KSTACK_REGISTRY_KEEP"}, func(c *Config, v string) error { c.Registry.Keep = parseBool(v); return nil }, func(c Config) string { return strconv.FormatBool(c.Registry.Keep) }},
+	{"cache", []string{"KSTACK_CACHE"}, func(c *Config, v string) error { c.Cache.Enabled = parseBool(v); return nil }, func(c Config) string { return strconv.FormatBool(c.Cache.Enabled) }},
+	{"cache.registries", []string{"KSTACK_CACHE_REGISTRIES"}, func(c *Config, v string) error { c.Cache.Registries = ParseAddonsCSV(v); return nil }, func(c Config) string {
+		if len(c.Cache.Registries) == 0 {
+			return strings.Join(cluster.CacheRegistries(), ",")
+		}
+		return strings.Join(c.Cache.Registries, ",")
+	}},
+	{"preload-images", []string{"KSTACK_PRELOAD_IMAGES"}, func(c *Config, v string) error { c.PreloadImages = parseBool(v); return nil }, func(c Config) string { return strconv.FormatBool(c.PreloadImages) }},
+}
+
+func envNames(suffix string) []string {
+	return []string{"KSTACK_" + suffix, "GO_CLOUD_" + suffix}
+}
+
+func parseBool(v string) bool { return strings.EqualFold(v, "true") || v == "1" }
+
+// Keys returns the layered setting keys in display order.
+func Keys() []string {
+	out := make([]string, 0, len(settings))
+	for _, s := range settings {
+		out = append(out, s.key)
+	}
+	return out
+}
+
+// Get returns the string form of the setting key, or "" if unknown.
+func (c Config) Get(key string) string {
+	for _, s := range settings {
+		if s.key == key {
+			return s.get(c)
+		}
+	}
+	return ""
+}
+
+// UserConfigPath returns the user config file location:
+// $XDG_CONFIG_HOME/kstack/config.yaml, falling back to ~/.config/kstack.
+func UserConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "kstack", "config.yaml")
+}
+
+// Load resolves the effective configuration by layering, from lowest to
+// highest precedence: built-in defaults, the user config file, the project
+// stack file, KSTACK_* (and legacy GO_CLOUD_*) environment variables, and
+// explicitly provided flags. It returns the origin of every setting.
+func Load(src Sources) (Config, Origins, error) {
+	c := Defaults()
+	origins := Origins{}
+	for _, s := range settings {
+		origins[s.key] = OriginDefault
+	}
+
+	userFile := src.UserFile
+	if userFile == "" {
+		userFile = UserConfigPath()
+	}
+	if userFile != "" {
+		if _, err := os.Stat(userFile); err == nil {
+			var err error
+			if c, err = applyFile(c, origins, userFile, "user config"); err != nil {
+				return c, origins, err
+			}
+			// only the project stack file is reported as Config.StackFile
+			c.StackFile = ""
+		}
+	}
+
+	stackFile := src.StackFile
+	if stackFile == "" {
+		if _, err := os.Stat(DefaultStackFile); err == nil {
+			stackFile = DefaultStackFile
+		}
+	}
+	if stackFile != "" {
+		var err error
+		if c, err = applyFile(c, origins, stackFile, "stack file"); err != nil {
+			return c, origins, err
+		}
+	}
+
+	if err := applyEnv(&c, origins); err != nil {
+		return c, origins, err
+	}
+
+	for _, s := range settings {
+		v, ok := src.Flags[s.key]
+		if !ok {
+			continue
+		}
+		if err := s.set(&c, v); err != nil {
+			return c, origins, fmt.Errorf("invalid --%s %q: %w", s.key, v, err)
+		}
+		origins[s.key] = "flag --" + s.key
+	}
+	return c, origins, nil
+}
+
+// applyFile overlays a stack-format file and records the keys it set.
+func applyFile(c Config, origins Origins, path, kind string) (Config, error) {
+	s, err := LoadStackFile(path)
+	if err != nil {
+		return c, err
+	}
+	c, err = s.Apply(c)
+	if err != nil {
+		return c, err
+	}
+	for _, k := range s.keys() {
+		origins[k] = fmt.Sprintf("%s %s", kind, path)
+	}
+	if len(s.Addons) > 0 {
+		origins[addonOptionsKey] = fmt.Sprintf("%s %s", kind, path)
+	}
+	return c, nil
+}
+
+// applyEnv overlays environment variables and records their origins.
+// KSTACK_* variables take precedence over the legacy GO_CLOUD_* names.
+func applyEnv(c *Config, origins Origins) error {
+	var errs []error
+	for _, s := range settings {
+		for _, name := range s.env {
+			v := os.Getenv(name)
+			if v == "" {
+				continue
+			}
+			if err := s.set(c, v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s %q: %w", name, v, err))
+			} else if origins != nil {
+				origins[s.key] = "env " + name
+			}
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
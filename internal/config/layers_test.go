@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "user.yaml")
+	if err := os.WriteFile(user, []byte("provider: k3d\ncluster: from-user\nnamespace: user-ns\ntimeout: 1m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stack := filepath.Join(dir, "kstack.yaml")
+	if err := os.WriteFile(stack, []byte("cluster: from-stack\naddons: [kafka]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GO_CLOUD_CLUSTER", "from-legacy-env")
+	t.Setenv("KSTACK_NAMESPACE", "env-ns")
+	t.Setenv("GO_CLOUD_NAMESPACE", "legacy-ns")
+
+	c, origins, err := Load(Sources{UserFile: user, StackFile: stack, Flags: map[string]string{"cluster": "from-flag"}})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	checks := []struct {
+		key, value, origin string
+	}{
+		{"provider", "k3d", "user config " + user},
+		{"cluster", "from-flag", "flag --cluster"},
+		{"addons", "kafka", "stack file " + stack},
+		{"namespace", "env-ns", "env KSTACK_NAMESPACE"},
+		{"timeout", "1m0s", "user config " + user},
+		{"helm", "helm", OriginDefault},
+	}
+	for _, ck := range checks {
+		if got := c.Get(ck.key); got != ck.value {
+			t.Errorf("%s = %q, want %q", ck.key, got, ck.value)
+		}
+		if got := origins[ck.key]; got != ck.origin {
+			t.Errorf("origin of %s = %q, want %q", ck.key, got, ck.origin)
+		}
+	}
+	if c.StackFile != stack {
+		t.Errorf("StackFile = %q, want %q", c.StackFile, stack)
+	}
+
+	// without the flag, the legacy env var beats the stack file
+	c, origins, err = Load(Sources{UserFile: user, StackFile: stack})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.ClusterName != "from-legacy-env" || origins["cluster"] != "env GO_CLOUD_CLUSTER" {
+		t.Fatalf("unexpected cluster %q from %q", c.ClusterName, origins["cluster"])
+	}
+}
+
+func TestLoad_MissingUserFileSkipped_InvalidValuesReported(t *testing.T) {
+	dir := t.TempDir()
+	c, _, err := Load(Sources{UserFile: filepath.Join(dir, "none.yaml")})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(c, Defaults()) {
+		t.Fatalf("expected defaults, got %#v", c)
+	}
+	if c.Timeout != 10*time.Minute {
+		t.Fatalf("unexpected timeout %v", c.Timeout)
+	}
+
+	t.Setenv("KSTACK_TIMEOUT", "later")
+	if _, _, err := Load(Sources{UserFile: filepath.Join(dir, "none.yaml")}); err == nil || !strings.Contains(err.Error(), "KSTACK_TIMEOUT") {
+		t.Fatalf("expected KSTACK_TIMEOUT error, got %v", err)
+	}
+	if _, _, err := Load(Sources{UserFile: filepath.Join(dir, "none.yaml"), StackFile: filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Fatalf("expected error for explicit missing stack file")
+	}
+}
+
+func TestLoad_RegistryCacheAndPreloadOrigins(t *testing.T) {
+	dir := t.TempDir()
+	stack := filepath.Join(dir, "kstack.yaml")
+	if err := os.WriteFile(stack, []byte("registry:\n  enabled: true\n  port: 5002\ncache:\n  enabled: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KSTACK_PRELOAD_IMAGES", "true")
+
+	c, origins, err := Load(Sources{UserFile: filepath.Join(dir, "none.yaml"), StackFile: stack})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	checks := []struct {
+		key, value, origin string
+	}{
+		{"registry", "true", "stack file " + stack},
+		{"registry.name", "kstack-registry", "stack file " + stack},
+		{"registry.port", "5002", "stack file " + stack},
+		{"cache", "true", "stack file " + stack},
+		{"cache.registries", "docker.io,ghcr.io,quay.io", "stack file " + stack},
+		{"preload-images", "true", "env KSTACK_PRELOAD_IMAGES"},
+	}
+	for _, ck := range checks {
+		if !slices.Contains(Keys(), ck.key) {
+			t.Errorf("%s is not a setting key", ck.key)
+		}
+		if got := c.Get(ck.key); got != ck.value {
+			t.Errorf("%s = %q, want %q", ck.key, got, ck.value)
+		}
+		if got := origins[ck.key]; got != ck.origin {
+			t.Errorf("origin of %s = %q, want %q", ck.key, got, ck.origin)
+		}
+	}
+
+	t.Setenv("KSTACK_REGISTRY_PORT", "high")
+	if _, _, err := Load(Sources{UserFile: filepath.Join(dir, "none.yaml")}); err == nil || !strings.Contains(err.Error(), "KSTACK_REGISTRY_PORT") {
+		t.Fatalf("expected KSTACK_REGISTRY_PORT error, got %v", err)
+	}
+}
+
+func TestUserConfigPath_XDG(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got, want := UserConfigPath(), filepath.Join("/xdg", "kstack", "config.yaml"); got != want {
+		t.Fatalf("UserConfigPath() = %q, want %q", got, want)
+	}
+}
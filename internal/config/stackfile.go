@@ -0,0 +1,287 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/christk1/kstack/pkg/cluster"
+)
+
+// DefaultStackFile is the conventional name of a project stack file.
+const DefaultStackFile = "kstack.yaml"
+
+// AddonOptions holds per-addon install settings declared in a stack file.
+type AddonOptions struct {
+	// Values are additional values files passed to Helm after the addon's
+	// built-in values. Relative paths are resolved against the stack file.
+	Values []string `yaml:"values,omitempty"`
+	// Set are `key=val` pairs passed to Helm via --set.
+	Set []string `yaml:"set,omitempty"`
+	// HA selects the HA variant of the addon where supported (e.g. postgres).
+	HA bool `yaml:"ha,omitempty"`
+	// ChartVersion overrides the chart version pinned by the addon.
+	ChartVersion string `yaml:"chartVersion,omitempty"`
+}
+
+// StackAddon is a single entry of the `addons` list in a stack file. It can
+// be written either as a plain name or as a mapping with per-addon options.
+type StackAddon struct {
+	Name         string `yaml:"name"`
+	AddonOptions `yaml:",inline"`
+}
+
+// UnmarshalYAML accepts both `- prometheus` and `- name: prometheus` forms.
+func (a *StackAddon) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		a.Name = n.Value
+		return nil
+	}
+	type plain StackAddon
+	var p plain
+	if err := decodeStrict(n, &p); err != nil {
+		return err
+	}
+	*a = StackAddon(p)
+	return nil
+}
+
+// StackFile is the on-disk representation of a kstack.yaml file.
+//
+//	provider: kind
+//	cluster: dev
+//	addons:
+//	  - prometheus
+//	  - name: postgres
+//	    ha: true
+//	    chartVersion: 15.5.38
+//	    values: [./postgres.yaml]
+//	    set: [auth.postgresPassword=dev]
+//	kind:
+//	  workers: 2
+//	  portMappings: [{containerPort: 30080, hostPort: 8080}]
+//	registry:
+//	  enabled: true
+//	  port: 5001
+//	cache:
+//	  enabled: true
+//	preloadImages: true
+type StackFile struct {
+	Provider   string       `yaml:"provider,omitempty"`
+	Cluster    string       `yaml:"cluster,omitempty"`
+	Namespace  string       `yaml:"namespace,omitempty"`
+	Kubeconfig string       `yaml:"kubeconfig,omitempty"`
+	Context    string       `yaml:"context,omitempty"`
+	Helm       string       `yaml:"helm,omitempty"`
+	Timeout    string       `yaml:"timeout,omitempty"`
+	K8sVersion string       `yaml:"k8sVersion,omitempty"`
+	Verbose    *bool        `yaml:"verbose,omitempty"`
+	Debug      *bool        `yaml:"debug,omitempty"`
+	Addons     []StackAddon `yaml:"addons,omitempty"`
+	// Providers holds the sections named after a provider (e.g. `kind:`),
+	// which that provider decodes into its settings; see cluster.Settings.
+	Providers map[string]yaml.Node `yaml:",inline"`
+	// Registry provisions a local registry; see cluster.LocalRegistry.
+	Registry *cluster.LocalRegistry `yaml:"registry,omitempty"`
+	// Cache runs pull-through registry caches; see cluster.Cache.
+	Cache *cluster.Cache `yaml:"cache,omitempty"`
+	// PreloadImages loads the addon images into the nodes before installing.
+	PreloadImages *bool `yaml:"preloadImages,omitempty"`
+
+	// path is the file the stack was loaded from; used to resolve relative
+	// paths and to prefix error messages.
+	path string
+	// settings are the decoded Providers sections.
+	settings map[string]cluster.Settings
+}
+
+// LoadStackFile reads and parses a stack file. Unknown keys are rejected so
+// that typos surface as errors instead of being silently ignored.
+func LoadStackFile(path string) (*StackFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read stack file: %w", err)
+	}
+	var s StackFile
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse stack file %s: %w", path, err)
+	}
+	s.path = path
+	if err := s.decodeProviders(); err != nil {
+		return nil, fmt.Errorf("parse stack file %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// decodeProviders decodes every provider section with the settings type
+// of that provider and anchors its relative paths at the stack file. Keys
+// that name no provider with settings are unknown.
+func (s *StackFile) decodeProviders() error {
+	for _, name := range slices.Sorted(maps.Keys(s.Providers)) {
+		n := s.Providers[name]
+		spec, err := cluster.Lookup(name)
+		if err != nil || spec.NewSettings == nil {
+			return fmt.Errorf("line %d: field %s not found in type config.StackFile", n.Line, name)
+		}
+		settings := spec.NewSettings()
+		if err := decodeStrict(&n, settings); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		settings.ResolvePaths(s.resolve)
+		if s.settings == nil {
+			s.settings = map[string]cluster.Settings{}
+		}
+		s.settings[name] = settings
+	}
+	return nil
+}
+
+// Apply overlays the stack file settings onto base. Relative values file
+// paths are resolved against the directory containing the stack file.
+func (s *StackFile) Apply(base Config) (Config, error) {
+	if s.Provider != "" {
+		base.Provider = s.Provider
+	}
+	if s.Cluster != "" {
+		base.ClusterName = s.Cluster
+	}
+	if s.Namespace != "" {
+		base.Namespace = s.Namespace
+	}
+	if s.Kubeconfig != "" {
+		base.Kubeconfig = s.resolve(s.Kubeconfig)
+	}
+	if s.Context != "" {
+		base.KubeContext = s.Context
+	}
+	if s.Helm != "" {
+		base.HelmPath = s.Helm
+	}
+	if s.Timeout != "" {
+		d, err := time.ParseDuration(s.Timeout)
+		if err != nil {
+			return base, fmt.Errorf("%s: invalid timeout %q: %w", s.path, s.Timeout, err)
+		}
+		base.Timeout = d
+	}
+	if s.K8sVersion != "" {
+		base.K8sVersion = s.K8sVersion
+	}
+	if s.Verbose != nil {
+		base.Verbose = *s.Verbose
+	}
+	if s.Debug != nil {
+		base.Debug = *s.Debug
+	}
+	if len(s.Addons) > 0 {
+		base.Addons = make([]string, 0, len(s.Addons))
+		base.AddonOptions = make(map[string]AddonOptions, len(s.Addons))
+		for _, a := range s.Addons {
+			name := strings.TrimSpace(a.Name)
+			base.Addons = append(base.Addons, name)
+			opts := a.AddonOptions
+			if len(opts.Values) > 0 {
+				resolved := make([]string, 0, len(opts.Values))
+				for _, v := range opts.Values {
+					resolved = append(resolved, s.resolve(v))
+				}
+				opts.Values = resolved
+			}
+			base.AddonOptions[name] = opts
+		}
+	}
+	for name, settings := range s.settings {
+		if base.Settings == nil {
+			base.Settings = map[string]cluster.Settings{}
+		}
+		base.Settings[name] = settings
+	}
+	if s.Registry != nil {
+		base.Registry = *s.Registry
+	}
+	if s.Cache != nil {
+		base.Cache = *s.Cache
+	}
+	if s.PreloadImages != nil {
+		base.PreloadImages = *s.PreloadImages
+	}
+	base.StackFile = s.path
+	return base, nil
+}
+
+// keys returns the setting keys (see Keys) this file sets.
+func (s *StackFile) keys() []string {
+	var out []string
+	for _, kv := range []struct {
+		key string
+		set bool
+	}{
+		{"provider", s.Provider != ""},
+		{"cluster", s.Cluster != ""},
+		{"addons", len(s.Addons) > 0},
+		{"namespace", s.Namespace != ""},
+		{"kubeconfig", s.Kubeconfig != ""},
+		{"context", s.Context != ""},
+		{"helm", s.Helm != ""},
+		{"k8s-version", s.K8sVersion != ""},
+		{"timeout", s.Timeout != ""},
+		{"verbose", s.Verbose != nil},
+		{"debug", s.Debug != nil},
+		// the registry and cache sections replace every field at once
+		{"registry", s.Registry != nil},
+		{"registry.name", s.Registry != nil},
+		{"registry.port", s.Registry != nil},
+		{"registry.keep", s.Registry != nil},
+		{"cache", s.Cache != nil},
+		{"cache.registries", s.Cache != nil},
+		{"preload-images", s.PreloadImages != nil},
+	} {
+		if kv.set {
+			out = append(out, kv.key)
+		}
+	}
+	return out
+}
+
+// resolve returns p relative to the stack file directory unless it is
+// absolute or empty.
+func (s *StackFile) resolve(p string) string {
+	if p == "" || filepath.IsAbs(p) || s.path == "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(s.path), p)
+}
+
+// FromFile loads the stack file at path and overlays it onto base.
+func FromFile(base Config, path string) (Config, error) {
+	s, err := LoadStackFile(path)
+	if err != nil {
+		return base, err
+	}
+	return s.Apply(base)
+}
+
+// decodeStrict decodes a YAML node while rejecting unknown fields.
+func decodeStrict(n *yaml.Node, out any) error {
+	b, err := yaml.Marshal(n)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("line %d: %w", n.Line, err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christk1/kstack/pkg/cluster"
+)
+
+func writeStackFile(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	p := filepath.Join(dir, DefaultStackFile)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatalf("write stack file: %v", err)
+	}
+	return p
+}
+
+func TestFromFile_Overlay(t *testing.T) {
+	p := writeStackFile(t, `provider: k3d
+cluster: team
+timeout: 5m
+addons:
+  - prometheus
+  - name: postgres
+    ha: true
+    values: [pg.yaml]
+    set: [auth.postgresPassword=dev]
+    chartVersion: 15.5.38
+`)
+	if err := os.WriteFile(filepath.Join(filepath.Dir(p), "pg.yaml"), []byte("a: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FromFile(Defaults(), p)
+	if err != nil {
+		t.Fatalf("FromFile: %v", err)
+	}
+	if got.Provider != "k3d" || got.ClusterName != "team" || got.Timeout != 5*time.Minute || got.StackFile != p {
+		t.Fatalf("unexpected overlay: %#v", got)
+	}
+	if !reflect.DeepEqual(got.Addons, []string{"prometheus", "postgres"}) {
+		t.Fatalf("unexpected addons: %#v", got.Addons)
+	}
+	pg := got.AddonOptions["postgres"]
+	if !pg.HA || !reflect.DeepEqual(pg.Set, []string{"auth.postgresPassword=dev"}) || pg.ChartVersion != "15.5.38" {
+		t.Fatalf("unexpected postgres options: %#v", pg)
+	}
+	if want := filepath.Join(filepath.Dir(p), "pg.yaml"); !reflect.DeepEqual(pg.Values, []string{want}) {
+		t.Fatalf("values not resolved against stack dir: %#v", pg.Values)
+	}
+	if err := got.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestLoadStackFile_UnknownField(t *testing.T) {
+	p := writeStackFile(t, "provider: kind\nclustr: typo\n")
+	if _, err := LoadStackFile(p); err == nil || !strings.Contains(err.Error(), "clustr") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+	p = writeStackFile(t, "addons:\n  - name: kafka\n    valuez: [x.yaml]\n")
+	if _, err := LoadStackFile(p); err == nil || !strings.Contains(err.Error(), "valuez") {
+		t.Fatalf("expected unknown addon field error, got %v", err)
+	}
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	p := writeStackFile(t, `provider: docker-desktop
+cluster: Bad_Name
+addons:
+  - kafka
+  - kafka
+  - name: postgres
+    values: [missing.yaml]
+    set: [novalue]
+`)
+	c, err := FromFile(Defaults(), p)
+	if err != nil {
+		t.Fatalf("FromFile: %v", err)
+	}
+	err = c.Validate()
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	for _, want := range []string{p, "unknown provider", "invalid cluster name", "more than once", "missing.yaml", "novalue"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in error, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestFromFile_InvalidTimeout(t *testing.T) {
+	p := writeStackFile(t, "timeout: soon\n")
+	if _, err := FromFile(Defaults(), p); err == nil {
+		t.Fatalf("expected invalid timeout error")
+	}
+}
+
+func TestFromFile_KindOptions(t *testing.T) {
+	p := writeStackFile(t, `cluster: multi
+kind:
+  image: kindest/node:v1.30.0
+  workers: 2
+  mounts:
+    - hostPath: data
+      containerPath: /data
+`)
+	c, err := FromFile(Defaults(), p)
+	if err != nil {
+		t.Fatalf("FromFile: %v", err)
+	}
+	kind, ok := c.Settings["kind"].(*cluster.KindOptions)
+	if !ok || kind.Workers != 2 || kind.Image != "kindest/node:v1.30.0" {
+		t.Fatalf("unexpected kind options: %#v", c.Settings["kind"])
+	}
+	if want := filepath.Join(filepath.Dir(p), "data"); kind.Mounts[0].HostPath != want {
+		t.Fatalf("mount host path = %q, want %q", kind.Mounts[0].HostPath, want)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	c.Provider = "k3d"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "kind settings are only valid with provider kind") {
+		t.Fatalf("expected error for kind settings with provider k3d, got %v", err)
+	}
+}
+
+func TestStackFile_ApplyTwiceResolvesPathsOnce(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join("sub", DefaultStackFile)
+	if err := os.WriteFile(p, []byte("kind:\n  config: kind.yaml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadStackFile(p)
+	if err != nil {
+		t.Fatalf("LoadStackFile: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		c, err := s.Apply(Defaults())
+		if err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		if got := c.ProviderSettings().ConfigPath(); got != filepath.Join("sub", "kind.yaml") {
+			t.Fatalf("Apply #%d: kind config = %q, want sub/kind.yaml", i+1, got)
+		}
+	}
+}
+
+func TestFromFile_ProviderSections(t *testing.T) {
+	// only providers that take settings have a section
+	for _, section := range []string{"minikube", "existing", "kindd"} {
+		p := writeStackFile(t, section+":\n  workers: 2\n")
+		if _, err := FromFile(Defaults(), p); err == nil || !strings.Contains(err.Error(), "field "+section+" not found") {
+			t.Fatalf("expected %s to be rejected, got %v", section, err)
+		}
+	}
+	p := writeStackFile(t, "kind:\n  wrkers: 2\n")
+	if _, err := FromFile(Defaults(), p); err == nil || !strings.Contains(err.Error(), "wrkers") {
+		t.Fatalf("expected an unknown kind field to be rejected, got %v", err)
+	}
+}
+
+func TestFromFile_K3dOptions(t *testing.T) {
+	p := writeStackFile(t, `provider: k3d
+k3d:
+  agents: 2
+  disableTraefik: true
+  volumes:
+    - volume: data:/data
+`)
+	c, err := FromFile(Defaults(), p)
+	if err != nil {
+		t.Fatalf("FromFile: %v", err)
+	}
+	k3d, ok := c.ProviderSettings().(*cluster.K3dOptions)
+	if !ok || k3d.Agents != 2 || !k3d.DisableTraefik {
+		t.Fatalf("unexpected k3d options: %#v", c.ProviderSettings())
+	}
+	if want := filepath.Join(filepath.Dir(p), "data") + ":/data"; k3d.Volumes[0].Volume != want {
+		t.Fatalf("volume = %q, want %q", k3d.Volumes[0].Volume, want)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidate_K8sVersion(t *testing.T) {
+	c := Defaults()
+	c.K8sVersion = "1.30"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	c.Provider = "minikube"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "exact Kubernetes patch version") {
+		t.Fatalf("expected minikube to require a patch version, got %v", err)
+	}
+	c.Provider = "kind"
+	c.K8sVersion = "latest"
+	if err := c.Validate(); err == nil {
+		t.Fatalf("expected invalid version error")
+	}
+	c.K8sVersion = "1.30"
+	c.Settings = map[string]cluster.Settings{"kind": &cluster.KindOptions{Image: "kindest/node:v1.29.2"}}
+	if err := c.Validate(); err == nil {
+		t.Fatalf("expected error combining k8s-version with an explicit image")
+	}
+}
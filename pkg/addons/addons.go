@@ -8,7 +8,14 @@ import (
 // Addon represents a Helm-installable addon.
 type Addon interface {
 	Name() string
+	// Chart is a repository chart (repo/name), an OCI reference
+	// (oci://host/path/name) or a local chart path.
 	Chart() string
+	// ChartVersion is the chart version installed by default, or "" for the
+	// newest one (e.g. for local charts).
+	ChartVersion() string
+	// RepoName and RepoURL locate the chart repository; they are empty for
+	// OCI and local charts, which need no repository.
 	RepoName() string
 	RepoURL() string
 	Namespace() string
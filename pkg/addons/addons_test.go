@@ -2,6 +2,7 @@ package addons_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	addons "github.com/christk1/kstack/pkg/addons"
@@ -60,3 +61,13 @@ func TestRegistry_Basics(t *testing.T) {
 		t.Fatalf("expected error for unknown addon")
 	}
 }
+
+func TestBuiltinAddons_PinChartVersions(t *testing.T) {
+	for _, name := range addons.List() {
+		a, _ := addons.Get(name)
+		local := strings.HasPrefix(a.Chart(), "./")
+		if got := a.ChartVersion(); (got == "") != local {
+			t.Fatalf("addon %s: ChartVersion() = %q; repository charts must be pinned, local charts not", name, got)
+		}
+	}
+}
@@ -15,11 +15,12 @@ var fs embed.FS
 
 type grafanaAddon struct{}
 
-func (g *grafanaAddon) Name() string      { return "grafana" }
-func (g *grafanaAddon) Chart() string     { return "grafana/grafana" }
-func (g *grafanaAddon) RepoName() string  { return "grafana" }
-func (g *grafanaAddon) RepoURL() string   { return "https://grafana.github.io/helm-charts" }
-func (g *grafanaAddon) Namespace() string { return "monitoring" }
+func (g *grafanaAddon) Name() string         { return "grafana" }
+func (g *grafanaAddon) Chart() string        { return "grafana/grafana" }
+func (g *grafanaAddon) ChartVersion() string { return "8.5.1" }
+func (g *grafanaAddon) RepoName() string     { return "grafana" }
+func (g *grafanaAddon) RepoURL() string      { return "https://grafana.github.io/helm-charts" }
+func (g *grafanaAddon) Namespace() string    { return "monitoring" }
 func (g *grafanaAddon) ValuesFiles() []string {
 	// Read base values.yaml from embed FS
 	b, err := fs.ReadFile("values.yaml")
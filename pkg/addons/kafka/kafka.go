@@ -12,11 +12,12 @@ var valuesFS embed.FS
 
 type kafkaAddon struct{}
 
-func (k *kafkaAddon) Name() string      { return "kafka" }
-func (k *kafkaAddon) Chart() string     { return "bitnami/kafka" }
-func (k *kafkaAddon) RepoName() string  { return "bitnami" }
-func (k *kafkaAddon) RepoURL() string   { return "https://charts.bitnami.com/bitnami" }
-func (k *kafkaAddon) Namespace() string { return "kafka" }
+func (k *kafkaAddon) Name() string         { return "kafka" }
+func (k *kafkaAddon) Chart() string        { return "oci://registry-1.docker.io/bitnamicharts/kafka" }
+func (k *kafkaAddon) ChartVersion() string { return "30.1.0" }
+func (k *kafkaAddon) RepoName() string     { return "" }
+func (k *kafkaAddon) RepoURL() string      { return "" }
+func (k *kafkaAddon) Namespace() string    { return "kafka" }
 func (k *kafkaAddon) ValuesFiles() []string {
 	b, _ := valuesFS.ReadFile("values.yaml")
 	f, _ := os.CreateTemp("", "kstack-kafka-values-")
@@ -2,13 +2,14 @@ package kafka
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
 func TestKafkaAddon_Basics(t *testing.T) {
 	a := &kafkaAddon{}
-	if a.Name() != "kafka" || a.Chart() == "" || a.RepoName() == "" || a.RepoURL() == "" {
-		t.Fatalf("kafka addon fields invalid")
+	if a.Name() != "kafka" || !strings.HasPrefix(a.Chart(), "oci://") || a.RepoName() != "" || a.RepoURL() != "" {
+		t.Fatalf("kafka addon should install an OCI chart without a repository")
 	}
 	if a.Namespace() != "kafka" {
 		t.Fatalf("unexpected namespace: %s", a.Namespace())
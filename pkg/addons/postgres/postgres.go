@@ -12,11 +12,12 @@ var valuesFS embed.FS
 
 type postgresAddon struct{}
 
-func (p *postgresAddon) Name() string      { return "postgres" }
-func (p *postgresAddon) Chart() string     { return "bitnami/postgresql" }
-func (p *postgresAddon) RepoName() string  { return "bitnami" }
-func (p *postgresAddon) RepoURL() string   { return "https://charts.bitnami.com/bitnami" }
-func (p *postgresAddon) Namespace() string { return "postgres" }
+func (p *postgresAddon) Name() string         { return "postgres" }
+func (p *postgresAddon) Chart() string        { return "oci://registry-1.docker.io/bitnamicharts/postgresql" }
+func (p *postgresAddon) ChartVersion() string { return "15.5.38" }
+func (p *postgresAddon) RepoName() string     { return "" }
+func (p *postgresAddon) RepoURL() string      { return "" }
+func (p *postgresAddon) Namespace() string    { return "postgres" }
 func (p *postgresAddon) ValuesFiles() []string {
 	b, _ := valuesFS.ReadFile("values.yaml")
 	f, _ := os.CreateTemp("", "kstack-postgres-values-")
@@ -28,6 +29,13 @@ func (p *postgresAddon) ValuesFiles() []string {
 	return nil
 }
 
+// HAChart and HAChartVersion select the Bitnami postgresql-ha chart
+// installed for the HA variant.
+const (
+	HAChart        = "oci://registry-1.docker.io/bitnamicharts/postgresql-ha"
+	HAChartVersion = "14.2.16"
+)
+
 // HAValuesFile returns a temporary file path containing the HA chart values
 // to be used with the Bitnami postgresql-ha chart. The caller is responsible
 // for removing the returned file when no longer needed.
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -10,8 +11,8 @@ func TestPostgresAddon_Basics(t *testing.T) {
 	if a.Name() != "postgres" {
 		t.Fatalf("unexpected name: %s", a.Name())
 	}
-	if a.Chart() == "" || a.RepoName() == "" || a.RepoURL() == "" {
-		t.Fatalf("chart/repo fields should be set")
+	if !strings.HasPrefix(a.Chart(), "oci://") || !strings.HasPrefix(HAChart, "oci://") || a.RepoName() != "" || a.RepoURL() != "" {
+		t.Fatalf("postgres should install OCI charts without a repository")
 	}
 	if a.Namespace() != "postgres" {
 		t.Fatalf("unexpected namespace: %s", a.Namespace())
@@ -8,9 +8,10 @@ import (
 
 type prometheusAddon struct{}
 
-func (p *prometheusAddon) Name() string     { return "prometheus" }
-func (p *prometheusAddon) Chart() string    { return "prometheus-community/prometheus" }
-func (p *prometheusAddon) RepoName() string { return "prometheus-community" }
+func (p *prometheusAddon) Name() string         { return "prometheus" }
+func (p *prometheusAddon) Chart() string        { return "prometheus-community/prometheus" }
+func (p *prometheusAddon) ChartVersion() string { return "25.27.0" }
+func (p *prometheusAddon) RepoName() string     { return "prometheus-community" }
 func (p *prometheusAddon) RepoURL() string {
 	return "https://prometheus-community.github.io/helm-charts"
 }
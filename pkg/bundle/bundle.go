@@ -0,0 +1,231 @@
+// Package bundle packages everything `kstack up` downloads — chart
+// archives, merged values and container images — into a single tarball so
+// that a stack can be brought up without network access.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// Version is the bundle format version written to manifests.
+const Version = 1
+
+const (
+	// ManifestFile describes the bundle contents.
+	ManifestFile = "manifest.json"
+	// ImagesFile is the `docker save` archive of every bundled image.
+	ImagesFile = "images.tar"
+)
+
+// Manifest describes the contents of a bundle. Paths are relative to the
+// bundle root.
+type Manifest struct {
+	Version    int       `json:"version"`
+	Created    time.Time `json:"created"`
+	Provider   string    `json:"provider"`
+	K8sVersion string    `json:"k8sVersion,omitempty"`
+	// NodeImages are the provider's node image followed by its helper images.
+	NodeImages []string `json:"nodeImages,omitempty"`
+	Addons     []Addon  `json:"addons"`
+
+	// dir is the directory the bundle was extracted to, if any.
+	dir string
+}
+
+// Addon is one addon packaged in a bundle.
+type Addon struct {
+	Name string `json:"name"`
+	// Chart is the chart reference the archive was created from.
+	Chart string `json:"chart"`
+	// Version is the chart version the archive was pulled at, "" for the
+	// newest at the time.
+	Version string `json:"version,omitempty"`
+	// Archive is the packaged chart.
+	Archive string `json:"archive"`
+	// Values is the merged values file the chart is installed with.
+	Values string   `json:"values"`
+	Images []string `json:"images,omitempty"`
+}
+
+// Images returns every image in the bundle except the node images.
+func (m *Manifest) Images() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, a := range m.Addons {
+		for _, img := range a.Images {
+			if !seen[img] {
+				seen[img] = true
+				out = append(out, img)
+			}
+		}
+	}
+	return out
+}
+
+// Addon returns the bundled addon name installed from chart, with its paths
+// resolved against the directory the bundle was loaded from.
+func (m *Manifest) Addon(name, chart string) (Addon, bool) {
+	for _, a := range m.Addons {
+		if a.Name == name && a.Chart == chart {
+			a.Archive = filepath.Join(m.dir, a.Archive)
+			a.Values = filepath.Join(m.dir, a.Values)
+			return a, true
+		}
+	}
+	return Addon{}, false
+}
+
+// Dir is where `kstack bundle load` keeps the active bundle.
+func Dir() string { return filepath.Join(utils.StateDir(), "bundle") }
+
+// Active returns the manifest of the loaded bundle, or nil if none is loaded.
+func Active() (*Manifest, error) {
+	m, err := ReadManifest(Dir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return m, err
+}
+
+// WriteManifest stores m in dir.
+func WriteManifest(dir string, m *Manifest) error {
+	m.Version = Version
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFile), append(b, '\n'), 0o644)
+}
+
+// ReadManifest reads the manifest of the bundle extracted to dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parse bundle manifest: %w", err)
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d (this kstack reads version %d)", m.Version, Version)
+	}
+	m.dir = dir
+	return &m, nil
+}
+
+// Pack writes the contents of dir to a gzip-compressed tarball at out.
+func Pack(dir, out string) (err error) {
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("create bundle: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	return gz.Close()
+}
+
+// Unpack extracts the tarball at archive into dest, rejecting entries that
+// would escape it.
+func Unpack(archive, dest string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("open bundle: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("read bundle %s: %w", archive, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read bundle %s: %w", archive, err)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("bundle entry %q escapes the bundle directory", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return fmt.Errorf("extract %s: %w", hdr.Name, err)
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+		default:
+			utils.Debug("skipping bundle entry %s of type %c", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
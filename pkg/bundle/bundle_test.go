@@ -0,0 +1,71 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackUnpackManifest(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "charts", "prometheus"), 0o755)
+	os.WriteFile(filepath.Join(src, "charts", "prometheus", "prometheus-25.0.0.tgz"), []byte("chart"), 0o644)
+	m := &Manifest{Provider: "kind", NodeImages: []string{"kindest/node:v1.30.0"}, Addons: []Addon{
+		{Name: "prometheus", Chart: "prometheus-community/prometheus", Archive: "charts/prometheus/prometheus-25.0.0.tgz", Values: "values/prometheus.yaml", Images: []string{"a:1", "b:1"}},
+		{Name: "grafana", Chart: "grafana/grafana", Images: []string{"b:1", "c:1"}},
+	}}
+	if err := WriteManifest(src, m); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	out := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := Pack(src, out); err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	dest := t.TempDir()
+	if err := Unpack(out, dest); err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dest, "charts", "prometheus", "prometheus-25.0.0.tgz")); err != nil || string(b) != "chart" {
+		t.Fatalf("chart not extracted: %q, %v", b, err)
+	}
+	got, err := ReadManifest(dest)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if !reflect.DeepEqual(got.Images(), []string{"a:1", "b:1", "c:1"}) {
+		t.Fatalf("Images = %v", got.Images())
+	}
+	a, ok := got.Addon("prometheus", "prometheus-community/prometheus")
+	if !ok || a.Archive != filepath.Join(dest, "charts", "prometheus", "prometheus-25.0.0.tgz") {
+		t.Fatalf("Addon = %+v, %v", a, ok)
+	}
+	if _, ok := got.Addon("postgres", "bitnami/postgresql"); ok {
+		t.Fatalf("unexpected addon in bundle")
+	}
+}
+
+func TestUnpack_RejectsEscapingEntries(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "evil.tar.gz")
+	f, _ := os.Create(out)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	gz.Close()
+	f.Close()
+	if err := Unpack(out, t.TempDir()); err == nil || !strings.Contains(err.Error(), "escapes") {
+		t.Fatalf("expected escape error, got %v", err)
+	}
+}
+
+func TestActive_NoneLoaded(t *testing.T) {
+	t.Setenv("KSTACK_HOME", t.TempDir())
+	if m, err := Active(); m != nil || err != nil {
+		t.Fatalf("Active = %v, %v", m, err)
+	}
+}
@@ -0,0 +1,38 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// SaveImages writes images from the local Docker daemon to path with
+// `docker save`.
+func SaveImages(ctx context.Context, images []string, path string, dryRun bool) error {
+	args := append([]string{"save", "-o", path}, images...)
+	if dryRun {
+		utils.Info("DRY-RUN: docker %s", strings.Join(args, " "))
+		return nil
+	}
+	utils.Debug("running: docker %s", strings.Join(args, " "))
+	out, err := utils.Command(ctx, "docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker save failed: %w: %s", err, string(out))
+	}
+	return nil
+}
+
+// LoadImages imports a `docker save` archive into the local Docker daemon.
+func LoadImages(ctx context.Context, path string, dryRun bool) error {
+	if dryRun {
+		utils.Info("DRY-RUN: docker load -i %s", path)
+		return nil
+	}
+	out, err := utils.Command(ctx, "docker", "load", "-i", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker load failed: %w: %s", err, string(out))
+	}
+	return nil
+}
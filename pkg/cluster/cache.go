@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// cacheLabel marks pull-through cache containers with the registry they
+// proxy. Caches are shared by all clusters and outlive them.
+const cacheLabel = "dev.kstack.cache"
+
+// cacheUpstreams maps the registries kstack can cache to their upstream URLs.
+var cacheUpstreams = map[string]string{
+	"docker.io": "https://registry-1.docker.io",
+	"ghcr.io":   "https://ghcr.io",
+	"quay.io":   "https://quay.io",
+}
+
+// CacheRegistries returns the registries a pull-through cache can be run
+// for, sorted.
+func CacheRegistries() []string {
+	out := make([]string, 0, len(cacheUpstreams))
+	for r := range cacheUpstreams {
+		out = append(out, r)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Cache runs pull-through caches for public registries as local containers.
+// Their data lives in Docker volumes, so recreated clusters pull cached
+// images instead of going to the upstream again.
+type Cache struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Registries to cache (default: all of CacheRegistries).
+	Registries []string `yaml:"registries,omitempty"`
+}
+
+// registries returns the configured registries or the defaults.
+func (c Cache) registries() []string {
+	if len(c.Registries) == 0 {
+		return CacheRegistries()
+	}
+	return c.Registries
+}
+
+// Validate checks that every registry can be cached.
+func (c Cache) Validate() error {
+	var errs []error
+	for _, r := range c.Registries {
+		if _, ok := cacheUpstreams[r]; !ok {
+			errs = append(errs, fmt.Errorf("cache.registries: unsupported registry %q (expected one of: %s)", r, strings.Join(CacheRegistries(), ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CacheContainer is the name of the cache container (and its volume) for
+// registry, e.g. kstack-cache-docker-io.
+func CacheContainer(registry string) string {
+	return "kstack-cache-" + strings.ReplaceAll(registry, ".", "-")
+}
+
+// mirrors returns the containerd mirrors pointing at the caches.
+func (c Cache) mirrors() []mirror {
+	var out []mirror
+	for _, r := range c.registries() {
+		out = append(out, mirror{Registry: r, Container: CacheContainer(r), Server: cacheUpstreams[r]})
+	}
+	return out
+}
+
+// containers returns the names of the cache containers.
+func (c Cache) containers() []string {
+	var out []string
+	for _, r := range c.registries() {
+		out = append(out, CacheContainer(r))
+	}
+	return out
+}
+
+// EnsureCaches starts the cache containers that are not running yet.
+func EnsureCaches(ctx context.Context, c Cache, dryRun bool) error {
+	for _, r := range c.registries() {
+		name := CacheContainer(r)
+		args := []string{"run", "-d", "--restart=always", "--name", name,
+			"-v", name + ":/var/lib/registry",
+			"-e", "REGISTRY_PROXY_REMOTEURL=" + cacheUpstreams[r],
+			"--label", cacheLabel + "=" + r, defaultRegistryImage}
+		if dryRun {
+			utils.Info("DRY-RUN: docker %s", strings.Join(args, " "))
+			continue
+		}
+		out, err := utils.Command(ctx, "docker", "inspect", "-f", "{{.State.Running}}", name).CombinedOutput()
+		if err == nil {
+			if strings.TrimSpace(string(out)) != "true" {
+				if out, err := utils.Command(ctx, "docker", "start", name).CombinedOutput(); err != nil {
+					return fmt.Errorf("docker start %s failed: %w: %s", name, err, string(out))
+				}
+			}
+			utils.Debug("using existing cache %s for %s", name, r)
+			continue
+		}
+		utils.Info("creating pull-through cache %s for %s", name, r)
+		if out, err := utils.Command(ctx, "docker", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("docker run cache for %s failed: %w: %s", r, err, string(out))
+		}
+	}
+	return nil
+}
+
+// SetCache makes the cluster p creates pull the cached registries through
+// the cache containers. Returns an error for providers that cannot.
+func SetCache(p Provider, c Cache) error {
+	if !c.Enabled {
+		return nil
+	}
+	return addMirrors(p, "registry cache", c.mirrors()...)
+}
+
+// AttachCaches connects the cache containers to the cluster's Docker network.
+func AttachCaches(ctx context.Context, p Provider, c Cache, dryRun bool) error {
+	return attachContainers(ctx, p, "registry cache", c.containers(), dryRun)
+}
+
+// CacheInfo describes one cache container.
+type CacheInfo struct {
+	Registry  string
+	Container string
+	// State is the Docker container state, e.g. running or exited.
+	State string
+	// Size is the disk usage of the cached data in bytes, or -1 if unknown.
+	Size int64
+}
+
+// CacheStatus lists the cache containers, sorted by registry.
+func CacheStatus(ctx context.Context) ([]CacheInfo, error) {
+	out, err := utils.Command(ctx, "docker", "ps", "-a", "--filter", "label="+cacheLabel,
+		"--format", "{{.Names}}\t{{.Label \""+cacheLabel+"\"}}\t{{.State}}").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("docker ps failed: %w: %s", err, string(out))
+	}
+	var infos []CacheInfo
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		info := CacheInfo{Container: fields[0], Registry: fields[1], State: fields[2], Size: -1}
+		if info.State == "running" {
+			info.Size = cacheSize(ctx, info.Container)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Registry < infos[j].Registry })
+	return infos, nil
+}
+
+// cacheSize returns the bytes stored by a running cache container, or -1.
+func cacheSize(ctx context.Context, container string) int64 {
+	out, err := utils.Command(ctx, "docker", "exec", container, "du", "-sk", "/var/lib/registry").CombinedOutput()
+	if err != nil {
+		utils.Debug("du in %s failed: %v: %s", container, err, string(out))
+		return -1
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return -1
+	}
+	kb, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return kb * 1024
+}
+
+// PruneCaches removes the cache containers and their data for the given
+// registries (all caches if none are given) and returns the removed
+// containers. Clusters keep working: containerd falls back to the upstream
+// until `up --cache` recreates the caches.
+func PruneCaches(ctx context.Context, registries []string, dryRun bool) ([]string, error) {
+	if len(registries) == 0 {
+		registries = CacheRegistries()
+	}
+	var removed []string
+	for _, r := range registries {
+		if _, ok := cacheUpstreams[r]; !ok {
+			return removed, fmt.Errorf("unsupported registry %q (expected one of: %s)", r, strings.Join(CacheRegistries(), ", "))
+		}
+		name := CacheContainer(r)
+		if dryRun {
+			utils.Info("DRY-RUN: docker rm -f %s && docker volume rm %s", name, name)
+			continue
+		}
+		if err := utils.Command(ctx, "docker", "inspect", name).Run(); err != nil {
+			continue
+		}
+		if out, err := utils.Command(ctx, "docker", "rm", "-f", name).CombinedOutput(); err != nil {
+			return removed, fmt.Errorf("docker rm %s failed: %w: %s", name, err, string(out))
+		}
+		if out, err := utils.Command(ctx, "docker", "volume", "rm", name).CombinedOutput(); err != nil {
+			return removed, fmt.Errorf("docker volume rm %s failed: %w: %s", name, err, string(out))
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateConfigs_WithCache(t *testing.T) {
+	c := Cache{Enabled: true, Registries: []string{"docker.io", "quay.io"}}
+	b, err := GenerateK3dConfig("gc", K3dOptions{mirrors: c.mirrors()})
+	if err != nil {
+		t.Fatalf("GenerateK3dConfig: %v", err)
+	}
+	for _, want := range []string{"docker.io:", "http://kstack-cache-docker-io:5000", "quay.io:", "http://kstack-cache-quay-io:5000"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("k3d config missing %q:\n%s", want, b)
+		}
+	}
+	hosts := c.mirrors()[0].hostsTOML()
+	if !strings.HasPrefix(hosts, "server = \"https://registry-1.docker.io\"\n") || !strings.Contains(hosts, `[host."http://kstack-cache-docker-io:5000"]`) {
+		t.Fatalf("unexpected hosts.toml:\n%s", hosts)
+	}
+	if err := (Cache{Registries: []string{"gcr.io"}}).Validate(); err == nil {
+		t.Fatalf("expected error for unsupported registry")
+	}
+}
+
+func TestCache_Lifecycle(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\n"+
+		"case \"$1\" in\n"+
+		"  inspect) [ \"$2\" = kstack-cache-ghcr-io ] && exit 0; [ \"$4\" = kstack-cache-quay-io ] && { echo false; exit 0; }; exit 1;;\n"+
+		"  ps) printf 'kstack-cache-quay-io\\tquay.io\\texited\\nkstack-cache-docker-io\\tdocker.io\\trunning\\n';;\n"+
+		"  exec) printf '2048\\t/var/lib/registry\\n';;\n"+
+		"esac\nexit 0\n")
+	ctx := context.Background()
+
+	if err := EnsureCaches(ctx, Cache{Enabled: true, Registries: []string{"docker.io", "quay.io"}}, false); err != nil {
+		t.Fatalf("EnsureCaches: %v", err)
+	}
+	infos, err := CacheStatus(ctx)
+	if err != nil {
+		t.Fatalf("CacheStatus: %v", err)
+	}
+	want := []CacheInfo{
+		{Registry: "docker.io", Container: "kstack-cache-docker-io", State: "running", Size: 2048 * 1024},
+		{Registry: "quay.io", Container: "kstack-cache-quay-io", State: "exited", Size: -1},
+	}
+	if !reflect.DeepEqual(infos, want) {
+		t.Fatalf("CacheStatus = %+v", infos)
+	}
+	removed, err := PruneCaches(ctx, []string{"ghcr.io", "docker.io"}, false)
+	if err != nil || !reflect.DeepEqual(removed, []string{"kstack-cache-ghcr-io"}) {
+		t.Fatalf("PruneCaches = %v, %v", removed, err)
+	}
+	if _, err := PruneCaches(ctx, []string{"gcr.io"}, false); err == nil {
+		t.Fatalf("expected error for unsupported registry")
+	}
+
+	b, _ := os.ReadFile(argsFile)
+	for _, want := range []string{
+		"run -d --restart=always --name kstack-cache-docker-io -v kstack-cache-docker-io:/var/lib/registry -e REGISTRY_PROXY_REMOTEURL=https://registry-1.docker.io --label dev.kstack.cache=docker.io registry:2",
+		"start kstack-cache-quay-io",
+		"rm -f kstack-cache-ghcr-io",
+		"volume rm kstack-cache-ghcr-io",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("missing docker %q in:\n%s", want, b)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/christk1/kstack/pkg/kubeconfig"
+	"github.com/christk1/kstack/utils"
+)
+
+func init() {
+	Register(Spec{
+		Name: "existing",
+		New:  func(o Options) Provider { return NewExistingProvider(o.Name, o.Kubeconfig, o.Context) },
+	})
+}
+
+// existingProvider targets a cluster that kstack did not create, reached
+// through a kubeconfig and context. It never creates or deletes anything.
+type existingProvider struct {
+	name       string
+	kubeconfig string
+	context    string
+	DryRun     bool
+}
+
+// NewExistingProvider returns a provider for the cluster selected by
+// kubeconfigPath and contextName. Empty values mean the default kubeconfig
+// and its current context.
+func NewExistingProvider(name, kubeconfigPath, contextName string) Provider {
+	return &existingProvider{name: name, kubeconfig: kubeconfigPath, context: contextName}
+}
+
+// Create fails unless the cluster is reachable, since it cannot be created.
+func (p *existingProvider) Create(ctx context.Context) error {
+	if p.DryRun {
+		utils.Info("DRY-RUN: existing provider does not create clusters")
+		return nil
+	}
+	if err := p.ping(ctx); err != nil {
+		return fmt.Errorf("provider existing does not create clusters and %s is not reachable: %w", p.target(), err)
+	}
+	return nil
+}
+
+// Delete leaves the cluster in place.
+func (p *existingProvider) Delete(ctx context.Context) error {
+	utils.Info("provider existing does not delete clusters; leaving %s in place", p.target())
+	return nil
+}
+
+// Exists reports whether the API server is reachable.
+func (p *existingProvider) Exists(ctx context.Context) (bool, error) {
+	if p.DryRun {
+		utils.Info("DRY-RUN: query API server /version via %s (assume reachable)", p.target())
+		return true, nil
+	}
+	if err := p.ping(ctx); err != nil {
+		utils.Debug("existing cluster not reachable: %v", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// KubeconfigPath returns the given kubeconfig. When a context was given, a
+// copy reduced to that context is kept as the managed kubeconfig so that
+// tools using the file's current context target the right cluster.
+func (p *existingProvider) KubeconfigPath(ctx context.Context) (string, error) {
+	path := p.path()
+	if p.context == "" || p.DryRun {
+		return path, nil
+	}
+	full, err := kubeconfig.Load(path)
+	if err != nil {
+		return "", err
+	}
+	mini, err := full.Minify(p.context)
+	if err != nil {
+		return "", err
+	}
+	b, err := mini.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	return writeKubeconfig("existing", p.name, false, b)
+}
+
+func (p *existingProvider) ping(ctx context.Context) error {
+	_, err := kubeconfig.ServerVersion(ctx, p.path(), p.context)
+	return err
+}
+
+func (p *existingProvider) path() string {
+	if p.kubeconfig != "" {
+		return p.kubeconfig
+	}
+	return kubeconfig.DefaultPath()
+}
+
+// target describes the kubeconfig and context for messages.
+func (p *existingProvider) target() string {
+	if p.context == "" {
+		return "the current context of " + p.path()
+	}
+	return "context " + p.context + " of " + p.path()
+}
+
+func (p *existingProvider) Name() string     { return p.name }
+func (p *existingProvider) Provider() string { return "existing" }
+
+// setDryRun implements internal dryRunnable
+func (p *existingProvider) setDryRun(d bool) { p.DryRun = d }
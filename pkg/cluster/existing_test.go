@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/christk1/kstack/pkg/kubeconfig"
+)
+
+func writeTestKubeconfig(t *testing.T, servers map[string]string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nkind: Config\ncurrent-context: down\nclusters:\n")
+	for name, server := range servers {
+		b.WriteString("- {name: " + name + ", cluster: {server: \"" + server + "\"}}\n")
+	}
+	b.WriteString("contexts:\n")
+	for name := range servers {
+		b.WriteString("- {name: " + name + ", context: {cluster: " + name + ", user: " + name + "}}\n")
+	}
+	b.WriteString("users:\n")
+	for name := range servers {
+		b.WriteString("- {name: " + name + ", user: {token: t}}\n")
+	}
+	p := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(p, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExistingProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"major":"1","minor":"30","gitVersion":"v1.30.2"}`))
+	}))
+	defer srv.Close()
+	kc := writeTestKubeconfig(t, map[string]string{"ci": srv.URL, "down": "http://127.0.0.1:1"})
+	ctx := context.Background()
+
+	p, err := New("existing", Options{Name: "ci", Kubeconfig: kc, Context: "ci"})
+	if err != nil {
+		t.Fatalf("New(existing): %v", err)
+	}
+	if ok, err := p.Exists(ctx); err != nil || !ok {
+		t.Fatalf("Exists = %v, %v; want reachable", ok, err)
+	}
+	if err := p.Create(ctx); err != nil {
+		t.Fatalf("Create on a reachable cluster should succeed: %v", err)
+	}
+	if err := p.Delete(ctx); err != nil {
+		t.Fatalf("Delete should be a no-op: %v", err)
+	}
+	path, err := p.KubeconfigPath(ctx)
+	if err != nil {
+		t.Fatalf("KubeconfigPath: %v", err)
+	}
+	defer os.Remove(path)
+	got, err := kubeconfig.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CurrentContext != "ci" || len(got.Clusters) != 1 || got.Clusters[0].Cluster.Server != srv.URL {
+		t.Fatalf("kubeconfig not reduced to the given context: %#v", got)
+	}
+	if err := SetK8sVersion(p, "1.30"); err == nil {
+		t.Fatalf("existing clusters cannot pin a version")
+	}
+
+	// without a context the current context (unreachable here) is used
+	down := NewExistingProvider("ci", kc, "")
+	if ok, err := down.Exists(ctx); err != nil || ok {
+		t.Fatalf("Exists = %v, %v; want unreachable", ok, err)
+	}
+	if err := down.Create(ctx); err == nil || !strings.Contains(err.Error(), "does not create clusters") {
+		t.Fatalf("expected create error, got %v", err)
+	}
+	if path, err := down.KubeconfigPath(ctx); err != nil || path != kc {
+		t.Fatalf("KubeconfigPath = %q, %v; want %q", path, err, kc)
+	}
+	spec, _ := Lookup("existing")
+	if spec.Has(CapManaged) || spec.Preflight(ctx) != nil {
+		t.Fatalf("existing should be unmanaged with no preflight requirements")
+	}
+}
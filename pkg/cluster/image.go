@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// internal interface implemented by providers with the image-load
+// capability. loadImages returns the nodes that received the images.
+type imageLoader interface {
+	loadImages(ctx context.Context, images []string) ([]string, error)
+}
+
+// LoadImages copies local Docker images into the cluster's nodes and
+// returns the names of the nodes that received them. Every image must exist
+// in the local Docker daemon. In dry-run mode no nodes are returned.
+func LoadImages(ctx context.Context, p Provider, images []string) ([]string, error) {
+	il, ok := p.(imageLoader)
+	if !ok {
+		return nil, fmt.Errorf("provider %s cannot load images into the cluster", p.Provider())
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images given")
+	}
+	return il.loadImages(ctx, images)
+}
+
+// checkLocalImages returns an error naming the images missing from the
+// local Docker daemon.
+func checkLocalImages(ctx context.Context, images []string) error {
+	var missing []string
+	for _, img := range images {
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := utils.Command(cctx, "docker", "image", "inspect", img).Run()
+		cancel()
+		if err != nil {
+			missing = append(missing, img)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("images not found in the local Docker daemon: %s; build or pull them first", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// PullMissingImages pulls the images that are not yet in the local Docker
+// daemon, once each. It keeps going when a pull fails and returns the images
+// it pulled, the ones it could not pull, and an error describing the failures.
+func PullMissingImages(ctx context.Context, images []string, dryRun bool) (pulled, failed []string, err error) {
+	var errs []error
+	for _, img := range images {
+		if dryRun {
+			utils.Info("DRY-RUN: docker pull %s (if missing locally)", img)
+			continue
+		}
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := utils.Command(cctx, "docker", "image", "inspect", img).Run()
+		cancel()
+		if err == nil {
+			continue
+		}
+		utils.Debug("running: docker pull %s", img)
+		out, err := utils.Command(ctx, "docker", "pull", img).CombinedOutput()
+		if err != nil {
+			failed = append(failed, img)
+			errs = append(errs, fmt.Errorf("docker pull %s failed: %w: %s", img, err, strings.TrimSpace(string(out))))
+			continue
+		}
+		pulled = append(pulled, img)
+	}
+	return pulled, failed, errors.Join(errs...)
+}
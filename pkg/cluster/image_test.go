@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fakeDockerImages = "#!/usr/bin/env bash\nif [ \"$1 $2\" = \"image inspect\" ] && [ \"$3\" = \"my-app:latest\" ]; then exit 0; fi\nif [ \"$1\" = \"info\" ]; then exit 0; fi\nexit 1\n"
+
+func TestKindProvider_LoadImages(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	writeFakeCmd(t, "docker", fakeDockerImages)
+	writeFakeCmd(t, "kind", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\nif [ \"$1 $2\" = \"get nodes\" ]; then echo gc-img-control-plane; echo gc-img-worker; fi\nexit 0\n")
+	p := NewKindProvider("gc-img")
+	ctx := context.Background()
+
+	nodes, err := LoadImages(ctx, p, []string{"my-app:latest"})
+	if err != nil {
+		t.Fatalf("LoadImages: %v", err)
+	}
+	if !reflect.DeepEqual(nodes, []string{"gc-img-control-plane", "gc-img-worker"}) {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+	b, _ := os.ReadFile(argsFile)
+	if !strings.Contains(string(b), "load docker-image my-app:latest --name gc-img") {
+		t.Fatalf("unexpected kind invocations:\n%s", b)
+	}
+
+	if _, err := LoadImages(ctx, p, []string{"my-app:latest", "missing:1"}); err == nil || !strings.Contains(err.Error(), "missing:1") {
+		t.Fatalf("expected missing image error, got %v", err)
+	}
+}
+
+func TestK3dProvider_LoadImages(t *testing.T) {
+	writeFakeCmd(t, "docker", fakeDockerImages)
+	writeFakeCmd(t, "k3d", "#!/usr/bin/env bash\nif [ \"$1 $2\" = \"node list\" ]; then\n"+
+		"echo 'k3d-gc-img-server-0   server       gc-img   running'\n"+
+		"echo 'k3d-gc-img-agent-0    agent        gc-img   running'\n"+
+		"echo 'k3d-gc-img-serverlb   loadbalancer gc-img   running'\n"+
+		"echo 'k3d-other-server-0    server       other    running'\nfi\nexit 0\n")
+	nodes, err := LoadImages(context.Background(), NewK3dProvider("gc-img"), []string{"my-app:latest"})
+	if err != nil {
+		t.Fatalf("LoadImages: %v", err)
+	}
+	if !reflect.DeepEqual(nodes, []string{"k3d-gc-img-server-0", "k3d-gc-img-agent-0"}) {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+}
+
+func TestLoadImages_Unsupported(t *testing.T) {
+	if _, err := LoadImages(context.Background(), NewExistingProvider("x", "", ""), []string{"a"}); err == nil {
+		t.Fatalf("expected error for provider without image loading")
+	}
+	p := NewMinikubeProvider("gc-img")
+	SetDryRun(p, true)
+	if nodes, err := LoadImages(context.Background(), p, []string{"a"}); err != nil || nodes != nil {
+		t.Fatalf("dry-run LoadImages = %v, %v", nodes, err)
+	}
+}
@@ -4,34 +4,123 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/christk1/kstack/pkg/kubeconfig"
+	"github.com/christk1/kstack/pkg/preflight"
 	"github.com/christk1/kstack/utils"
 )
 
 // k3dProvider implements Provider by invoking the `k3d` CLI.
 type k3dProvider struct {
-	name   string
-	DryRun bool
+	name       string
+	opts       K3dOptions
+	k8sVersion string
+	mirrors    []mirror
+	DryRun     bool
+}
+
+func init() {
+	Register(Spec{
+		Name:         "k3d",
+		Binaries:     []Binary{{Name: "k3d", InstallURL: "https://k3d.io/"}, {Name: "docker", InstallURL: "https://docs.docker.com/get-docker/"}},
+		Checks:       []Check{{Name: "docker", Run: preflight.CheckDocker}},
+		Capabilities: []Capability{CapManaged, CapImageLoad, CapRegistry},
+		NewSettings:  func() Settings { return &K3dOptions{} },
+		New: func(o Options) Provider {
+			if opts, ok := o.Settings.(*K3dOptions); ok && opts != nil {
+				return NewK3dProviderWithOptions(o.Name, *opts)
+			}
+			return NewK3dProvider(o.Name)
+		},
+	})
 }
 
 func NewK3dProvider(name string) Provider { return &k3dProvider{name: name} }
 
+// NewK3dProviderWithOptions returns a k3d provider that creates the cluster
+// from a generated (or validated, passed-through) k3d SimpleConfig.
+func NewK3dProviderWithOptions(name string, opts K3dOptions) Provider {
+	return &k3dProvider{name: name, opts: opts}
+}
+
 func (p *k3dProvider) Create(ctx context.Context) error {
+	if !p.DryRun {
+		if err := p.preflight(ctx); err != nil {
+			return err
+		}
+	}
+
+	opts := p.opts
+	opts.mirrors = p.mirrors
+	if opts.ConfigFile != "" {
+		// checked before the pinned image is applied, which is passed
+		// next to the file rather than generated into a config
+		if err := opts.Validate(); err != nil {
+			return fmt.Errorf("invalid k3d options: %w", err)
+		}
+	}
+	if p.k8sVersion != "" {
+		img, err := p.k3sImage(ctx)
+		if err != nil {
+			return err
+		}
+		opts.Image = img
+	}
+
+	args := []string{"cluster", "create", p.name}
+
+	// Resolve the cluster config: a SimpleConfig file is validated and
+	// passed through, otherwise one is generated when customization was
+	// requested.
+	var generated []byte
+	if opts.ConfigFile != "" {
+		args = append(args, "--config", opts.ConfigFile)
+		if opts.Image != "" {
+			args = append(args, "--image", opts.Image)
+		}
+	} else if !opts.IsZero() {
+		b, err := GenerateK3dConfig(p.name, opts)
+		if err != nil {
+			return fmt.Errorf("invalid k3d options: %w", err)
+		}
+		generated = b
+	}
+
 	if p.DryRun {
-		utils.Info("DRY-RUN: k3d cluster create %s", p.name)
+		if generated != nil {
+			args = append(args, "--config", "<generated>")
+		}
+		utils.Info("DRY-RUN: k3d %s", strings.Join(args, " "))
+		if generated != nil {
+			utils.Info("DRY-RUN: generated k3d config:\n%s", string(generated))
+		}
 		return nil
 	}
-	if err := p.preflight(ctx); err != nil {
-		return err
+
+	if generated != nil {
+		tmp, err := os.CreateTemp("", "kstack-k3d-config-*.yaml")
+		if err != nil {
+			return fmt.Errorf("failed to create k3d config file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(generated); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write k3d config: %w", err)
+		}
+		if err := tmp.Close(); err != nil {
+			return fmt.Errorf("failed to write k3d config: %w", err)
+		}
+		args = append(args, "--config", tmp.Name())
+		utils.Debug("generated k3d config:\n%s", string(generated))
 	}
-	utils.Debug("running: k3d cluster create %s", p.name)
-	cmd := exec.CommandContext(ctx, "k3d", "cluster", "create", p.name)
-	out, err := cmd.CombinedOutput()
+
+	utils.Debug("running: k3d %s", strings.Join(args, " "))
+	cmd := utils.Command(ctx, "k3d", args...)
+	out, err := utils.Run(cmd, "k3d")
 	if err != nil {
-		return fmt.Errorf("k3d create failed: %w: %s", err, string(out))
+		return fmt.Errorf("k3d create failed: %w: %s", err, utils.Tail(out))
 	}
 	return nil
 }
@@ -41,10 +130,10 @@ func (p *k3dProvider) Delete(ctx context.Context) error {
 		utils.Info("DRY-RUN: k3d cluster delete %s", p.name)
 		return nil
 	}
-	cmd := exec.CommandContext(ctx, "k3d", "cluster", "delete", p.name)
-	out, err := cmd.CombinedOutput()
+	cmd := utils.Command(ctx, "k3d", "cluster", "delete", p.name)
+	out, err := utils.Run(cmd, "k3d")
 	if err != nil {
-		return fmt.Errorf("k3d delete failed: %w: %s", err, string(out))
+		return fmt.Errorf("k3d delete failed: %w: %s", err, utils.Tail(out))
 	}
 	return nil
 }
@@ -56,7 +145,7 @@ func (p *k3dProvider) Exists(ctx context.Context) (bool, error) {
 	}
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, "k3d", "cluster", "list")
+	cmd := utils.Command(ctx, "k3d", "cluster", "list")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return false, fmt.Errorf("k3d list failed: %w: %s", err, string(out))
@@ -71,38 +160,105 @@ func (p *k3dProvider) Exists(ctx context.Context) (bool, error) {
 }
 
 func (p *k3dProvider) KubeconfigPath(ctx context.Context) (string, error) {
+	b, err := p.getKubeconfig(ctx)
+	if err != nil || b == nil {
+		return "", err
+	}
+	return writeKubeconfig("k3d", p.name, false, b)
+}
+
+// internalKubeconfig implements internal internalKubeconfiger. k3d has no
+// in-network kubeconfig, so the server is pointed at the cluster's load
+// balancer container on the k3d network.
+func (p *k3dProvider) internalKubeconfig(ctx context.Context) ([]byte, error) {
+	b, err := p.getKubeconfig(ctx)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	c, err := kubeconfig.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	c.SetServer("https://k3d-" + p.name + "-serverlb:6443")
+	return c.Marshal()
+}
+
+// getKubeconfig runs `k3d kubeconfig get <name>`. It returns nil in dry-run
+// mode.
+func (p *k3dProvider) getKubeconfig(ctx context.Context) ([]byte, error) {
 	if p.DryRun {
 		utils.Info("DRY-RUN: k3d kubeconfig get %s", p.name)
-		return "", nil
+		return nil, nil
 	}
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, "k3d", "kubeconfig", "get", p.name)
+	cmd := utils.Command(ctx, "k3d", "kubeconfig", "get", p.name)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("k3d get kubeconfig failed: %w: %s", err, string(out))
+		return nil, fmt.Errorf("k3d get kubeconfig failed: %w: %s", err, string(out))
 	}
-	tmp, err := os.CreateTemp("", "k3d-kubeconfig-*")
+	return out, nil
+}
+
+// loadImages implements internal imageLoader with `k3d image import`, which
+// imports into every server and agent node of the cluster.
+func (p *k3dProvider) loadImages(ctx context.Context, images []string) ([]string, error) {
+	args := append([]string{"image", "import"}, images...)
+	args = append(args, "-c", p.name)
+	if p.DryRun {
+		utils.Info("DRY-RUN: k3d %s", strings.Join(args, " "))
+		return nil, nil
+	}
+	if err := checkLocalImages(ctx, images); err != nil {
+		return nil, err
+	}
+	utils.Debug("running: k3d %s", strings.Join(args, " "))
+	out, err := utils.Run(utils.Command(ctx, "k3d", args...), "k3d")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp kubeconfig: %w", err)
+		return nil, fmt.Errorf("k3d image import failed: %w: %s", err, utils.Tail(out))
 	}
-	defer tmp.Close()
-	if _, err := tmp.Write(out); err != nil {
-		return "", fmt.Errorf("failed to write kubeconfig to temp file: %w", err)
+	// NAME ROLE CLUSTER STATUS
+	out, err = utils.Command(ctx, "k3d", "node", "list", "--no-headers").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("k3d node list failed: %w: %s", err, string(out))
 	}
-	utils.Debug("wrote k3d kubeconfig to %s", tmp.Name())
-	return tmp.Name(), nil
+	var nodes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 3 && f[2] == p.name && (f[1] == "server" || f[1] == "agent") {
+			nodes = append(nodes, f[0])
+		}
+	}
+	return nodes, nil
+}
+
+// k3sImage resolves the rancher/k3s image for the pinned Kubernetes version,
+// failing if the installed k3d is too old to run it.
+func (p *k3dProvider) k3sImage(ctx context.Context) (string, error) {
+	if p.opts.Image != "" {
+		return "", fmt.Errorf("k3d.image and a pinned Kubernetes version (%s) are mutually exclusive", p.k8sVersion)
+	}
+	if !p.DryRun {
+		v, err := cliVersion(ctx, "k3d", "version")
+		if err != nil {
+			return "", err
+		}
+		if err := CheckK3dVersion(v); err != nil {
+			return "", err
+		}
+	}
+	return K3sImage(p.k8sVersion)
 }
 
 func (p *k3dProvider) preflight(ctx context.Context) error {
 	ctx1, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	if err := exec.CommandContext(ctx1, "k3d", "version").Run(); err != nil {
+	if err := utils.Command(ctx1, "k3d", "version").Run(); err != nil {
 		return fmt.Errorf("k3d CLI not found or not executable: %w", err)
 	}
 	ctx2, cancel2 := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel2()
-	if err := exec.CommandContext(ctx2, "docker", "info").Run(); err != nil {
+	if err := utils.Command(ctx2, "docker", "info").Run(); err != nil {
 		return fmt.Errorf("docker does not appear to be available/running: %w", err)
 	}
 	return nil
@@ -113,3 +269,18 @@ func (p *k3dProvider) Provider() string { return "k3d" }
 
 // setDryRun implements internal dryRunnable
 func (p *k3dProvider) setDryRun(d bool) { p.DryRun = d }
+
+// setK8sVersion and checkK8sVersion implement internal versionPinnable
+func (p *k3dProvider) setK8sVersion(v string) { p.k8sVersion = v }
+
+func (p *k3dProvider) checkK8sVersion(ctx context.Context) error {
+	if p.k8sVersion == "" {
+		return nil
+	}
+	_, err := p.k3sImage(ctx)
+	return err
+}
+
+// addMirrors and network implement internal mirrorUser
+func (p *k3dProvider) addMirrors(ms ...mirror) { p.mirrors = append(p.mirrors, ms...) }
+func (p *k3dProvider) network() string         { return "k3d-" + p.name }
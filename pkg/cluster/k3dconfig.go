@@ -0,0 +1,256 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// K3dOptions customizes the k3d cluster created by k3dProvider. Either
+// ConfigFile names a k3d SimpleConfig that is validated and passed through,
+// or the remaining fields are used to generate one. The zero value creates
+// k3d's default cluster.
+type K3dOptions struct {
+	// ConfigFile is a k3d SimpleConfig (kind: Simple) passed via --config.
+	ConfigFile string `yaml:"config,omitempty"`
+	// Image is the k3s image (e.g. rancher/k3s:v1.30.4-k3s1).
+	Image   string `yaml:"image,omitempty"`
+	Servers int    `yaml:"servers,omitempty"`
+	Agents  int    `yaml:"agents,omitempty"`
+	// Ports are exposed through the load balancer unless node filters say otherwise.
+	Ports []K3dPort `yaml:"ports,omitempty"`
+	// Volumes are mounted on all nodes unless node filters say otherwise.
+	Volumes []K3dVolume `yaml:"volumes,omitempty"`
+	// K3sArgs are passed through to k3s (servers unless node filters say otherwise).
+	K3sArgs []K3sArg `yaml:"k3sArgs,omitempty"`
+	// DisableTraefik and DisableServiceLB turn off the bundled k3s components.
+	DisableTraefik   bool `yaml:"disableTraefik,omitempty"`
+	DisableServiceLB bool `yaml:"disableServiceLB,omitempty"`
+	// ServersMemory and AgentsMemory limit node container memory (e.g. 2g).
+	ServersMemory string `yaml:"serversMemory,omitempty"`
+	AgentsMemory  string `yaml:"agentsMemory,omitempty"`
+
+	// mirrors are configured on every node so that pulls go through the
+	// local registry and caches.
+	mirrors []mirror
+}
+
+// K3dPort maps a host port, in k3d `[host:]hostPort:containerPort` form.
+type K3dPort struct {
+	Port        string   `yaml:"port"`
+	NodeFilters []string `yaml:"nodeFilters,omitempty"`
+}
+
+// K3dVolume bind-mounts a host path, in k3d `hostPath:containerPath` form.
+type K3dVolume struct {
+	Volume      string   `yaml:"volume"`
+	NodeFilters []string `yaml:"nodeFilters,omitempty"`
+}
+
+// K3sArg is an argument passed through to k3s, e.g. --disable=metrics-server.
+type K3sArg struct {
+	Arg         string   `yaml:"arg"`
+	NodeFilters []string `yaml:"nodeFilters,omitempty"`
+}
+
+// IsZero reports whether no customization was requested.
+func (o K3dOptions) IsZero() bool {
+	return o.ConfigFile == "" && o.Image == "" && o.Servers == 0 && o.Agents == 0 &&
+		len(o.Ports) == 0 && len(o.Volumes) == 0 && len(o.K3sArgs) == 0 &&
+		!o.DisableTraefik && !o.DisableServiceLB && o.ServersMemory == "" && o.AgentsMemory == "" &&
+		len(o.mirrors) == 0
+}
+
+// NodeImage returns the k3s image the options pin, if any.
+func (o K3dOptions) NodeImage() string { return o.Image }
+
+// ConfigPath returns the k3d SimpleConfig passed through, if any.
+func (o K3dOptions) ConfigPath() string { return o.ConfigFile }
+
+// ResolvePaths resolves the config file and the host side of volumes,
+// which docker requires to be absolute.
+func (o *K3dOptions) ResolvePaths(resolve func(string) string) {
+	o.ConfigFile = resolve(o.ConfigFile)
+	if len(o.Volumes) == 0 {
+		return
+	}
+	volumes := make([]K3dVolume, len(o.Volumes))
+	for i, v := range o.Volumes {
+		if host, container, ok := strings.Cut(v.Volume, ":"); ok {
+			if abs, err := filepath.Abs(resolve(host)); err == nil {
+				v.Volume = abs + ":" + container
+			}
+		}
+		volumes[i] = v
+	}
+	o.Volumes = volumes
+}
+
+var (
+	k3dPortRe   = regexp.MustCompile(`^([0-9.]+:)?[0-9]+(-[0-9]+)?:[0-9]+(-[0-9]+)?(/(tcp|udp))?$`)
+	k3dMemoryRe = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+)
+
+// Validate checks the options, including a passed-through SimpleConfig.
+func (o K3dOptions) Validate() error {
+	var errs []error
+	if o.ConfigFile != "" {
+		generated := o
+		generated.ConfigFile = ""
+		generated.mirrors = nil
+		if !generated.IsZero() {
+			errs = append(errs, errors.New("k3d.config cannot be combined with generated cluster settings"))
+		}
+		if len(o.mirrors) > 0 {
+			errs = append(errs, errors.New("k3d.config cannot be combined with a local registry or cache"))
+		}
+		if err := ValidateK3dConfigFile(o.ConfigFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if o.Servers < 0 || o.Agents < 0 {
+		errs = append(errs, errors.New("k3d server and agent counts must not be negative"))
+	}
+	for i, p := range o.Ports {
+		if !k3dPortRe.MatchString(p.Port) {
+			errs = append(errs, fmt.Errorf("k3d.ports[%d]: invalid port %q: expected [host:]hostPort:containerPort[/protocol]", i, p.Port))
+		}
+	}
+	for i, v := range o.Volumes {
+		if host, container, ok := strings.Cut(v.Volume, ":"); !ok || host == "" || container == "" {
+			errs = append(errs, fmt.Errorf("k3d.volumes[%d]: invalid volume %q: expected hostPath:containerPath", i, v.Volume))
+		}
+	}
+	for i, a := range o.K3sArgs {
+		if !strings.HasPrefix(a.Arg, "--") {
+			errs = append(errs, fmt.Errorf("k3d.k3sArgs[%d]: %q must start with --", i, a.Arg))
+		}
+	}
+	for _, m := range [][2]string{{"serversMemory", o.ServersMemory}, {"agentsMemory", o.AgentsMemory}} {
+		if m[1] != "" && !k3dMemoryRe.MatchString(m[1]) {
+			errs = append(errs, fmt.Errorf("k3d.%s: invalid memory limit %q (e.g. 512m, 2g)", m[0], m[1]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// k3dSimpleConfig mirrors the subset of k3d's v1alpha5 SimpleConfig that
+// kstack generates.
+type k3dSimpleConfig struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k3dMetadata       `yaml:"metadata"`
+	Servers    int               `yaml:"servers,omitempty"`
+	Agents     int               `yaml:"agents,omitempty"`
+	Image      string            `yaml:"image,omitempty"`
+	Ports      []K3dPort         `yaml:"ports,omitempty"`
+	Volumes    []K3dVolume       `yaml:"volumes,omitempty"`
+	Registries *k3dRegistries    `yaml:"registries,omitempty"`
+	Options    *k3dSimpleOptions `yaml:"options,omitempty"`
+}
+
+// k3dRegistries holds a k3s registries.yaml passed to every node.
+type k3dRegistries struct {
+	Config string `yaml:"config"`
+}
+
+type k3dMetadata struct {
+	Name string `yaml:"name"`
+}
+
+type k3dSimpleOptions struct {
+	K3s     *k3dK3sOptions     `yaml:"k3s,omitempty"`
+	Runtime *k3dRuntimeOptions `yaml:"runtime,omitempty"`
+}
+
+type k3dK3sOptions struct {
+	ExtraArgs []K3sArg `yaml:"extraArgs,omitempty"`
+}
+
+type k3dRuntimeOptions struct {
+	ServersMemory string `yaml:"serversMemory,omitempty"`
+	AgentsMemory  string `yaml:"agentsMemory,omitempty"`
+}
+
+// GenerateK3dConfig renders a k3d v1alpha5 SimpleConfig for cluster name.
+func GenerateK3dConfig(name string, o K3dOptions) ([]byte, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	cfg := k3dSimpleConfig{
+		APIVersion: "k3d.io/v1alpha5",
+		Kind:       "Simple",
+		Metadata:   k3dMetadata{Name: name},
+		Servers:    o.Servers,
+		Agents:     o.Agents,
+		Image:      o.Image,
+	}
+	for _, p := range o.Ports {
+		if len(p.NodeFilters) == 0 {
+			p.NodeFilters = []string{"loadbalancer"}
+		}
+		cfg.Ports = append(cfg.Ports, p)
+	}
+	for _, v := range o.Volumes {
+		if len(v.NodeFilters) == 0 {
+			v.NodeFilters = []string{"all"}
+		}
+		cfg.Volumes = append(cfg.Volumes, v)
+	}
+
+	var args []K3sArg
+	if o.DisableTraefik {
+		args = append(args, K3sArg{Arg: "--disable=traefik"})
+	}
+	if o.DisableServiceLB {
+		args = append(args, K3sArg{Arg: "--disable=servicelb"})
+	}
+	args = append(args, o.K3sArgs...)
+	opts := &k3dSimpleOptions{}
+	if len(args) > 0 {
+		for i := range args {
+			if len(args[i].NodeFilters) == 0 {
+				args[i].NodeFilters = []string{"server:*"}
+			}
+		}
+		opts.K3s = &k3dK3sOptions{ExtraArgs: args}
+	}
+	if o.ServersMemory != "" || o.AgentsMemory != "" {
+		opts.Runtime = &k3dRuntimeOptions{ServersMemory: o.ServersMemory, AgentsMemory: o.AgentsMemory}
+	}
+	if opts.K3s != nil || opts.Runtime != nil {
+		cfg.Options = opts
+	}
+	if len(o.mirrors) > 0 {
+		reg, err := k3sRegistries(o.mirrors)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Registries = &k3dRegistries{Config: reg}
+	}
+	return yaml.Marshal(cfg)
+}
+
+// ValidateK3dConfigFile checks that path holds a k3d SimpleConfig.
+func ValidateK3dConfigFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("k3d config file %s not found or unreadable: %w", path, err)
+	}
+	var hdr struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+	}
+	if err := yaml.Unmarshal(b, &hdr); err != nil {
+		return fmt.Errorf("parse k3d config file %s: %w", path, err)
+	}
+	if !strings.HasPrefix(hdr.APIVersion, "k3d.io/") || hdr.Kind != "Simple" {
+		return fmt.Errorf("k3d config file %s: expected apiVersion k3d.io/* and kind Simple, got %q/%q", path, hdr.APIVersion, hdr.Kind)
+	}
+	return nil
+}
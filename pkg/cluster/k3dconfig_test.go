@@ -0,0 +1,95 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestGenerateK3dConfig(t *testing.T) {
+	b, err := GenerateK3dConfig("gc-k3d", K3dOptions{
+		Servers:          1,
+		Agents:           2,
+		Image:            "rancher/k3s:v1.30.4-k3s1",
+		Ports:            []K3dPort{{Port: "8080:80"}},
+		Volumes:          []K3dVolume{{Volume: "/data:/data", NodeFilters: []string{"agent:*"}}},
+		K3sArgs:          []K3sArg{{Arg: "--disable=metrics-server"}},
+		DisableTraefik:   true,
+		DisableServiceLB: true,
+		AgentsMemory:     "2g",
+	})
+	if err != nil {
+		t.Fatalf("GenerateK3dConfig: %v", err)
+	}
+	var got k3dSimpleConfig
+	if err := yaml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, b)
+	}
+	if got.APIVersion != "k3d.io/v1alpha5" || got.Kind != "Simple" || got.Metadata.Name != "gc-k3d" {
+		t.Fatalf("unexpected header: %+v", got)
+	}
+	if got.Servers != 1 || got.Agents != 2 || got.Image != "rancher/k3s:v1.30.4-k3s1" {
+		t.Fatalf("unexpected nodes/image: %+v", got)
+	}
+	if got.Ports[0].NodeFilters[0] != "loadbalancer" || got.Volumes[0].NodeFilters[0] != "agent:*" {
+		t.Fatalf("unexpected node filters: %+v %+v", got.Ports, got.Volumes)
+	}
+	var args []string
+	for _, a := range got.Options.K3s.ExtraArgs {
+		args = append(args, a.Arg)
+	}
+	if strings.Join(args, " ") != "--disable=traefik --disable=servicelb --disable=metrics-server" {
+		t.Fatalf("unexpected k3s args: %v", args)
+	}
+	if got.Options.Runtime.AgentsMemory != "2g" {
+		t.Fatalf("unexpected runtime options: %+v", got.Options.Runtime)
+	}
+}
+
+func TestK3dOptions_Validate(t *testing.T) {
+	dir := t.TempDir()
+	notSimple := filepath.Join(dir, "bad.yaml")
+	os.WriteFile(notSimple, []byte("apiVersion: kind.x-k8s.io/v1alpha4\nkind: Cluster\n"), 0o644)
+	cases := map[string]K3dOptions{
+		"bad port":     {Ports: []K3dPort{{Port: "eighty"}}},
+		"bad volume":   {Volumes: []K3dVolume{{Volume: "/only-host"}}},
+		"bad k3s arg":  {K3sArgs: []K3sArg{{Arg: "disable=traefik"}}},
+		"bad memory":   {ServersMemory: "lots"},
+		"negative":     {Agents: -1},
+		"wrong kind":   {ConfigFile: notSimple},
+		"file + flags": {ConfigFile: notSimple, Agents: 1},
+	}
+	for name, o := range cases {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+	good := filepath.Join(dir, "k3d.yaml")
+	os.WriteFile(good, []byte("apiVersion: k3d.io/v1alpha5\nkind: Simple\n"), 0o644)
+	if err := (K3dOptions{ConfigFile: good}).Validate(); err != nil {
+		t.Fatalf("valid SimpleConfig rejected: %v", err)
+	}
+}
+
+func TestK3dProvider_Create_PassesGeneratedConfig(t *testing.T) {
+	cfgCopy := filepath.Join(t.TempDir(), "k3d.yaml")
+	script := "#!/usr/bin/env bash\nif [ \"$1\" = \"cluster\" ] && [ \"$2\" = \"create\" ]; then for a in \"$@\"; do if [ -n \"$prev\" ]; then cp \"$a\" " + cfgCopy + "; prev=; fi; [ \"$a\" = \"--config\" ] && prev=1; done; fi\nexit 0\n"
+	writeFakeCmd(t, "k3d", script)
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+
+	p := NewK3dProviderWithOptions("gc-k3d", K3dOptions{Agents: 2, DisableTraefik: true})
+	if err := p.Create(context.Background()); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	b, err := os.ReadFile(cfgCopy)
+	if err != nil {
+		t.Fatalf("generated config not passed to k3d: %v", err)
+	}
+	if !strings.Contains(string(b), "agents: 2") || !strings.Contains(string(b), "--disable=traefik") {
+		t.Fatalf("unexpected generated config:\n%s", b)
+	}
+}
@@ -4,38 +4,144 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/christk1/kstack/pkg/preflight"
 	"github.com/christk1/kstack/utils"
 )
 
 // kindProvider implements Provider by invoking the `kind` CLI. It prefers
 // to return actionable errors and uses context for timeouts.
 type kindProvider struct {
-	name   string
-	DryRun bool
+	name       string
+	opts       KindOptions
+	k8sVersion string
+	mirrors    []mirror
+	DryRun     bool
+}
+
+func init() {
+	Register(Spec{
+		Name:         "kind",
+		Binaries:     []Binary{{Name: "kind", InstallURL: "https://kind.sigs.k8s.io/"}, {Name: "docker", InstallURL: "https://docs.docker.com/get-docker/"}},
+		Checks:       []Check{{Name: "docker", Run: preflight.CheckDocker}},
+		Capabilities: []Capability{CapManaged, CapImageLoad, CapRegistry},
+		NewSettings:  func() Settings { return &KindOptions{} },
+		New: func(o Options) Provider {
+			if opts, ok := o.Settings.(*KindOptions); ok && opts != nil {
+				return NewKindProviderWithOptions(o.Name, *opts)
+			}
+			return NewKindProvider(o.Name)
+		},
+	})
 }
 
 func NewKindProvider(name string) Provider { return &kindProvider{name: name} }
 
+// NewKindProviderWithOptions returns a kind provider that creates the
+// cluster from a generated (or passed-through) kind config.
+func NewKindProviderWithOptions(name string, opts KindOptions) Provider {
+	return &kindProvider{name: name, opts: opts}
+}
+
 func (p *kindProvider) Create(ctx context.Context) error {
 	// Run preflight checks first
+	if !p.DryRun {
+		if err := p.preflight(ctx); err != nil {
+			return err
+		}
+	}
+
+	opts := p.opts
+	opts.mirrors = p.mirrors
+	if p.k8sVersion != "" {
+		img, err := p.nodeImage(ctx)
+		if err != nil {
+			return err
+		}
+		opts.Image = img
+	}
+
+	args := []string{"create", "cluster", "--name", p.name}
+	if opts.Image != "" {
+		args = append(args, "--image", opts.Image)
+	}
+
+	// Resolve the cluster config: a raw file is passed through, otherwise
+	// one is generated when any node customization was requested.
+	var generated []byte
+	if opts.ConfigFile != "" {
+		if len(opts.mirrors) > 0 {
+			return fmt.Errorf("kind.config cannot be combined with a local registry or cache")
+		}
+		args = append(args, "--config", opts.ConfigFile)
+	} else if opts.generates() {
+		b, err := GenerateKindConfig(opts)
+		if err != nil {
+			return fmt.Errorf("invalid kind options: %w", err)
+		}
+		generated = b
+	}
+
 	if p.DryRun {
-		utils.Info("DRY-RUN: kind create cluster --name %s", p.name)
+		if generated != nil {
+			args = append(args, "--config", "<generated>")
+		}
+		utils.Info("DRY-RUN: kind %s", strings.Join(args, " "))
+		if generated != nil {
+			utils.Info("DRY-RUN: generated kind config:\n%s", string(generated))
+		}
+		for _, m := range p.mirrors {
+			utils.Info("DRY-RUN: write %s on every node", m.hostsFile())
+		}
 		return nil
 	}
-	if err := p.preflight(ctx); err != nil {
-		return err
+
+	if generated != nil {
+		tmp, err := os.CreateTemp("", "kstack-kind-config-*.yaml")
+		if err != nil {
+			return fmt.Errorf("failed to create kind config file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(generated); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write kind config: %w", err)
+		}
+		if err := tmp.Close(); err != nil {
+			return fmt.Errorf("failed to write kind config: %w", err)
+		}
+		args = append(args, "--config", tmp.Name())
+		utils.Debug("generated kind config:\n%s", string(generated))
 	}
 
-	// kind create cluster --name <name>
-	utils.Debug("running: kind create cluster --name %s", p.name)
-	cmd := exec.CommandContext(ctx, "kind", "create", "cluster", "--name", p.name)
-	out, err := cmd.CombinedOutput()
+	// kind create cluster --name <name> [--image <img>] [--config <file>]
+	utils.Debug("running: kind %s", strings.Join(args, " "))
+	cmd := utils.Command(ctx, "kind", args...)
+	out, err := utils.Run(cmd, "kind")
+	if err != nil {
+		return fmt.Errorf("kind create failed: %w: %s", err, utils.Tail(out))
+	}
+	if len(p.mirrors) > 0 {
+		return p.configureMirrors(ctx)
+	}
+	return nil
+}
+
+// configureMirrors writes the hosts.toml of every mirror on every node.
+func (p *kindProvider) configureMirrors(ctx context.Context) error {
+	out, err := utils.Command(ctx, "kind", "get", "nodes", "--name", p.name).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("kind create failed: %w: %s", err, string(out))
+		return fmt.Errorf("kind get nodes failed: %w: %s", err, string(out))
+	}
+	for _, node := range strings.Fields(string(out)) {
+		for _, m := range p.mirrors {
+			cmd := utils.Command(ctx, "docker", "exec", "-i", node, "sh", "-c", "mkdir -p \"$(dirname \"$1\")\" && cat > \"$1\"", "sh", m.hostsFile())
+			cmd.Stdin = strings.NewReader(m.hostsTOML())
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("configure mirror for %s on node %s failed: %w: %s", m.Registry, node, err, string(out))
+			}
+		}
 	}
 	return nil
 }
@@ -45,10 +151,10 @@ func (p *kindProvider) Delete(ctx context.Context) error {
 		utils.Info("DRY-RUN: kind delete cluster --name %s", p.name)
 		return nil
 	}
-	cmd := exec.CommandContext(ctx, "kind", "delete", "cluster", "--name", p.name)
-	out, err := cmd.CombinedOutput()
+	cmd := utils.Command(ctx, "kind", "delete", "cluster", "--name", p.name)
+	out, err := utils.Run(cmd, "kind")
 	if err != nil {
-		return fmt.Errorf("kind delete failed: %w: %s", err, string(out))
+		return fmt.Errorf("kind delete failed: %w: %s", err, utils.Tail(out))
 	}
 	return nil
 }
@@ -61,7 +167,7 @@ func (p *kindProvider) Exists(ctx context.Context) (bool, error) {
 	// kind get clusters
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, "kind", "get", "clusters")
+	cmd := utils.Command(ctx, "kind", "get", "clusters")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return false, fmt.Errorf("kind get clusters failed: %w: %s", err, string(out))
@@ -76,32 +182,77 @@ func (p *kindProvider) Exists(ctx context.Context) (bool, error) {
 }
 
 func (p *kindProvider) KubeconfigPath(ctx context.Context) (string, error) {
+	b, err := p.getKubeconfig(ctx)
+	if err != nil || b == nil {
+		return "", err
+	}
+	return writeKubeconfig("kind", p.name, false, b)
+}
+
+// internalKubeconfig implements internal internalKubeconfiger using kind's
+// --internal address (the control-plane container on the kind network).
+func (p *kindProvider) internalKubeconfig(ctx context.Context) ([]byte, error) {
+	return p.getKubeconfig(ctx, "--internal")
+}
+
+// getKubeconfig runs `kind get kubeconfig --name <name> [extra...]`. It
+// returns nil in dry-run mode.
+func (p *kindProvider) getKubeconfig(ctx context.Context, extra ...string) ([]byte, error) {
+	args := append([]string{"get", "kubeconfig", "--name", p.name}, extra...)
 	if p.DryRun {
-		utils.Info("DRY-RUN: kind get kubeconfig --name %s", p.name)
-		return "", nil
+		utils.Info("DRY-RUN: kind %s", strings.Join(args, " "))
+		return nil, nil
 	}
-	// Run `kind get kubeconfig --name <name>` and write to a temp file.
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, "kind", "get", "kubeconfig", "--name", p.name)
+	cmd := utils.Command(ctx, "kind", args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("kind get kubeconfig failed: %w: %s", err, string(out))
+		return nil, fmt.Errorf("kind get kubeconfig failed: %w: %s", err, string(out))
 	}
+	return out, nil
+}
 
-	// Write to temp file
-	tmp, err := os.CreateTemp("", "kind-kubeconfig-*")
+// loadImages implements internal imageLoader with `kind load docker-image`,
+// which loads into every node of the cluster.
+func (p *kindProvider) loadImages(ctx context.Context, images []string) ([]string, error) {
+	args := append([]string{"load", "docker-image"}, images...)
+	args = append(args, "--name", p.name)
+	if p.DryRun {
+		utils.Info("DRY-RUN: kind %s", strings.Join(args, " "))
+		return nil, nil
+	}
+	if err := checkLocalImages(ctx, images); err != nil {
+		return nil, err
+	}
+	utils.Debug("running: kind %s", strings.Join(args, " "))
+	out, err := utils.Run(utils.Command(ctx, "kind", args...), "kind")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp kubeconfig: %w", err)
+		return nil, fmt.Errorf("kind load docker-image failed: %w: %s", err, utils.Tail(out))
 	}
-	defer tmp.Close()
-
-	if _, err := tmp.Write(out); err != nil {
-		return "", fmt.Errorf("failed to write kubeconfig to temp file: %w", err)
+	out, err = utils.Command(ctx, "kind", "get", "nodes", "--name", p.name).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("kind get nodes failed: %w: %s", err, string(out))
 	}
+	return strings.Fields(string(out)), nil
+}
 
-	utils.Debug("wrote kind kubeconfig to %s", tmp.Name())
-	return tmp.Name(), nil
+// nodeImage resolves the kindest/node image for the pinned Kubernetes
+// version, failing if the installed kind cannot run it. In dry-run mode the
+// newest known kind release is assumed.
+func (p *kindProvider) nodeImage(ctx context.Context) (string, error) {
+	if p.opts.Image != "" {
+		return "", fmt.Errorf("kind.image and a pinned Kubernetes version (%s) are mutually exclusive", p.k8sVersion)
+	}
+	kindVersion := newestKindRelease()
+	if !p.DryRun {
+		v, err := cliVersion(ctx, "kind", "version")
+		if err != nil {
+			return "", err
+		}
+		kindVersion = v
+	}
+	return KindNodeImage(kindVersion, p.k8sVersion)
 }
 
 // preflight verifies that required binaries and runtime (docker) are available.
@@ -109,14 +260,14 @@ func (p *kindProvider) preflight(ctx context.Context) error {
 	// check kind binary
 	ctx1, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	if err := exec.CommandContext(ctx1, "kind", "--version").Run(); err != nil {
+	if err := utils.Command(ctx1, "kind", "--version").Run(); err != nil {
 		return fmt.Errorf("kind CLI not found or not executable: %w", err)
 	}
 
 	// check docker availability
 	ctx2, cancel2 := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel2()
-	if err := exec.CommandContext(ctx2, "docker", "info").Run(); err != nil {
+	if err := utils.Command(ctx2, "docker", "info").Run(); err != nil {
 		return fmt.Errorf("docker does not appear to be available/running: %w", err)
 	}
 
@@ -128,3 +279,18 @@ func (p *kindProvider) Provider() string { return "kind" }
 
 // setDryRun implements internal dryRunnable
 func (p *kindProvider) setDryRun(d bool) { p.DryRun = d }
+
+// setK8sVersion and checkK8sVersion implement internal versionPinnable
+func (p *kindProvider) setK8sVersion(v string) { p.k8sVersion = v }
+
+func (p *kindProvider) checkK8sVersion(ctx context.Context) error {
+	if p.k8sVersion == "" {
+		return nil
+	}
+	_, err := p.nodeImage(ctx)
+	return err
+}
+
+// addMirrors and network implement internal mirrorUser
+func (p *kindProvider) addMirrors(ms ...mirror) { p.mirrors = append(p.mirrors, ms...) }
+func (p *kindProvider) network() string         { return "kind" }
@@ -0,0 +1,273 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// KindOptions customizes the kind cluster created by kindProvider. Either
+// ConfigFile names a raw kind Cluster config to pass through unchanged, or
+// the remaining fields are used to generate one. The zero value creates the
+// default single-node cluster.
+type KindOptions struct {
+	// ConfigFile is a kind `Cluster` config passed as-is via --config.
+	ConfigFile string `yaml:"config,omitempty"`
+	// Image is the node image (e.g. kindest/node:v1.30.0) for every node.
+	Image string `yaml:"image,omitempty"`
+	// ControlPlanes and Workers generate that many plain nodes. They are
+	// ignored when Nodes is set. ControlPlanes defaults to 1.
+	ControlPlanes int `yaml:"controlPlanes,omitempty"`
+	Workers       int `yaml:"workers,omitempty"`
+	// Nodes lists nodes explicitly, e.g. to label or taint them.
+	Nodes []KindNode `yaml:"nodes,omitempty"`
+	// PortMappings are added to the first control-plane node.
+	PortMappings []PortMapping `yaml:"portMappings,omitempty"`
+	// Mounts are added to every node.
+	Mounts []Mount `yaml:"mounts,omitempty"`
+
+	// mirrors make containerd read per-registry host configs so nodes pull
+	// through the local registry and caches.
+	mirrors []mirror
+}
+
+// KindNode is a single node of a generated kind cluster.
+type KindNode struct {
+	// Role is "control-plane" or "worker".
+	Role   string            `yaml:"role"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Taints use the kubectl form key[=value]:Effect.
+	Taints []string `yaml:"taints,omitempty"`
+}
+
+// PortMapping maps a host port to a port on the node container.
+type PortMapping struct {
+	ContainerPort int    `yaml:"containerPort"`
+	HostPort      int    `yaml:"hostPort"`
+	ListenAddress string `yaml:"listenAddress,omitempty"`
+	Protocol      string `yaml:"protocol,omitempty"`
+}
+
+// Mount bind-mounts a host path into the node container.
+type Mount struct {
+	HostPath      string `yaml:"hostPath"`
+	ContainerPath string `yaml:"containerPath"`
+	ReadOnly      bool   `yaml:"readOnly,omitempty"`
+}
+
+// IsZero reports whether no customization was requested.
+func (o KindOptions) IsZero() bool {
+	return o.ConfigFile == "" && o.Image == "" && o.ControlPlanes == 0 && o.Workers == 0 &&
+		len(o.Nodes) == 0 && len(o.PortMappings) == 0 && len(o.Mounts) == 0
+}
+
+// NodeImage returns the node image the options pin, if any.
+func (o KindOptions) NodeImage() string { return o.Image }
+
+// ConfigPath returns the kind config passed through as is, if any.
+func (o KindOptions) ConfigPath() string { return o.ConfigFile }
+
+// ResolvePaths resolves the config file and the mount host paths, which
+// docker requires to be absolute.
+func (o *KindOptions) ResolvePaths(resolve func(string) string) {
+	o.ConfigFile = resolve(o.ConfigFile)
+	if len(o.Mounts) == 0 {
+		return
+	}
+	mounts := make([]Mount, len(o.Mounts))
+	for i, m := range o.Mounts {
+		if abs, err := filepath.Abs(resolve(m.HostPath)); err == nil {
+			m.HostPath = abs
+		}
+		mounts[i] = m
+	}
+	o.Mounts = mounts
+}
+
+// generates reports whether a kind config must be generated; the node image
+// alone is passed with --image instead.
+func (o KindOptions) generates() bool {
+	return o.ConfigFile == "" && (o.ControlPlanes > 0 || o.Workers > 0 || len(o.Nodes) > 0 ||
+		len(o.PortMappings) > 0 || len(o.Mounts) > 0 || len(o.mirrors) > 0)
+}
+
+// Validate checks the options for mistakes kind would only report after
+// pulling node images.
+func (o KindOptions) Validate() error {
+	var errs []error
+	if o.ConfigFile != "" {
+		if o.ControlPlanes != 0 || o.Workers != 0 || len(o.Nodes) > 0 || len(o.PortMappings) > 0 || len(o.Mounts) > 0 {
+			errs = append(errs, errors.New("kind.config cannot be combined with generated node settings"))
+		}
+		if len(o.mirrors) > 0 {
+			errs = append(errs, errors.New("kind.config cannot be combined with a local registry or cache"))
+		}
+		if _, err := os.Stat(o.ConfigFile); err != nil {
+			errs = append(errs, fmt.Errorf("kind config file %s not found or unreadable: %w", o.ConfigFile, err))
+		}
+	}
+	if len(o.Nodes) > 0 && (o.ControlPlanes != 0 || o.Workers != 0) {
+		errs = append(errs, errors.New("kind.nodes cannot be combined with kind.controlPlanes/kind.workers"))
+	}
+	if o.ControlPlanes < 0 || o.Workers < 0 {
+		errs = append(errs, errors.New("kind node counts must not be negative"))
+	}
+	controlPlanes := 0
+	for i, n := range o.Nodes {
+		switch n.Role {
+		case "control-plane":
+			controlPlanes++
+		case "worker":
+		default:
+			errs = append(errs, fmt.Errorf("kind.nodes[%d]: unknown role %q (expected control-plane or worker)", i, n.Role))
+		}
+		for _, t := range n.Taints {
+			if _, err := parseTaint(t); err != nil {
+				errs = append(errs, fmt.Errorf("kind.nodes[%d]: %w", i, err))
+			}
+		}
+	}
+	if len(o.Nodes) > 0 && controlPlanes == 0 {
+		errs = append(errs, errors.New("kind.nodes must include at least one control-plane node"))
+	}
+	for i, pm := range o.PortMappings {
+		if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 || pm.HostPort < 0 || pm.HostPort > 65535 {
+			errs = append(errs, fmt.Errorf("kind.portMappings[%d]: ports must be between 1 and 65535", i))
+		}
+		if p := strings.ToUpper(pm.Protocol); p != "" && p != "TCP" && p != "UDP" && p != "SCTP" {
+			errs = append(errs, fmt.Errorf("kind.portMappings[%d]: unknown protocol %q", i, pm.Protocol))
+		}
+	}
+	for i, m := range o.Mounts {
+		if m.HostPath == "" || m.ContainerPath == "" {
+			errs = append(errs, fmt.Errorf("kind.mounts[%d]: hostPath and containerPath are required", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// taint is the kubeadm nodeRegistration form of a taint.
+type taint struct {
+	Key    string `yaml:"key"`
+	Value  string `yaml:"value,omitempty"`
+	Effect string `yaml:"effect"`
+}
+
+// parseTaint parses key[=value]:Effect.
+func parseTaint(s string) (taint, error) {
+	kv, effect, ok := strings.Cut(s, ":")
+	if !ok || kv == "" {
+		return taint{}, fmt.Errorf("invalid taint %q: expected key[=value]:Effect", s)
+	}
+	switch effect {
+	case "NoSchedule", "PreferNoSchedule", "NoExecute":
+	default:
+		return taint{}, fmt.Errorf("invalid taint %q: effect must be NoSchedule, PreferNoSchedule or NoExecute", s)
+	}
+	key, value, _ := strings.Cut(kv, "=")
+	return taint{Key: key, Value: value, Effect: effect}, nil
+}
+
+// kindClusterConfig mirrors the subset of kind's v1alpha4 Cluster config
+// that kstack generates.
+type kindClusterConfig struct {
+	Kind                    string           `yaml:"kind"`
+	APIVersion              string           `yaml:"apiVersion"`
+	ContainerdConfigPatches []string         `yaml:"containerdConfigPatches,omitempty"`
+	Nodes                   []kindNodeConfig `yaml:"nodes"`
+}
+
+// kindRegistryPatch points containerd at /etc/containerd/certs.d, where a
+// hosts.toml per registry is written after the nodes start.
+const kindRegistryPatch = `[plugins."io.containerd.grpc.v1.cri".registry]
+  config_path = "/etc/containerd/certs.d"
+`
+
+type kindNodeConfig struct {
+	Role                 string            `yaml:"role"`
+	Image                string            `yaml:"image,omitempty"`
+	Labels               map[string]string `yaml:"labels,omitempty"`
+	ExtraPortMappings    []PortMapping     `yaml:"extraPortMappings,omitempty"`
+	ExtraMounts          []Mount           `yaml:"extraMounts,omitempty"`
+	KubeadmConfigPatches []string          `yaml:"kubeadmConfigPatches,omitempty"`
+}
+
+// nodes expands the counts shorthand into explicit nodes.
+func (o KindOptions) nodes() []KindNode {
+	if len(o.Nodes) > 0 {
+		return o.Nodes
+	}
+	cp := o.ControlPlanes
+	if cp == 0 {
+		cp = 1
+	}
+	out := make([]KindNode, 0, cp+o.Workers)
+	for i := 0; i < cp; i++ {
+		out = append(out, KindNode{Role: "control-plane"})
+	}
+	for i := 0; i < o.Workers; i++ {
+		out = append(out, KindNode{Role: "worker"})
+	}
+	return out
+}
+
+// GenerateKindConfig renders a kind v1alpha4 Cluster config for o.
+func GenerateKindConfig(o KindOptions) ([]byte, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	cfg := kindClusterConfig{Kind: "Cluster", APIVersion: "kind.x-k8s.io/v1alpha4"}
+	if len(o.mirrors) > 0 {
+		cfg.ContainerdConfigPatches = []string{kindRegistryPatch}
+	}
+	firstControlPlane := true
+	for _, n := range o.nodes() {
+		nc := kindNodeConfig{
+			Role:        n.Role,
+			Image:       o.Image,
+			Labels:      n.Labels,
+			ExtraMounts: o.Mounts,
+		}
+		// the first control-plane node is initialized, all others join
+		patchKind := "JoinConfiguration"
+		if n.Role == "control-plane" && firstControlPlane {
+			firstControlPlane = false
+			patchKind = "InitConfiguration"
+			nc.ExtraPortMappings = o.PortMappings
+		}
+		if len(n.Taints) > 0 {
+			patch, err := taintPatch(patchKind, n.Taints)
+			if err != nil {
+				return nil, err
+			}
+			nc.KubeadmConfigPatches = []string{patch}
+		}
+		cfg.Nodes = append(cfg.Nodes, nc)
+	}
+	return yaml.Marshal(cfg)
+}
+
+// taintPatch returns a kubeadm config patch registering the node with taints.
+func taintPatch(kind string, taints []string) (string, error) {
+	ts := make([]taint, 0, len(taints))
+	for _, s := range taints {
+		t, err := parseTaint(s)
+		if err != nil {
+			return "", err
+		}
+		ts = append(ts, t)
+	}
+	patch := map[string]any{
+		"kind":             kind,
+		"nodeRegistration": map[string]any{"taints": ts},
+	}
+	b, err := yaml.Marshal(patch)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestGenerateKindConfig_CountsAndExtras(t *testing.T) {
+	b, err := GenerateKindConfig(KindOptions{
+		Image:        "kindest/node:v1.30.0",
+		Workers:      2,
+		PortMappings: []PortMapping{{ContainerPort: 30080, HostPort: 8080}},
+		Mounts:       []Mount{{HostPath: "/data", ContainerPath: "/data"}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateKindConfig: %v", err)
+	}
+	var got kindClusterConfig
+	if err := yaml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unmarshal generated config: %v\n%s", err, b)
+	}
+	if got.Kind != "Cluster" || got.APIVersion != "kind.x-k8s.io/v1alpha4" {
+		t.Fatalf("unexpected header: %+v", got)
+	}
+	if len(got.Nodes) != 3 || got.Nodes[0].Role != "control-plane" || got.Nodes[1].Role != "worker" || got.Nodes[2].Role != "worker" {
+		t.Fatalf("unexpected nodes: %+v", got.Nodes)
+	}
+	if len(got.Nodes[0].ExtraPortMappings) != 1 || len(got.Nodes[1].ExtraPortMappings) != 0 {
+		t.Fatalf("port mappings should only be on the first control-plane: %+v", got.Nodes)
+	}
+	for _, n := range got.Nodes {
+		if n.Image != "kindest/node:v1.30.0" || len(n.ExtraMounts) != 1 {
+			t.Fatalf("image and mounts should apply to every node: %+v", n)
+		}
+	}
+}
+
+func TestGenerateKindConfig_LabelsAndTaints(t *testing.T) {
+	b, err := GenerateKindConfig(KindOptions{Nodes: []KindNode{
+		{Role: "control-plane"},
+		{Role: "worker", Labels: map[string]string{"tier": "db"}, Taints: []string{"dedicated=db:NoSchedule"}},
+	}})
+	if err != nil {
+		t.Fatalf("GenerateKindConfig: %v", err)
+	}
+	s := string(b)
+	for _, want := range []string{"tier: db", "kind: JoinConfiguration", "key: dedicated", "value: db", "effect: NoSchedule"} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("expected %q in generated config:\n%s", want, s)
+		}
+	}
+}
+
+func TestKindOptions_Validate(t *testing.T) {
+	cases := map[string]KindOptions{
+		"bad role":        {Nodes: []KindNode{{Role: "control-plane"}, {Role: "master"}}},
+		"no control":      {Nodes: []KindNode{{Role: "worker"}}},
+		"bad taint":       {Nodes: []KindNode{{Role: "control-plane", Taints: []string{"x=y"}}}},
+		"mixed":           {Workers: 1, Nodes: []KindNode{{Role: "control-plane"}}},
+		"bad port":        {PortMappings: []PortMapping{{ContainerPort: 0, HostPort: 80}}},
+		"missing config":  {ConfigFile: "/no/such/kind.yaml"},
+		"config + counts": {ConfigFile: "/no/such/kind.yaml", Workers: 2},
+	}
+	for name, o := range cases {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+	if err := (KindOptions{}).Validate(); err != nil {
+		t.Fatalf("zero options should be valid: %v", err)
+	}
+}
+
+func TestKindProvider_Create_PassesGeneratedConfig(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	script := "#!/usr/bin/env bash\nif [ \"$1\" = \"create\" ]; then echo \"$@\" > " + argsFile + "; for a in \"$@\"; do if [ -n \"$prev\" ]; then cp \"$a\" " + argsFile + ".cfg; prev=; fi; [ \"$a\" = \"--config\" ] && prev=1; done; fi\nexit 0\n"
+	writeFakeCmd(t, "kind", script)
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+
+	p := NewKindProviderWithOptions("gc-multi", KindOptions{Image: "kindest/node:v1.30.0", Workers: 1})
+	if err := p.Create(context.Background()); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("read recorded args: %v", err)
+	}
+	if !strings.Contains(string(args), "--image kindest/node:v1.30.0") || !strings.Contains(string(args), "--config") {
+		t.Fatalf("unexpected kind args: %s", args)
+	}
+	cfg, err := os.ReadFile(argsFile + ".cfg")
+	if err != nil {
+		t.Fatalf("generated config was not readable during create: %v", err)
+	}
+	if !strings.Contains(string(cfg), "role: worker") {
+		t.Fatalf("unexpected generated config:\n%s", cfg)
+	}
+}
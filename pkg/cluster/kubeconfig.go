@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// clusterStateDir is the directory under the kstack state dir holding
+// everything kstack keeps for one cluster.
+func clusterStateDir(provider, name string) string {
+	return filepath.Join(utils.StateDir(), "clusters", provider+"-"+name)
+}
+
+// KubeconfigFile returns the stable path of the kubeconfig kstack manages
+// for a cluster. The internal variant addresses the API server from inside
+// the Docker network.
+func KubeconfigFile(provider, name string, internal bool) string {
+	file := "kubeconfig"
+	if internal {
+		file = "kubeconfig-internal"
+	}
+	return filepath.Join(clusterStateDir(provider, name), file)
+}
+
+// writeKubeconfig stores b as the managed kubeconfig of a cluster,
+// overwriting the previous one, and returns its path.
+func writeKubeconfig(provider, name string, internal bool, b []byte) (string, error) {
+	path := KubeconfigFile(provider, name, internal)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create kubeconfig dir: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+	utils.Debug("wrote %s kubeconfig to %s", provider, path)
+	return path, nil
+}
+
+// RemoveKubeconfig deletes the managed kubeconfigs of a cluster.
+func RemoveKubeconfig(provider, name string) error {
+	if err := os.RemoveAll(clusterStateDir(provider, name)); err != nil {
+		return fmt.Errorf("failed to remove kubeconfig: %w", err)
+	}
+	return nil
+}
+
+// internal interface implemented by providers whose API server can be
+// reached from other containers on the Docker network.
+type internalKubeconfiger interface {
+	internalKubeconfig(ctx context.Context) ([]byte, error)
+}
+
+// InternalKubeconfigPath writes and returns a kubeconfig addressing the API
+// server by its in-Docker-network address, as needed by devcontainers. It
+// returns "" in dry-run mode.
+func InternalKubeconfigPath(ctx context.Context, p Provider) (string, error) {
+	ik, ok := p.(internalKubeconfiger)
+	if !ok {
+		return "", fmt.Errorf("provider %s has no in-network kubeconfig", p.Provider())
+	}
+	b, err := ik.internalKubeconfig(ctx)
+	if err != nil || b == nil {
+		return "", err
+	}
+	return writeKubeconfig(p.Provider(), p.Name(), true, b)
+}
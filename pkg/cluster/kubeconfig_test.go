@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestK3dProvider_ManagedKubeconfig(t *testing.T) {
+	writeFakeCmd(t, "k3d", "#!/usr/bin/env bash\nif [ \"$1\" = \"kubeconfig\" ]; then printf 'apiVersion: v1\\nkind: Config\\ncurrent-context: k3d-gc-kc\\nclusters:\\n- {name: k3d-gc-kc, cluster: {server: \"https://0.0.0.0:41000\"}}\\n'; fi\nexit 0\n")
+	p := NewK3dProvider("gc-kc")
+	ctx := context.Background()
+
+	first, err := p.KubeconfigPath(ctx)
+	if err != nil {
+		t.Fatalf("KubeconfigPath: %v", err)
+	}
+	second, err := p.KubeconfigPath(ctx)
+	if err != nil || second != first || first != KubeconfigFile("k3d", "gc-kc", false) {
+		t.Fatalf("kubeconfig path should be stable: %q, %q (%v)", first, second, err)
+	}
+	if fi, err := os.Stat(first); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("managed kubeconfig mode: %v %v", fi, err)
+	}
+
+	internal, err := InternalKubeconfigPath(ctx, p)
+	if err != nil {
+		t.Fatalf("InternalKubeconfigPath: %v", err)
+	}
+	b, _ := os.ReadFile(internal)
+	if !strings.Contains(string(b), "https://k3d-gc-kc-serverlb:6443") {
+		t.Fatalf("internal kubeconfig should use the load balancer address:\n%s", b)
+	}
+
+	if err := RemoveKubeconfig("k3d", "gc-kc"); err != nil {
+		t.Fatalf("RemoveKubeconfig: %v", err)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Fatalf("managed kubeconfig should be removed, stat err=%v", err)
+	}
+
+	if _, err := InternalKubeconfigPath(ctx, NewExistingProvider("x", "", "")); err == nil {
+		t.Fatalf("existing clusters have no in-network kubeconfig")
+	}
+}
@@ -0,0 +1,168 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/christk1/kstack/pkg/kubeconfig"
+	"github.com/christk1/kstack/utils"
+)
+
+const (
+	defaultRegistryName  = "kstack-registry"
+	defaultRegistryPort  = 5001
+	defaultRegistryImage = "registry:2"
+	// registryLabel marks registry containers with the cluster they were
+	// created for, so that `down` can find them without configuration.
+	registryLabel = "dev.kstack.registry-for"
+)
+
+// registryNameRe matches valid Docker container names.
+var registryNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// LocalRegistry is a registry container provisioned next to the cluster.
+// Images pushed to localhost:<Port> can be pulled by the cluster's nodes
+// under the same name.
+type LocalRegistry struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Name is the container name (default kstack-registry).
+	Name string `yaml:"name,omitempty"`
+	// Port is the host port on 127.0.0.1 (default 5001).
+	Port int `yaml:"port,omitempty"`
+	// Keep leaves the registry (and its images) in place on `down`.
+	Keep bool `yaml:"keep,omitempty"`
+}
+
+// WithDefaults returns r with the default name and port filled in.
+func (r LocalRegistry) WithDefaults() LocalRegistry {
+	if r.Name == "" {
+		r.Name = defaultRegistryName
+	}
+	if r.Port == 0 {
+		r.Port = defaultRegistryPort
+	}
+	return r
+}
+
+// Host is the address images are pushed to and pulled from, e.g. localhost:5001.
+func (r LocalRegistry) Host() string {
+	return "localhost:" + strconv.Itoa(r.WithDefaults().Port)
+}
+
+// mirror is the containerd mirror serving Host from the registry container.
+func (r LocalRegistry) mirror() mirror {
+	r = r.WithDefaults()
+	return mirror{Registry: r.Host(), Container: r.Name}
+}
+
+// Validate checks the registry settings.
+func (r LocalRegistry) Validate() error {
+	var errs []error
+	if r.Port < 0 || r.Port > 65535 {
+		errs = append(errs, fmt.Errorf("registry.port must be between 1 and 65535, got %d", r.Port))
+	}
+	if r.Name != "" && !registryNameRe.MatchString(r.Name) {
+		errs = append(errs, fmt.Errorf("invalid registry.name %q: use letters, digits, '_', '.' and '-'", r.Name))
+	}
+	return errors.Join(errs...)
+}
+
+// registryInspectFormat prints whether a registry container is running,
+// the cluster it was created for and its published host port.
+const registryInspectFormat = `{{.State.Running}}|{{index .Config.Labels "` + registryLabel + `"}}|{{range (index .HostConfig.PortBindings "5000/tcp")}}{{.HostPort}}{{end}}`
+
+// EnsureRegistry starts the registry container for cluster (a
+// "<provider>-<name>" key) unless it already exists. An existing container
+// of that name created for another cluster or on another port is an error,
+// as `down` of its cluster would remove it and Host would not reach it.
+func EnsureRegistry(ctx context.Context, r LocalRegistry, cluster string, dryRun bool) error {
+	r = r.WithDefaults()
+	args := []string{"run", "-d", "--restart=always", "-p", "127.0.0.1:" + strconv.Itoa(r.Port) + ":5000",
+		"--label", registryLabel + "=" + cluster, "--name", r.Name, defaultRegistryImage}
+	if dryRun {
+		utils.Info("DRY-RUN: docker %s", strings.Join(args, " "))
+		return nil
+	}
+	out, err := utils.Command(ctx, "docker", "inspect", "-f", registryInspectFormat, r.Name).CombinedOutput()
+	if err == nil {
+		running, rest, _ := strings.Cut(strings.TrimSpace(string(out)), "|")
+		owner, port, _ := strings.Cut(rest, "|")
+		switch {
+		case owner == "":
+			return fmt.Errorf("container %s exists but was not created by kstack; remove it or set registry.name", r.Name)
+		case owner != cluster:
+			return fmt.Errorf("registry %s belongs to cluster %s; set registry.name to give this cluster its own registry", r.Name, owner)
+		case port != strconv.Itoa(r.Port):
+			return fmt.Errorf("registry %s publishes port %s, not %d; set registry.port to %s or run `kstack down` to recreate it", r.Name, port, r.Port, port)
+		}
+		if running != "true" {
+			if out, err := utils.Command(ctx, "docker", "start", r.Name).CombinedOutput(); err != nil {
+				return fmt.Errorf("docker start %s failed: %w: %s", r.Name, err, string(out))
+			}
+		}
+		utils.Info("using existing registry %s at %s", r.Name, r.Host())
+		return nil
+	}
+	utils.Info("creating registry %s at %s", r.Name, r.Host())
+	out, err = utils.Command(ctx, "docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker run registry failed: %w: %s", err, string(out))
+	}
+	return nil
+}
+
+// DeleteRegistries removes the registry containers created for cluster (a
+// "<provider>-<name>" key) and returns their names.
+func DeleteRegistries(ctx context.Context, cluster string, dryRun bool) ([]string, error) {
+	filter := "label=" + registryLabel + "=" + cluster
+	if dryRun {
+		utils.Info("DRY-RUN: docker rm -f $(docker ps -a -q --filter %s)", filter)
+		return nil, nil
+	}
+	out, err := utils.Command(ctx, "docker", "ps", "-a", "--filter", filter, "--format", "{{.Names}}").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("docker ps failed: %w: %s", err, string(out))
+	}
+	names := strings.Fields(string(out))
+	for _, name := range names {
+		if out, err := utils.Command(ctx, "docker", "rm", "-f", name).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("docker rm %s failed: %w: %s", name, err, string(out))
+		}
+	}
+	return names, nil
+}
+
+// PublishRegistryHosting creates or updates the local-registry-hosting
+// ConfigMap in kube-public (KEP-1755) so that tools discover the registry.
+func PublishRegistryHosting(ctx context.Context, kubePath, contextName string, r LocalRegistry, dryRun bool) error {
+	if dryRun {
+		utils.Info("DRY-RUN: apply ConfigMap kube-public/local-registry-hosting (host %s)", r.Host())
+		return nil
+	}
+	data := map[string]string{
+		"localRegistryHosting.v1": fmt.Sprintf("host: %q\nhelp: %q\n", r.Host(), "https://kind.sigs.k8s.io/docs/user/local-registry/"),
+	}
+	if err := kubeconfig.ApplyConfigMap(ctx, kubePath, contextName, "kube-public", "local-registry-hosting", data); err != nil {
+		return fmt.Errorf("publish local-registry-hosting: %w", err)
+	}
+	return nil
+}
+
+// SetRegistry wires a provider to a local registry; its cluster will pull
+// from it once created. Returns an error for providers that cannot.
+func SetRegistry(p Provider, r LocalRegistry) error {
+	if !r.Enabled {
+		return nil
+	}
+	return addMirrors(p, "local registry", r.mirror())
+}
+
+// AttachRegistry connects the registry container to the cluster's Docker
+// network. It is safe to call for clusters that are already attached.
+func AttachRegistry(ctx context.Context, p Provider, r LocalRegistry, dryRun bool) error {
+	return attachContainers(ctx, p, "local registry", []string{r.WithDefaults().Name}, dryRun)
+}
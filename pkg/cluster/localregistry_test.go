@@ -0,0 +1,121 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateConfigs_WithRegistry(t *testing.T) {
+	r := LocalRegistry{Enabled: true}.WithDefaults()
+
+	b, err := GenerateKindConfig(KindOptions{mirrors: []mirror{r.mirror()}})
+	if err != nil {
+		t.Fatalf("GenerateKindConfig: %v", err)
+	}
+	if !strings.Contains(string(b), `config_path = "/etc/containerd/certs.d"`) || !strings.Contains(string(b), "role: control-plane") {
+		t.Fatalf("kind config missing registry patch:\n%s", b)
+	}
+
+	b, err = GenerateK3dConfig("gc", K3dOptions{mirrors: []mirror{r.mirror()}})
+	if err != nil {
+		t.Fatalf("GenerateK3dConfig: %v", err)
+	}
+	if !strings.Contains(string(b), `localhost:5001:`) || !strings.Contains(string(b), "http://kstack-registry:5000") {
+		t.Fatalf("k3d config missing registry mirror:\n%s", b)
+	}
+
+	cfgFile := filepath.Join(t.TempDir(), "kind.yaml")
+	os.WriteFile(cfgFile, []byte("kind: Cluster\n"), 0o600)
+	if err := (KindOptions{ConfigFile: cfgFile, mirrors: []mirror{r.mirror()}}).Validate(); err == nil {
+		t.Fatalf("expected error combining kind.config with a registry")
+	}
+}
+
+func TestKindProvider_Create_WithRegistry(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "docker-args")
+	hostsFile := filepath.Join(dir, "hosts")
+	writeFakeCmd(t, "kind", "#!/usr/bin/env bash\nif [ \"$1 $2\" = \"get nodes\" ]; then echo gc-reg-control-plane; fi\nexit 0\n")
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\nif [ \"$1\" = \"exec\" ]; then cat > "+hostsFile+"; fi\nexit 0\n")
+	p := NewKindProvider("gc-reg")
+	if err := SetRegistry(p, LocalRegistry{Enabled: true, Port: 5002}); err != nil {
+		t.Fatalf("SetRegistry: %v", err)
+	}
+	if err := p.Create(context.Background()); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if !strings.Contains(string(args), "exec -i gc-reg-control-plane") || !strings.Contains(string(args), "/etc/containerd/certs.d/localhost:5002/hosts.toml") {
+		t.Fatalf("unexpected docker invocations:\n%s", args)
+	}
+	hosts, _ := os.ReadFile(hostsFile)
+	if string(hosts) != "[host.\"http://kstack-registry:5000\"]\n  capabilities = [\"pull\", \"resolve\"]\n" {
+		t.Fatalf("unexpected hosts.toml: %q", hosts)
+	}
+}
+
+func TestRegistryContainer_Lifecycle(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	// inspect fails: no container yet; ps lists the registry for cleanup
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\n"+
+		"case \"$1\" in inspect) exit 1;; ps) echo kstack-registry;; network) echo 'endpoint with name kstack-registry already exists in network kind' >&2; exit 1;; esac\nexit 0\n")
+	ctx := context.Background()
+	r := LocalRegistry{Enabled: true}
+	if err := EnsureRegistry(ctx, r, "kind-gc", false); err != nil {
+		t.Fatalf("EnsureRegistry: %v", err)
+	}
+	if err := AttachRegistry(ctx, NewKindProvider("gc"), r, false); err != nil {
+		t.Fatalf("AttachRegistry should tolerate an existing connection: %v", err)
+	}
+	names, err := DeleteRegistries(ctx, "kind-gc", false)
+	if err != nil || len(names) != 1 || names[0] != "kstack-registry" {
+		t.Fatalf("DeleteRegistries = %v, %v", names, err)
+	}
+	b, _ := os.ReadFile(argsFile)
+	for _, want := range []string{
+		"run -d --restart=always -p 127.0.0.1:5001:5000 --label dev.kstack.registry-for=kind-gc --name kstack-registry registry:2",
+		"network connect kind kstack-registry",
+		"ps -a --filter label=dev.kstack.registry-for=kind-gc",
+		"rm -f kstack-registry",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("missing docker %q in:\n%s", want, b)
+		}
+	}
+
+	if err := SetRegistry(NewMinikubeProvider("gc"), r); err == nil {
+		t.Fatalf("expected error for provider without registry support")
+	}
+}
+
+func TestEnsureRegistry_ExistingContainer(t *testing.T) {
+	dir := t.TempDir()
+	inspect := filepath.Join(dir, "inspect")
+	argsFile := filepath.Join(dir, "args")
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\nif [ \"$1\" = inspect ]; then cat "+inspect+"; fi\nexit 0\n")
+	cases := []struct{ inspect, wantErr, wantArgs string }{
+		{inspect: "true|kind-gc|5001"},
+		{inspect: "false|kind-gc|5001", wantArgs: "start kstack-registry"},
+		{inspect: "true|k3d-other|5001", wantErr: "belongs to cluster k3d-other"},
+		{inspect: "true||5001", wantErr: "not created by kstack"},
+		{inspect: "true|kind-gc|5002", wantErr: "publishes port 5002, not 5001"},
+	}
+	for _, tc := range cases {
+		os.WriteFile(inspect, []byte(tc.inspect+"\n"), 0o644)
+		os.Remove(argsFile)
+		err := EnsureRegistry(context.Background(), LocalRegistry{Enabled: true}, "kind-gc", false)
+		if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Fatalf("%s: expected error %q, got %v", tc.inspect, tc.wantErr, err)
+		}
+		b, _ := os.ReadFile(argsFile)
+		if strings.Contains(string(b), "run ") {
+			t.Fatalf("%s: an existing registry must not be recreated:\n%s", tc.inspect, b)
+		}
+		if tc.wantArgs != "" && !strings.Contains(string(b), tc.wantArgs) {
+			t.Fatalf("%s: missing docker %q in:\n%s", tc.inspect, tc.wantArgs, b)
+		}
+	}
+}
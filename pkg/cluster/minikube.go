@@ -0,0 +1,251 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/christk1/kstack/pkg/kubeconfig"
+	"github.com/christk1/kstack/pkg/preflight"
+	"github.com/christk1/kstack/utils"
+)
+
+func init() {
+	Register(Spec{
+		Name:         "minikube",
+		Binaries:     []Binary{{Name: "minikube", InstallURL: "https://minikube.sigs.k8s.io/docs/start/"}, {Name: "docker", InstallURL: "https://docs.docker.com/get-docker/"}},
+		Checks:       []Check{{Name: "docker", Run: preflight.CheckDocker}},
+		Capabilities: []Capability{CapManaged, CapImageLoad},
+		ValidateK8sVersion: func(v string) error {
+			_, err := minikubeK8sVersion(v)
+			return err
+		},
+		New: func(o Options) Provider { return NewMinikubeProvider(o.Name) },
+	})
+}
+
+// minikubeProvider implements Provider by invoking the `minikube` CLI with
+// the Docker driver. The cluster name is used as the minikube profile.
+type minikubeProvider struct {
+	name       string
+	k8sVersion string
+	DryRun     bool
+}
+
+func NewMinikubeProvider(name string) Provider { return &minikubeProvider{name: name} }
+
+func (p *minikubeProvider) Create(ctx context.Context) error {
+	if !p.DryRun {
+		if err := p.preflight(ctx); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"start", "-p", p.name, "--driver=docker"}
+	if p.k8sVersion != "" {
+		v, err := minikubeK8sVersion(p.k8sVersion)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--kubernetes-version="+v)
+	}
+
+	if p.DryRun {
+		utils.Info("DRY-RUN: minikube %s", strings.Join(args, " "))
+		return nil
+	}
+
+	// minikube start -p <name> --driver=docker [--kubernetes-version=<v>]
+	utils.Debug("running: minikube %s", strings.Join(args, " "))
+	cmd := utils.Command(ctx, "minikube", args...)
+	out, err := utils.Run(cmd, "minikube")
+	if err != nil {
+		return fmt.Errorf("minikube start failed: %w: %s", err, utils.Tail(out))
+	}
+	return nil
+}
+
+func (p *minikubeProvider) Delete(ctx context.Context) error {
+	if p.DryRun {
+		utils.Info("DRY-RUN: minikube delete -p %s", p.name)
+		return nil
+	}
+	cmd := utils.Command(ctx, "minikube", "delete", "-p", p.name)
+	out, err := utils.Run(cmd, "minikube")
+	if err != nil {
+		return fmt.Errorf("minikube delete failed: %w: %s", err, utils.Tail(out))
+	}
+	return nil
+}
+
+// minikubeProfiles is the output of `minikube profile list -o json`.
+type minikubeProfiles struct {
+	Valid   []struct{ Name string } `json:"valid"`
+	Invalid []struct{ Name string } `json:"invalid"`
+}
+
+func (p *minikubeProvider) Exists(ctx context.Context) (bool, error) {
+	if p.DryRun {
+		utils.Info("DRY-RUN: minikube profile list -o json (assume not exists)")
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	// Only stdout holds the JSON; minikube logs hints to stderr.
+	cmd := utils.Command(ctx, "minikube", "profile", "list", "-o", "json")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// minikube exits non-zero when no profile exists yet
+		if strings.Contains(string(out)+stderr.String(), "No minikube profile was found") {
+			return false, nil
+		}
+		return false, fmt.Errorf("minikube profile list failed: %w: %s%s", err, string(out), stderr.String())
+	}
+	var profiles minikubeProfiles
+	if err := json.Unmarshal(out, &profiles); err != nil {
+		return false, fmt.Errorf("parse minikube profile list: %w", err)
+	}
+	for _, pr := range append(profiles.Valid, profiles.Invalid...) {
+		if pr.Name == p.name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// KubeconfigPath extracts the profile's context from the user's kubeconfig
+// into the managed kubeconfig, as minikube has no command printing a
+// kubeconfig. The user's kubeconfig is only read.
+func (p *minikubeProvider) KubeconfigPath(ctx context.Context) (string, error) {
+	c, err := p.getKubeconfig(ctx)
+	if err != nil || c == nil {
+		return "", err
+	}
+	b, err := c.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	return writeKubeconfig("minikube", p.name, false, b)
+}
+
+// internalKubeconfig implements internal internalKubeconfiger: with the
+// Docker driver the node container is named after the profile and serves
+// the API on 8443 inside the profile's network.
+func (p *minikubeProvider) internalKubeconfig(ctx context.Context) ([]byte, error) {
+	c, err := p.getKubeconfig(ctx)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	c.SetServer("https://" + p.name + ":8443")
+	return c.Marshal()
+}
+
+// getKubeconfig returns the profile's context from the user's kubeconfig,
+// with credentials inlined, or nil in dry-run mode. It reads through
+// `minikube kubectl` rather than `minikube update-context`, which would
+// rewrite the user's kubeconfig.
+func (p *minikubeProvider) getKubeconfig(ctx context.Context) (*kubeconfig.Config, error) {
+	args := []string{"-p", p.name, "kubectl", "--", "config", "view", "--minify", "--flatten", "--context", p.name}
+	if p.DryRun {
+		utils.Info("DRY-RUN: minikube %s", strings.Join(args, " "))
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	// Only stdout holds the kubeconfig; minikube logs hints to stderr.
+	cmd := utils.Command(ctx, "minikube", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("minikube kubectl config view failed: %w: %s", err, stderr.String())
+	}
+	full, err := kubeconfig.Parse(out)
+	if err != nil {
+		return nil, err
+	}
+	mini, err := full.Minify(p.name)
+	if err != nil {
+		return nil, fmt.Errorf("minikube context in %s: %w", kubeconfig.DefaultPath(), err)
+	}
+	return mini, nil
+}
+
+// loadImages implements internal imageLoader with `minikube image load`,
+// which loads into every node of the profile.
+func (p *minikubeProvider) loadImages(ctx context.Context, images []string) ([]string, error) {
+	args := append([]string{"image", "load"}, images...)
+	args = append(args, "-p", p.name)
+	if p.DryRun {
+		utils.Info("DRY-RUN: minikube %s", strings.Join(args, " "))
+		return nil, nil
+	}
+	if err := checkLocalImages(ctx, images); err != nil {
+		return nil, err
+	}
+	utils.Debug("running: minikube %s", strings.Join(args, " "))
+	out, err := utils.Run(utils.Command(ctx, "minikube", args...), "minikube")
+	if err != nil {
+		return nil, fmt.Errorf("minikube image load failed: %w: %s", err, utils.Tail(out))
+	}
+	// one "<node> <ip>" line per node
+	out, err = utils.Command(ctx, "minikube", "node", "list", "-p", p.name).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("minikube node list failed: %w: %s", err, string(out))
+	}
+	var nodes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) > 0 {
+			nodes = append(nodes, f[0])
+		}
+	}
+	return nodes, nil
+}
+
+// minikubeK8sVersion converts a pinned version to minikube's
+// --kubernetes-version form. minikube needs an exact patch release.
+func minikubeK8sVersion(v string) (string, error) {
+	minor, patch, err := ParseK8sVersion(v)
+	if err != nil {
+		return "", err
+	}
+	if patch == "" {
+		return "", fmt.Errorf("minikube needs an exact Kubernetes patch version (e.g. %s.0), got %s", minor, v)
+	}
+	return "v" + patch, nil
+}
+
+func (p *minikubeProvider) preflight(ctx context.Context) error {
+	ctx1, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := utils.Command(ctx1, "minikube", "version").Run(); err != nil {
+		return fmt.Errorf("minikube CLI not found or not executable: %w", err)
+	}
+	ctx2, cancel2 := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel2()
+	if err := utils.Command(ctx2, "docker", "info").Run(); err != nil {
+		return fmt.Errorf("docker does not appear to be available/running: %w", err)
+	}
+	return nil
+}
+
+func (p *minikubeProvider) Name() string     { return p.name }
+func (p *minikubeProvider) Provider() string { return "minikube" }
+
+// setDryRun implements internal dryRunnable
+func (p *minikubeProvider) setDryRun(d bool) { p.DryRun = d }
+
+// setK8sVersion and checkK8sVersion implement internal versionPinnable
+func (p *minikubeProvider) setK8sVersion(v string) { p.k8sVersion = v }
+
+func (p *minikubeProvider) checkK8sVersion(context.Context) error {
+	if p.k8sVersion == "" {
+		return nil
+	}
+	_, err := minikubeK8sVersion(p.k8sVersion)
+	return err
+}
@@ -0,0 +1,135 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/christk1/kstack/pkg/kubeconfig"
+)
+
+func TestMinikubeProvider_DryRunPaths(t *testing.T) {
+	p, err := New("minikube", Options{Name: "gc-mk"})
+	if err != nil {
+		t.Fatalf("New(minikube): %v", err)
+	}
+	SetDryRun(p, true)
+	if err := SetK8sVersion(p, "1.30.4"); err != nil {
+		t.Fatalf("SetK8sVersion: %v", err)
+	}
+	ctx := context.Background()
+	if err := p.Create(ctx); err != nil {
+		t.Fatalf("Create dry-run failed: %v", err)
+	}
+	if err := p.Delete(ctx); err != nil {
+		t.Fatalf("Delete dry-run failed: %v", err)
+	}
+	if exists, err := p.Exists(ctx); err != nil || exists {
+		t.Fatalf("Exists dry-run = %v, %v; want false, nil", exists, err)
+	}
+	if path, err := p.KubeconfigPath(ctx); err != nil || path != "" {
+		t.Fatalf("KubeconfigPath dry-run = %q, %v; want empty", path, err)
+	}
+	if p.Provider() != "minikube" || p.Name() != "gc-mk" {
+		t.Fatalf("unexpected identity %s/%s", p.Provider(), p.Name())
+	}
+}
+
+func TestMinikubeProvider_WithFakeMinikube(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	script := "#!/usr/bin/env bash\n" +
+		"echo \"$@\" >> " + argsFile + "\n" +
+		"case \"$1\" in\n" +
+		"  version) echo 'minikube version: v1.33.1';;\n" +
+		"  profile) echo '{\"invalid\":[],\"valid\":[{\"Name\":\"other\"},{\"Name\":\"gc-mk\"}]}';;\n" +
+		"  -p) [ \"$3\" = kubectl ] && cat \"$KUBECONFIG\";;\n" +
+		"esac\nexit 0\n"
+	writeFakeCmd(t, "minikube", script)
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+
+	kc := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kc, []byte(`apiVersion: v1
+kind: Config
+current-context: other
+clusters:
+- {name: other, cluster: {server: "https://127.0.0.1:1"}}
+- {name: gc-mk, cluster: {server: "https://127.0.0.1:32771", certificate-authority: /home/dev/.minikube/ca.crt}}
+contexts:
+- {name: other, context: {cluster: other, user: other}}
+- {name: gc-mk, context: {cluster: gc-mk, user: gc-mk, namespace: default}}
+users:
+- {name: other, user: {token: x}}
+- {name: gc-mk, user: {client-certificate: /home/dev/.minikube/profiles/gc-mk/client.crt}}
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kc)
+
+	p := NewMinikubeProvider("gc-mk")
+	if err := SetK8sVersion(p, "v1.30.4"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if ok, err := p.Exists(ctx); err != nil || !ok {
+		t.Fatalf("Exists = %v, %v; want true", ok, err)
+	}
+	path, err := p.KubeconfigPath(ctx)
+	if err != nil {
+		t.Fatalf("KubeconfigPath: %v", err)
+	}
+	defer os.Remove(path)
+	got, err := kubeconfig.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CurrentContext != "gc-mk" || len(got.Clusters) != 1 || got.Clusters[0].Cluster.Server != "https://127.0.0.1:32771" || len(got.Users) != 1 {
+		t.Fatalf("unexpected extracted kubeconfig: %#v", got)
+	}
+	if err := p.Create(ctx); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := p.Delete(ctx); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	args, _ := os.ReadFile(argsFile)
+	for _, want := range []string{"-p gc-mk kubectl -- config view --minify --flatten --context gc-mk", "start -p gc-mk --driver=docker --kubernetes-version=v1.30.4", "delete -p gc-mk"} {
+		if !strings.Contains(string(args), want) {
+			t.Fatalf("expected %q in minikube invocations:\n%s", want, args)
+		}
+	}
+	if strings.Contains(string(args), "update-context") {
+		t.Fatalf("the user's kubeconfig must not be rewritten:\n%s", args)
+	}
+
+	other := NewMinikubeProvider("missing")
+	if ok, err := other.Exists(ctx); err != nil || ok {
+		t.Fatalf("Exists(missing) = %v, %v; want false", ok, err)
+	}
+}
+
+func TestMinikubeProvider_ErrorBranches(t *testing.T) {
+	writeFailCmd(t, "minikube", "#!/usr/bin/env bash\nif [ \"$1\" = \"profile\" ]; then echo '* No minikube profile was found.' >&2; exit 85; fi\nif [ \"$1\" = \"version\" ]; then exit 0; fi\necho boom >&2; exit 1\n")
+	writeFailCmd(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+	p := NewMinikubeProvider("gc-mk")
+	ctx := context.Background()
+	if ok, err := p.Exists(ctx); err != nil || ok {
+		t.Fatalf("no profiles should mean not exists, got %v, %v", ok, err)
+	}
+	if err := p.Create(ctx); err == nil || !strings.Contains(err.Error(), "minikube start failed") {
+		t.Fatalf("expected start error, got %v", err)
+	}
+	if err := p.Delete(ctx); err == nil {
+		t.Fatalf("expected delete error")
+	}
+	if _, err := p.KubeconfigPath(ctx); err == nil {
+		t.Fatalf("expected kubeconfig error")
+	}
+	if err := SetK8sVersion(p, "1.30"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Create(ctx); err == nil || !strings.Contains(err.Error(), "exact Kubernetes patch version") {
+		t.Fatalf("expected patch version error, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// mirror makes containerd pull images of Registry from a registry container
+// on the cluster's Docker network.
+type mirror struct {
+	// Registry is the host as written in image names, e.g. docker.io or
+	// localhost:5001.
+	Registry string
+	// Container is the name of the registry container serving it.
+	Container string
+	// Server is the upstream to fall back to; empty for a local registry.
+	Server string
+}
+
+// endpoint is the mirror's address inside the Docker network.
+func (m mirror) endpoint() string { return "http://" + m.Container + ":5000" }
+
+// hostsFile is the containerd hosts.toml configuring the mirror on a node.
+func (m mirror) hostsFile() string {
+	return "/etc/containerd/certs.d/" + m.Registry + "/hosts.toml"
+}
+
+// hostsTOML renders the hosts.toml for the mirror.
+func (m mirror) hostsTOML() string {
+	var b strings.Builder
+	if m.Server != "" {
+		fmt.Fprintf(&b, "server = %q\n\n", m.Server)
+	}
+	fmt.Fprintf(&b, "[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n", m.endpoint())
+	return b.String()
+}
+
+// k3sRegistries renders a k3s registries.yaml declaring the mirrors.
+func k3sRegistries(ms []mirror) (string, error) {
+	mirrors := make(map[string]map[string][]string, len(ms))
+	for _, m := range ms {
+		mirrors[m.Registry] = map[string][]string{"endpoint": {m.endpoint()}}
+	}
+	b, err := yaml.Marshal(map[string]any{"mirrors": mirrors})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// internal interface implemented by providers whose nodes can pull through
+// registry mirrors (the registry capability).
+type mirrorUser interface {
+	addMirrors(ms ...mirror)
+	// network is the Docker network the cluster's nodes are on.
+	network() string
+}
+
+// addMirrors configures mirrors for the cluster p creates. what names the
+// feature for the error returned by providers without mirror support.
+func addMirrors(p Provider, what string, ms ...mirror) error {
+	mu, ok := p.(mirrorUser)
+	if !ok {
+		return fmt.Errorf("provider %s does not support a %s", p.Provider(), what)
+	}
+	mu.addMirrors(ms...)
+	return nil
+}
+
+// attachContainers connects registry containers to the cluster's Docker
+// network so that nodes can reach them by name. Existing connections are
+// kept.
+func attachContainers(ctx context.Context, p Provider, what string, containers []string, dryRun bool) error {
+	mu, ok := p.(mirrorUser)
+	if !ok {
+		return fmt.Errorf("provider %s does not support a %s", p.Provider(), what)
+	}
+	network := mu.network()
+	for _, name := range containers {
+		if dryRun {
+			utils.Info("DRY-RUN: docker network connect %s %s", network, name)
+			continue
+		}
+		out, err := utils.Command(ctx, "docker", "network", "connect", network, name).CombinedOutput()
+		if err != nil && !strings.Contains(string(out), "already exists") {
+			return fmt.Errorf("docker network connect %s %s failed: %w: %s", network, name, err, string(out))
+		}
+	}
+	return nil
+}
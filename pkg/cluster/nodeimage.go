@@ -0,0 +1,109 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// internal interface implemented by providers whose nodes run from images
+// that can be pulled ahead of time (e.g. for offline bundles).
+type nodeImager interface {
+	// nodeImages returns the node image first, followed by any helper
+	// images the provider starts next to the nodes.
+	nodeImages(ctx context.Context) ([]string, error)
+	setNodeImage(img string)
+}
+
+// NodeImages returns the images the provider needs to create its cluster
+// with the current settings, node image first.
+func NodeImages(ctx context.Context, p Provider) ([]string, error) {
+	ni, ok := p.(nodeImager)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not run nodes from images kstack can bundle", p.Provider())
+	}
+	return ni.nodeImages(ctx)
+}
+
+// SetNodeImage makes the provider create its nodes from img.
+func SetNodeImage(p Provider, img string) error {
+	ni, ok := p.(nodeImager)
+	if !ok {
+		return fmt.Errorf("provider %s does not support setting the node image", p.Provider())
+	}
+	ni.setNodeImage(img)
+	return nil
+}
+
+// nodeImages implements internal nodeImager: an explicit image wins, then
+// the pinned version, then the newest image of the installed kind release.
+func (p *kindProvider) nodeImages(ctx context.Context) ([]string, error) {
+	if p.opts.Image != "" {
+		return []string{p.opts.Image}, nil
+	}
+	if p.k8sVersion != "" {
+		img, err := p.nodeImage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []string{img}, nil
+	}
+	kindVersion := newestKindRelease()
+	if !p.DryRun {
+		v, err := cliVersion(ctx, "kind", "version")
+		if err != nil {
+			return nil, err
+		}
+		kindVersion = v
+	}
+	_, images := kindImagesFor(kindVersion)
+	if images == nil {
+		return nil, fmt.Errorf("kind %s is too old; upgrade kind to %s or later", kindVersion, oldestKindRelease())
+	}
+	minors := sortedMinors(images)
+	newest := minors[0]
+	for _, m := range minors {
+		if compareVersions(m, newest) > 0 {
+			newest = m
+		}
+	}
+	return []string{"kindest/node:" + images[newest]}, nil
+}
+
+func (p *kindProvider) setNodeImage(img string) { p.opts.Image = img }
+
+// nodeImages implements internal nodeImager. Besides the k3s image, k3d
+// starts its load balancer and tools containers from images matching the
+// installed k3d release.
+func (p *k3dProvider) nodeImages(ctx context.Context) ([]string, error) {
+	var node string
+	switch {
+	case p.opts.Image != "":
+		node = p.opts.Image
+	case p.k8sVersion != "":
+		img, err := p.k3sImage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		node = img
+	default:
+		newest := ""
+		for m := range k3sImages {
+			if newest == "" || compareVersions(m, newest) > 0 {
+				newest = m
+			}
+		}
+		node = "rancher/k3s:" + k3sImages[newest]
+	}
+	if p.DryRun {
+		return []string{node}, nil
+	}
+	v, err := cliVersion(ctx, "k3d", "version")
+	if err != nil {
+		return nil, err
+	}
+	tag := strings.TrimPrefix(v, "v")
+	return []string{node, "ghcr.io/k3d-io/k3d-proxy:" + tag, "ghcr.io/k3d-io/k3d-tools:" + tag}, nil
+}
+
+func (p *k3dProvider) setNodeImage(img string) { p.opts.Image = img }
@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/christk1/kstack/pkg/preflight"
+)
+
+// Capability names an optional feature a provider supports.
+type Capability string
+
+const (
+	// CapManaged means kstack creates and deletes the cluster itself.
+	CapManaged Capability = "managed"
+	// CapImageLoad means local images can be loaded into the cluster nodes.
+	CapImageLoad Capability = "image-load"
+	// CapRegistry means nodes can pull from a local registry container.
+	CapRegistry Capability = "registry"
+)
+
+// Options carries the settings a provider is constructed from. Providers
+// ignore fields that do not apply to them.
+type Options struct {
+	// Name is the logical cluster name.
+	Name string
+	// Kubeconfig and Context point at an already running cluster; empty
+	// means the default kubeconfig and its current context.
+	Kubeconfig string
+	Context    string
+	// Settings are the provider's own settings, as returned by its
+	// Spec.NewSettings and decoded from the stack file; nil if none.
+	Settings Settings
+}
+
+// Settings are the settings of one provider, read from the stack file
+// section named after it (e.g. `kind:`). Each provider decodes and checks
+// its own; see Spec.NewSettings.
+type Settings interface {
+	// IsZero reports whether no customization was requested.
+	IsZero() bool
+	// Validate checks the settings for mistakes the provider would only
+	// report late.
+	Validate() error
+	// ResolvePaths rewrites the host paths in the settings with resolve,
+	// which anchors relative paths at the stack file.
+	ResolvePaths(resolve func(string) string)
+	// NodeImage is the node image the settings pin, if any.
+	NodeImage() string
+	// ConfigPath is the provider config file passed through as is, if any.
+	ConfigPath() string
+}
+
+// Binary is an executable a provider needs in PATH.
+type Binary struct {
+	Name string
+	// InstallURL is shown when the binary is missing.
+	InstallURL string
+}
+
+// Check is a named preflight check run before the provider is used.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Spec describes a cluster provider. Providers register a Spec from init()
+// so that the CLI can look them up by name.
+type Spec struct {
+	Name         string
+	Binaries     []Binary
+	Checks       []Check
+	Capabilities []Capability
+	// NewSettings returns empty settings to decode the provider's stack
+	// file section into. Nil means the provider takes no settings.
+	NewSettings func() Settings
+	// ValidateK8sVersion rejects pinned Kubernetes versions the provider
+	// cannot create, such as a minor version where an exact patch release is
+	// required. Nil accepts any version ParseK8sVersion accepts.
+	ValidateK8sVersion func(v string) error
+	// New constructs the provider for a cluster.
+	New func(o Options) Provider
+}
+
+// Has reports whether the provider supports capability c.
+func (s Spec) Has(c Capability) bool {
+	for _, have := range s.Capabilities {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Preflight verifies the provider's binaries are installed and runs its
+// preflight checks, stopping at the first failure.
+func (s Spec) Preflight(ctx context.Context) error {
+	for _, b := range s.Binaries {
+		if err := preflight.CheckBinary(b.Name, b.InstallURL); err != nil {
+			return err
+		}
+	}
+	for _, c := range s.Checks {
+		if err := c.Run(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var registry = map[string]Spec{}
+
+// Register registers a provider in the global registry.
+func Register(s Spec) {
+	registry[s.Name] = s
+}
+
+// Lookup returns a registered provider by name.
+func Lookup(name string) (Spec, error) {
+	if s, ok := registry[name]; ok {
+		return s, nil
+	}
+	return Spec{}, fmt.Errorf("unknown provider %q (expected one of: %s)", name, strings.Join(Names(), ", "))
+}
+
+// Names returns the sorted names of registered providers.
+func Names() []string {
+	out := make([]string, 0, len(registry))
+	for k := range registry {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// New constructs the named provider.
+func New(name string, o Options) (Provider, error) {
+	s, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.New(o), nil
+}
@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_BuiltinProviders(t *testing.T) {
+	if got := Names(); !reflect.DeepEqual(got, []string{"existing", "k3d", "kind", "minikube"}) {
+		t.Fatalf("Names() = %v", got)
+	}
+	kind, err := Lookup("kind")
+	if err != nil {
+		t.Fatalf("Lookup(kind): %v", err)
+	}
+	if !kind.Has(CapImageLoad) || !kind.Has(CapRegistry) || kind.NewSettings == nil {
+		t.Fatalf("unexpected kind spec: %v", kind.Capabilities)
+	}
+	if s, _ := Lookup("minikube"); s.Has(CapRegistry) || s.NewSettings != nil {
+		t.Fatalf("unexpected minikube spec: %v", s.Capabilities)
+	}
+	p, err := New("k3d", Options{Name: "gc-reg", Settings: &K3dOptions{Agents: 2}})
+	if err != nil {
+		t.Fatalf("New(k3d): %v", err)
+	}
+	if p.Provider() != "k3d" || p.Name() != "gc-reg" || p.(*k3dProvider).opts.Agents != 2 {
+		t.Fatalf("unexpected provider: %#v", p)
+	}
+	if _, err := New("nope", Options{}); err == nil || !strings.Contains(err.Error(), "existing, k3d, kind, minikube") {
+		t.Fatalf("expected unknown provider error listing providers, got %v", err)
+	}
+}
+
+func TestRegistry_CustomProviderPreflight(t *testing.T) {
+	checked := false
+	Register(Spec{
+		Name:     "fake",
+		Binaries: []Binary{{Name: "kstack-missing-fake-cli", InstallURL: "https://example.com/fake"}},
+		Checks:   []Check{{Name: "ok", Run: func(context.Context) error { checked = true; return nil }}},
+		New:      func(o Options) Provider { return &noopProvider{} },
+	})
+	defer delete(registry, "fake")
+
+	spec, err := Lookup("fake")
+	if err != nil {
+		t.Fatalf("Lookup(fake): %v", err)
+	}
+	if err := spec.Preflight(context.Background()); err == nil || !strings.Contains(err.Error(), "https://example.com/fake") {
+		t.Fatalf("expected missing binary error with install hint, got %v", err)
+	}
+	if checked {
+		t.Fatalf("checks must not run when a binary is missing")
+	}
+
+	spec.Binaries = nil
+	spec.Checks = append(spec.Checks, Check{Name: "broken", Run: func(context.Context) error { return errors.New("boom") }})
+	if err := spec.Preflight(context.Background()); err == nil || !checked {
+		t.Fatalf("expected checks to run and fail, checked=%v err=%v", checked, err)
+	}
+}
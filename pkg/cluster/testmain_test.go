@@ -0,0 +1,19 @@
+package cluster
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain keeps managed kubeconfigs written by the tests out of the real
+// kstack state directory.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "kstack-home-*")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("KSTACK_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// kindNodeImages lists, per kind release, the kindest/node image published
+// for each Kubernetes minor version. Images are only guaranteed to work with
+// the kind release they were built for (or later ones listed here).
+var kindNodeImages = map[string]map[string]string{
+	"v0.20.0": {"1.27": "v1.27.3", "1.26": "v1.26.6", "1.25": "v1.25.11", "1.24": "v1.24.15", "1.23": "v1.23.17"},
+	"v0.21.0": {"1.29": "v1.29.0", "1.28": "v1.28.0", "1.27": "v1.27.3", "1.26": "v1.26.6", "1.25": "v1.25.11"},
+	"v0.22.0": {"1.29": "v1.29.2", "1.28": "v1.28.7", "1.27": "v1.27.11", "1.26": "v1.26.14", "1.25": "v1.25.16"},
+	"v0.23.0": {"1.30": "v1.30.0", "1.29": "v1.29.4", "1.28": "v1.28.9", "1.27": "v1.27.13", "1.26": "v1.26.15", "1.25": "v1.25.16"},
+	"v0.24.0": {"1.31": "v1.31.0", "1.30": "v1.30.4", "1.29": "v1.29.8", "1.28": "v1.28.13", "1.27": "v1.27.16", "1.26": "v1.26.15"},
+	"v0.25.0": {"1.31": "v1.31.2", "1.30": "v1.30.6", "1.29": "v1.29.10", "1.28": "v1.28.15", "1.27": "v1.27.16", "1.26": "v1.26.15"},
+	"v0.26.0": {"1.32": "v1.32.0", "1.31": "v1.31.4", "1.30": "v1.30.8", "1.29": "v1.29.12"},
+	"v0.27.0": {"1.32": "v1.32.2", "1.31": "v1.31.6", "1.30": "v1.30.10", "1.29": "v1.29.14"},
+	"v0.29.0": {"1.33": "v1.33.1", "1.32": "v1.32.5", "1.31": "v1.31.9", "1.30": "v1.30.13"},
+	"v0.30.0": {"1.34": "v1.34.0", "1.33": "v1.33.4", "1.32": "v1.32.8", "1.31": "v1.31.12"},
+}
+
+// k3sImages lists the default rancher/k3s tag for each Kubernetes minor
+// version. An exact patch version maps directly to v<patch>-k3s1.
+var k3sImages = map[string]string{
+	"1.27": "v1.27.16-k3s1",
+	"1.28": "v1.28.15-k3s1",
+	"1.29": "v1.29.12-k3s1",
+	"1.30": "v1.30.8-k3s1",
+	"1.31": "v1.31.4-k3s1",
+	"1.32": "v1.32.0-k3s1",
+}
+
+// minK3dMajor is the oldest k3d major version kstack supports (v5 introduced
+// the SimpleConfig v1alpha4+ format and node filters used by kstack).
+const minK3dMajor = 5
+
+var k8sVersionRe = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?$`)
+
+// ParseK8sVersion normalizes a Kubernetes version such as "1.30", "v1.30"
+// or "1.30.4" into its minor ("1.30") and, if given, patch ("1.30.4") forms.
+func ParseK8sVersion(v string) (minor, patch string, err error) {
+	m := k8sVersionRe.FindStringSubmatch(strings.TrimSpace(v))
+	if m == nil {
+		return "", "", fmt.Errorf("invalid Kubernetes version %q: expected e.g. 1.30 or 1.30.4", v)
+	}
+	minor = m[1] + "." + m[2]
+	if m[3] != "" {
+		patch = minor + "." + m[3]
+	}
+	return minor, patch, nil
+}
+
+// KindNodeImage returns the kindest/node image for k8sVersion that works
+// with the given kind release (as printed by `kind version`, e.g. v0.23.0).
+func KindNodeImage(kindVersion, k8sVersion string) (string, error) {
+	minor, patch, err := ParseK8sVersion(k8sVersion)
+	if err != nil {
+		return "", err
+	}
+	release, images := kindImagesFor(kindVersion)
+	if images == nil {
+		return "", fmt.Errorf("kind %s is too old to pin Kubernetes versions; upgrade kind to %s or later", kindVersion, oldestKindRelease())
+	}
+	tag, ok := images[minor]
+	if !ok {
+		return "", fmt.Errorf("kind %s does not support Kubernetes %s (supported: %s); upgrade kind or choose another version", kindVersion, minor, strings.Join(sortedMinors(images), ", "))
+	}
+	if patch != "" && "v"+patch != tag {
+		return "", fmt.Errorf("kind %s publishes Kubernetes %s as %s, not v%s; pin %s instead", kindVersion, minor, tag, patch, minor)
+	}
+	utils.Debug("kind %s: using node images from kind %s", kindVersion, release)
+	return "kindest/node:" + tag, nil
+}
+
+// K3sImage returns the rancher/k3s image for k8sVersion.
+func K3sImage(k8sVersion string) (string, error) {
+	minor, patch, err := ParseK8sVersion(k8sVersion)
+	if err != nil {
+		return "", err
+	}
+	if patch != "" {
+		return "rancher/k3s:v" + patch + "-k3s1", nil
+	}
+	tag, ok := k3sImages[minor]
+	if !ok {
+		minors := make([]string, 0, len(k3sImages))
+		for m := range k3sImages {
+			minors = append(minors, m)
+		}
+		sort.Slice(minors, func(i, j int) bool { return compareVersions(minors[i], minors[j]) > 0 })
+		return "", fmt.Errorf("no k3s image known for Kubernetes %s (supported: %s); pass an exact patch version such as %s.0", minor, strings.Join(minors, ", "), minor)
+	}
+	return "rancher/k3s:" + tag, nil
+}
+
+// CheckK3dVersion returns an error if the installed k3d (as printed by
+// `k3d version`, e.g. v5.6.0) cannot run pinned k3s images.
+func CheckK3dVersion(k3dVersion string) error {
+	parts := strings.SplitN(strings.TrimPrefix(k3dVersion, "v"), ".", 2)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return fmt.Errorf("unrecognized k3d version %q", k3dVersion)
+	}
+	if major < minK3dMajor {
+		return fmt.Errorf("k3d %s is too old; upgrade to v%d or later", k3dVersion, minK3dMajor)
+	}
+	return nil
+}
+
+// kindImagesFor returns the newest known kind release not newer than
+// kindVersion, and its image table.
+func kindImagesFor(kindVersion string) (string, map[string]string) {
+	best := ""
+	for r := range kindNodeImages {
+		if compareVersions(r, kindVersion) <= 0 && (best == "" || compareVersions(r, best) > 0) {
+			best = r
+		}
+	}
+	if best == "" {
+		return "", nil
+	}
+	return best, kindNodeImages[best]
+}
+
+// newestKindRelease returns the newest kind release kstack knows images for.
+func newestKindRelease() string {
+	newest := ""
+	for r := range kindNodeImages {
+		if newest == "" || compareVersions(r, newest) > 0 {
+			newest = r
+		}
+	}
+	return newest
+}
+
+func oldestKindRelease() string {
+	oldest := ""
+	for r := range kindNodeImages {
+		if oldest == "" || compareVersions(r, oldest) < 0 {
+			oldest = r
+		}
+	}
+	return oldest
+}
+
+func sortedMinors(images map[string]string) []string {
+	out := make([]string, 0, len(images))
+	for m := range images {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return compareVersions(out[i], out[j]) > 0 })
+	return out
+}
+
+// compareVersions compares dotted versions (optionally v-prefixed) numerically.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+var cliVersionRe = regexp.MustCompile(`v\d+\.\d+\.\d+`)
+
+// cliVersion runs `<bin> <args...>` and extracts the first vX.Y.Z it prints.
+func cliVersion(ctx context.Context, bin string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := utils.Command(ctx, bin, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s version failed: %w: %s", bin, err, string(out))
+	}
+	v := cliVersionRe.FindString(string(out))
+	if v == "" {
+		return "", fmt.Errorf("could not parse %s version from %q", bin, strings.TrimSpace(string(out)))
+	}
+	return v, nil
+}
+
+// internal interface implemented by providers that can pin the Kubernetes version.
+type versionPinnable interface {
+	setK8sVersion(string)
+	// checkK8sVersion reports whether the installed provider CLI can
+	// create a cluster of the pinned version.
+	checkK8sVersion(ctx context.Context) error
+}
+
+// SetK8sVersion pins the Kubernetes version on a provider if it supports it.
+// Returns an error for providers that cannot pin versions.
+func SetK8sVersion(p Provider, v string) error {
+	if v == "" {
+		return nil
+	}
+	if vp, ok := p.(versionPinnable); ok {
+		vp.setK8sVersion(v)
+		return nil
+	}
+	return fmt.Errorf("provider %s does not support pinning the Kubernetes version", p.Provider())
+}
+
+// CheckK8sVersion reports whether the provider can create a cluster of the
+// Kubernetes version pinned with SetK8sVersion, so that a version the
+// installed CLI cannot run fails before anything is started.
+func CheckK8sVersion(ctx context.Context, p Provider) error {
+	if vp, ok := p.(versionPinnable); ok {
+		return vp.checkK8sVersion(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKindNodeImage(t *testing.T) {
+	cases := []struct {
+		kind, k8s, want string
+		wantErr         bool
+	}{
+		{"v0.23.0", "1.30", "kindest/node:v1.30.0", false},
+		{"v0.23.0", "v1.29", "kindest/node:v1.29.4", false},
+		{"v0.23.1", "1.30", "kindest/node:v1.30.0", false}, // patch releases reuse the table
+		{"v0.24.0", "1.30.4", "kindest/node:v1.30.4", false},
+		{"v0.24.0", "1.30.2", "", true}, // patch not published for this kind
+		{"v0.22.0", "1.30", "", true},   // kind too old for 1.30
+		{"v0.19.0", "1.27", "", true},   // older than any known release
+		{"v0.23.0", "latest", "", true},
+	}
+	for _, c := range cases {
+		got, err := KindNodeImage(c.kind, c.k8s)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("KindNodeImage(%s, %s) = %q, want error", c.kind, c.k8s, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("KindNodeImage(%s, %s) = %q, %v; want %q", c.kind, c.k8s, got, err, c.want)
+		}
+	}
+}
+
+func TestK3sImage(t *testing.T) {
+	if got, err := K3sImage("1.30"); err != nil || got != "rancher/k3s:v1.30.8-k3s1" {
+		t.Fatalf("K3sImage(1.30) = %q, %v", got, err)
+	}
+	if got, err := K3sImage("v1.29.3"); err != nil || got != "rancher/k3s:v1.29.3-k3s1" {
+		t.Fatalf("K3sImage(v1.29.3) = %q, %v", got, err)
+	}
+	if _, err := K3sImage("1.12"); err == nil {
+		t.Fatalf("expected error for unknown minor")
+	}
+}
+
+func TestCheckK3dVersion(t *testing.T) {
+	if err := CheckK3dVersion("v5.6.0"); err != nil {
+		t.Fatalf("v5.6.0 should be supported: %v", err)
+	}
+	if err := CheckK3dVersion("v4.4.8"); err == nil {
+		t.Fatalf("v4 should be rejected")
+	}
+}
+
+func TestKindProvider_Create_PinnedVersion(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	writeFakeCmd(t, "kind", "#!/usr/bin/env bash\nif [ \"$1\" = \"version\" ]; then echo 'kind v0.22.0 go1.21 linux/amd64'; exit 0; fi\nif [ \"$1\" = \"create\" ]; then echo \"$@\" > "+argsFile+"; fi\nexit 0\n")
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+
+	p := NewKindProvider("gc-pin")
+	if err := SetK8sVersion(p, "1.30"); err != nil {
+		t.Fatalf("SetK8sVersion: %v", err)
+	}
+	if err := p.Create(context.Background()); err == nil || !strings.Contains(err.Error(), "does not support Kubernetes 1.30") {
+		t.Fatalf("expected unsupported version error, got %v", err)
+	}
+	if _, err := os.Stat(argsFile); err == nil {
+		t.Fatalf("cluster creation must not start for an unsupported version")
+	}
+
+	if err := SetK8sVersion(p, "1.29"); err != nil {
+		t.Fatalf("SetK8sVersion: %v", err)
+	}
+	if err := p.Create(context.Background()); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if !strings.Contains(string(args), "--image kindest/node:v1.29.2") {
+		t.Fatalf("expected pinned node image in args: %s", args)
+	}
+}
+
+func TestK3dProvider_Create_PinnedVersion_DryRun(t *testing.T) {
+	p := NewK3dProviderWithOptions("gc-pin", K3dOptions{Agents: 1})
+	SetDryRun(p, true)
+	if err := SetK8sVersion(p, "1.31"); err != nil {
+		t.Fatalf("SetK8sVersion: %v", err)
+	}
+	if err := p.Create(context.Background()); err != nil {
+		t.Fatalf("dry-run create failed: %v", err)
+	}
+	if err := SetK8sVersion(&noopProvider{}, "1.30"); err == nil {
+		t.Fatalf("expected error pinning a version on a provider without support")
+	}
+}
+
+func TestK3dProvider_Create_PinnedVersionWithConfigFile(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	writeFakeCmd(t, "k3d", "#!/usr/bin/env bash\nif [ \"$1\" = \"version\" ]; then echo 'k3d version v5.6.0'; exit 0; fi\nif [ \"$1\" = \"cluster\" ]; then echo \"$@\" > "+argsFile+"; fi\nexit 0\n")
+	writeFakeCmd(t, "docker", "#!/usr/bin/env bash\nexit 0\n")
+	file := filepath.Join(t.TempDir(), "k3d.yaml")
+	if err := os.WriteFile(file, []byte("apiVersion: k3d.io/v1alpha5\nkind: Simple\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewK3dProviderWithOptions("gc-pin", K3dOptions{ConfigFile: file})
+	if err := SetK8sVersion(p, "1.31"); err != nil {
+		t.Fatalf("SetK8sVersion: %v", err)
+	}
+	if err := p.Create(context.Background()); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if want := "--config " + file + " --image rancher/k3s:v1.31.4-k3s1"; !strings.Contains(string(args), want) {
+		t.Fatalf("expected %q in args: %s", want, args)
+	}
+}
@@ -0,0 +1,52 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	if d := Unified("a", "b", "same\n", "same\n"); d != "" {
+		t.Fatalf("expected no diff, got %q", d)
+	}
+	got := Unified("old", "new", "a\nb\nc\n", "a\nB\nc\n")
+	want := "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+	if got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+	got = Unified("old", "new", "", "x\ny\n")
+	want = "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+x\n+y\n"
+	if got != want {
+		t.Fatalf("unexpected creation diff:\n%s", got)
+	}
+}
+
+func TestUnified_SeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 1; i <= 20; i++ {
+		a = append(a, fmt.Sprintf("l%d", i))
+		b = append(b, fmt.Sprintf("l%d", i))
+	}
+	b[0], b[19] = "first", "last"
+	got := Unified("a", "b", strings.Join(a, "\n")+"\n", strings.Join(b, "\n")+"\n")
+	if !strings.Contains(got, "@@ -1,4 +1,4 @@\n-l1\n+first\n l2\n l3\n l4\n@@ -17,4 +17,4 @@\n l17\n l18\n l19\n-l20\n+last\n") {
+		t.Fatalf("expected two hunks:\n%s", got)
+	}
+	// changes 2*Context lines apart share a hunk
+	b = append([]string(nil), a...)
+	b[0], b[7] = "x", "y"
+	got = Unified("a", "b", strings.Join(a, "\n")+"\n", strings.Join(b, "\n")+"\n")
+	if strings.Count(got, "@@ ") != 1 || !strings.Contains(got, "@@ -1,11 +1,11 @@") {
+		t.Fatalf("expected one merged hunk:\n%s", got)
+	}
+}
+
+func TestColorize(t *testing.T) {
+	got := Colorize("--- a\n+++ b\n@@ -1 +1 @@\n-x\n+y\n ctx\n")
+	for _, want := range []string{colorBold + "--- a" + colorReset + "\n", colorCyan + "@@ -1 +1 @@" + colorReset, colorRed + "-x" + colorReset, colorGreen + "+y" + colorReset, "\n ctx\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ChartMetadata is the part of a chart's Chart.yaml kstack records.
+type ChartMetadata struct {
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+	AppVersion string `yaml:"appVersion"`
+}
+
+// ReadChartMetadata reads Chart.yaml from a chart directory or a packaged
+// chart archive.
+func ReadChartMetadata(chart string) (ChartMetadata, error) {
+	var meta ChartMetadata
+	info, err := os.Stat(chart)
+	if err != nil {
+		return meta, err
+	}
+	var b []byte
+	if info.IsDir() {
+		b, err = os.ReadFile(filepath.Join(chart, "Chart.yaml"))
+	} else {
+		b, err = archiveChartYAML(chart)
+	}
+	if err != nil {
+		return meta, err
+	}
+	if err := yaml.Unmarshal(b, &meta); err != nil {
+		return meta, fmt.Errorf("parse Chart.yaml of %s: %w", chart, err)
+	}
+	return meta, nil
+}
+
+// archiveChartYAML returns the top-level <chart>/Chart.yaml of a packaged
+// chart.
+func archiveChartYAML(archive string) ([]byte, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("read chart archive %s: %w", archive, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("chart archive %s has no Chart.yaml", archive)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read chart archive %s: %w", archive, err)
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if path.Base(name) == "Chart.yaml" && strings.Count(name, "/") == 1 {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Credential is a stored login for an OCI chart registry.
+type Credential struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Credentials maps registry hosts (e.g. ghcr.io or localhost:5001) to their
+// stored logins.
+type Credentials map[string]Credential
+
+// LoadCredentials reads the credentials file at path. A missing file yields
+// no credentials.
+func LoadCredentials(path string) (Credentials, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Credentials{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	creds := Credentials{}
+	if err := yaml.Unmarshal(b, &creds); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// Save writes the credentials to path, readable by the owner only.
+func (c Credentials) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0o600)
+}
+
+// Hosts returns the registries with stored credentials, sorted.
+func (c Credentials) Hosts() []string {
+	out := make([]string, 0, len(c))
+	for h := range c {
+		out = append(out, h)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,93 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// Kinds of helm failures. Test for them with errors.Is on the error
+// returned by a HelmClient method.
+var (
+	// ErrReleaseLocked means the release is stuck in a pending state (e.g.
+	// after an interrupted install) and helm refuses to touch it.
+	ErrReleaseLocked = errors.New("release has another operation in progress")
+	// ErrReleaseNotFound means the release is not installed.
+	ErrReleaseNotFound = errors.New("release not found")
+	// ErrChartNotFound means the chart, chart version or repository does
+	// not exist.
+	ErrChartNotFound = errors.New("chart not found")
+	// ErrTimeout means helm gave up waiting for resources to become ready.
+	ErrTimeout = errors.New("timed out waiting for resources")
+	// ErrSchemaViolation means the values do not match the chart's
+	// values.schema.json.
+	ErrSchemaViolation = errors.New("values violate the chart's schema")
+	// ErrKubeUnreachable means helm could not talk to the cluster.
+	ErrKubeUnreachable = errors.New("kubernetes cluster unreachable")
+)
+
+// Error is a failed helm command. Kind is one of the Err* kinds above, or
+// nil if the output matched none of them.
+type Error struct {
+	// Op is the helm subcommand, e.g. "upgrade --install".
+	Op   string
+	Kind error
+	// Output is the tail of helm's output (see utils.Tail); Kind is
+	// classified from all of it.
+	Output string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("helm %s failed: %v: %s", e.Op, e.Err, e.Output)
+}
+
+// Unwrap exposes both the kind and the underlying exec error.
+func (e *Error) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// errorPatterns classify helm output, most specific first.
+var errorPatterns = []struct {
+	kind error
+	re   *regexp.Regexp
+}{
+	{ErrReleaseLocked, regexp.MustCompile(`another operation \(install/upgrade/rollback\) is in progress`)},
+	{ErrSchemaViolation, regexp.MustCompile(`values don't meet the specifications of the schema|values_schema`)},
+	// only helm's own message: network errors alone also come from chart
+	// repositories and registries
+	{ErrKubeUnreachable, regexp.MustCompile(`(?i)kubernetes cluster unreachable`)},
+	{ErrReleaseNotFound, regexp.MustCompile(`release: not found`)},
+	{ErrChartNotFound, regexp.MustCompile(`chart "[^"]*"( version "[^"]*")? not found|failed to download|repo [^ ]+ not found|no chart version found|no chart name found|path "[^"]*" not found|"FetchReference" on source: .*not found`)},
+	{ErrTimeout, regexp.MustCompile(`timed out waiting for the condition|context deadline exceeded`)},
+}
+
+// classify returns the kind of failure helm's output describes, or nil.
+func classify(output string) error {
+	for _, p := range errorPatterns {
+		if p.re.MatchString(output) {
+			return p.kind
+		}
+	}
+	return nil
+}
+
+// commandError wraps a failed helm command run under ctx into an *Error.
+// If ctx was cancelled or timed out, the error also wraps ctx.Err(): helm
+// exits non-zero once terminated, which exec reports instead.
+func commandError(ctx context.Context, op string, err error, output string) error {
+	if cerr := ctx.Err(); cerr != nil && !errors.Is(err, cerr) {
+		err = fmt.Errorf("%w: %w", cerr, err)
+	}
+	kind := classify(output)
+	if kind == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		kind = ErrTimeout
+	}
+	return &Error{Op: op, Kind: kind, Output: utils.Tail([]byte(output)), Err: err}
+}
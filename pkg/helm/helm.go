@@ -3,8 +3,13 @@ package helm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,10 +17,37 @@ import (
 )
 
 // HelmClient is a thin wrapper around the helm binary. It shells out to
-// `helm` and exposes a minimal API used by the addons flow.
+// `helm` and exposes a minimal API used by the addons flow. Every method
+// runs helm under the given context: cancelling it (Ctrl-C, --timeout)
+// terminates the helm process, and the method returns an error wrapping
+// ctx.Err().
 type HelmClient struct {
 	Path   string
 	DryRun bool
+	// Kubeconfig and KubeContext are passed as --kubeconfig and
+	// --kube-context to every command that talks to the cluster, so that
+	// releases never land in whatever context helm would default to.
+	Kubeconfig  string
+	KubeContext string
+	// RepositoryConfig and RepositoryCache, when set, are exported to every
+	// helm command as HELM_REPOSITORY_CONFIG and HELM_REPOSITORY_CACHE so
+	// that kstack's chart repositories stay out of the user's helm setup.
+	RepositoryConfig string
+	RepositoryCache  string
+	// RegistryConfig, when set, is exported as HELM_REGISTRY_CONFIG and
+	// keeps OCI registry logins in kstack's own credentials file.
+	RegistryConfig string
+	// RecoverStuck makes InstallOrUpgrade recover a release stuck in a
+	// pending state (ErrReleaseLocked) and retry once: a pending upgrade or
+	// rollback is rolled back to the previous revision, a pending install
+	// is uninstalled.
+	RecoverStuck bool
+
+	// added and updated remember the repositories handled during this run,
+	// loggedIn the OCI registries.
+	added    map[string]bool
+	updated  map[string]bool
+	loggedIn map[string]bool
 }
 
 // NewClient returns a HelmClient using the provided helm binary path.
@@ -23,7 +55,7 @@ func NewClient(path string) *HelmClient { return &HelmClient{Path: path} }
 
 // Preflight checks that the helm binary is available and returns its short
 // version string (e.g. "v3.12.0+g...") or an error.
-func (h *HelmClient) Preflight(timeout time.Duration) (string, error) {
+func (h *HelmClient) Preflight(ctx context.Context, timeout time.Duration) (string, error) {
 	if h.DryRun {
 		utils.Info("DRY-RUN: %s version --short", h.Path)
 		return "dry-run", nil
@@ -31,54 +63,185 @@ func (h *HelmClient) Preflight(timeout time.Duration) (string, error) {
 	if timeout <= 0 {
 		timeout = 10 * time.Second
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, h.Path, "version", "--short")
+	cmd := h.command(ctx, "version", "--short")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("helm preflight failed: %w: %s", err, string(out))
+		return "", commandError(ctx, "preflight", err, string(out))
 	}
 	return string(out), nil
 }
 
-// RepoAdd adds a helm repo: `helm repo add name url`.
-func (h *HelmClient) RepoAdd(name, url string) error {
+// command returns an exec.Cmd running helm with args in the client's
+// repository environment.
+func (h *HelmClient) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := utils.Command(ctx, h.Path, args...)
+	for _, kv := range [][2]string{
+		{"HELM_REPOSITORY_CONFIG", h.RepositoryConfig},
+		{"HELM_REPOSITORY_CACHE", h.RepositoryCache},
+		{"HELM_REGISTRY_CONFIG", h.RegistryConfig},
+	} {
+		if kv[1] == "" {
+			continue
+		}
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, kv[0]+"="+kv[1])
+	}
+	return cmd
+}
+
+// kubeArgs returns the global flags selecting the target cluster.
+func (h *HelmClient) kubeArgs() []string {
+	var args []string
+	if h.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", h.Kubeconfig)
+	}
+	if h.KubeContext != "" {
+		args = append(args, "--kube-context", h.KubeContext)
+	}
+	return args
+}
+
+// deadlineMargin is how long before the deadline of the caller's context
+// helm's own --timeout expires, so that helm can give up cleanly (marking
+// the release failed, or rolling it back with --atomic) instead of being
+// killed mid-operation and leaving the release pending.
+const deadlineMargin = 30 * time.Second
+
+// helmTimeout returns the --timeout to pass to helm: timeout, shortened to
+// end deadlineMargin (or, with less time left, half the remaining time)
+// before the deadline of ctx.
+func helmTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeout
+	}
+	left := time.Until(deadline)
+	limit := max(left-deadlineMargin, left/2).Truncate(time.Second)
+	if limit >= timeout {
+		return timeout
+	}
+	limit = max(limit, time.Second)
+	utils.Debug("helm --timeout lowered from %s to %s to end before the overall --timeout", timeout, limit)
+	return limit
+}
+
+// RepoAdd adds a helm repo: `helm repo add name url --force-update`.
+// A repository already added by this client is not added again.
+func (h *HelmClient) RepoAdd(ctx context.Context, name, url string) error {
+	key := name + " " + url
+	if h.added[key] {
+		return nil
+	}
 	if h.DryRun {
-		utils.Info("DRY-RUN: %s repo add %s %s", h.Path, name, url)
+		utils.Info("DRY-RUN: %s repo add %s %s --force-update", h.Path, name, url)
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, h.Path, "repo", "add", name, url)
-	out, err := cmd.CombinedOutput()
+	cmd := h.command(ctx, "repo", "add", name, url, "--force-update")
+	out, err := utils.Run(cmd, "helm")
 	if err != nil {
-		return fmt.Errorf("helm repo add failed: %w: %s", err, string(out))
+		return commandError(ctx, "repo add", err, string(out))
+	}
+	if h.added == nil {
+		h.added = map[string]bool{}
 	}
+	h.added[key] = true
 	return nil
 }
 
-// RepoUpdate runs `helm repo update`.
-func (h *HelmClient) RepoUpdate() error {
+// RepoUpdate runs `helm repo update [names...]`, refreshing only the named
+// repositories (all of them if none are given). Each repository is updated
+// at most once per client, so installing several addons from one repository
+// fetches its index once.
+func (h *HelmClient) RepoUpdate(ctx context.Context, names ...string) error {
+	var pending []string
+	for _, n := range names {
+		if !h.updated[n] && !slices.Contains(pending, n) {
+			pending = append(pending, n)
+		}
+	}
+	if len(names) > 0 && len(pending) == 0 || len(names) == 0 && h.updated[""] {
+		return nil
+	}
+	args := append([]string{"repo", "update"}, pending...)
 	if h.DryRun {
-		utils.Info("DRY-RUN: %s repo update", h.Path)
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, h.Path, "repo", "update")
-	out, err := cmd.CombinedOutput()
+	cmd := h.command(ctx, args...)
+	out, err := utils.Run(cmd, "helm")
 	if err != nil {
-		return fmt.Errorf("helm repo update failed: %w: %s", err, string(out))
+		return commandError(ctx, "repo update", err, string(out))
+	}
+	if h.updated == nil {
+		h.updated = map[string]bool{}
+	}
+	if len(pending) == 0 {
+		// "" marks a full update
+		pending = []string{""}
+	}
+	for _, n := range pending {
+		h.updated[n] = true
 	}
 	return nil
 }
 
-// InstallOrUpgrade runs `helm upgrade --install`.
-// If wait is true, it adds `--wait` and `--timeout` with the provided timeout duration.
+// RegistryLogin logs in to the OCI registry host with `helm registry login`,
+// passing the password on stdin. A registry already logged in to by this
+// client is skipped.
+func (h *HelmClient) RegistryLogin(ctx context.Context, host, username, password string) error {
+	if h.loggedIn[host] {
+		return nil
+	}
+	args := []string{"registry", "login", host, "--username", username, "--password-stdin"}
+	if IsLoopbackHost(host) {
+		args = append(args, "--insecure")
+	}
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return nil
+	}
+	cmd := h.command(ctx, args...)
+	cmd.Stdin = strings.NewReader(password)
+	out, err := utils.Run(cmd, "helm")
+	if err != nil {
+		return commandError(ctx, "registry login "+host, err, string(out))
+	}
+	if h.loggedIn == nil {
+		h.loggedIn = map[string]bool{}
+	}
+	h.loggedIn[host] = true
+	return nil
+}
+
+// RegistryLogout runs `helm registry logout host`.
+func (h *HelmClient) RegistryLogout(ctx context.Context, host string) error {
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s registry logout %s", h.Path, host)
+		return nil
+	}
+	out, err := utils.Run(h.command(ctx, "registry", "logout", host), "helm")
+	if err != nil {
+		return commandError(ctx, "registry logout "+host, err, string(out))
+	}
+	delete(h.loggedIn, host)
+	return nil
+}
+
+// InstallOrUpgrade runs `helm upgrade --install`. A non-empty version is
+// passed as `--version`; otherwise helm picks the newest chart version.
+// If wait is true, it adds `--wait` and `--timeout` with the provided timeout
+// duration, shortened to expire before the deadline of ctx.
 // If atomic is true, it adds `--atomic`. setPairs is a list of `key=val` pairs
-// passed to `--set` and can be empty.
-func (h *HelmClient) InstallOrUpgrade(release, chart, namespace, valuesFile string, wait bool, timeout time.Duration, atomic bool, setPairs []string) error {
-	args := []string{"upgrade", "--install", release, chart, "-n", namespace}
+// passed to `--set` and can be empty. ctx bounds the whole call, including
+// a retry after recovering a stuck release. Failures are returned as *Error;
+// see RecoverStuck for releases locked by an interrupted operation.
+func (h *HelmClient) InstallOrUpgrade(ctx context.Context, release, chart, version, namespace, valuesFile string, wait bool, timeout time.Duration, atomic bool, setPairs []string) error {
+	args := append([]string{"upgrade", "--install", release, chart}, chartArgs(chart, version)...)
+	args = append(args, "-n", namespace)
 	if valuesFile != "" {
 		args = append(args, "-f", valuesFile)
 	}
@@ -91,55 +254,294 @@ func (h *HelmClient) InstallOrUpgrade(release, chart, namespace, valuesFile stri
 			args = append(args, "--set", s)
 		}
 	}
-	if wait {
-		args = append(args, "--wait", "--timeout", timeout.String())
+	// the timeout is derived for every attempt from the time left in ctx
+	installArgs := func() []string {
+		if !wait {
+			return slices.Concat(args, h.kubeArgs())
+		}
+		return slices.Concat(args, []string{"--wait", "--timeout", helmTimeout(ctx, timeout).String()}, h.kubeArgs())
 	}
 
 	if h.DryRun {
-		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(installArgs(), " "))
 		return nil
 	}
 
-	// Use provided timeout + a small buffer for the command context
-	ctxTimeout := timeout
-	if ctxTimeout < 30*time.Second {
-		ctxTimeout = 30 * time.Second
+	install := func() error {
+		cmd := h.command(ctx, installArgs()...)
+		out, err := utils.Run(cmd, release)
+		if err != nil {
+			return commandError(ctx, "upgrade --install", err, string(out))
+		}
+		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), ctxTimeout)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, h.Path, args...)
-	out, err := cmd.CombinedOutput()
+	err := install()
+	if !h.RecoverStuck || !errors.Is(err, ErrReleaseLocked) {
+		return err
+	}
+	if rerr := h.recoverStuck(ctx, release, namespace, timeout); rerr != nil {
+		return fmt.Errorf("%w (recovering the stuck release failed: %v)", err, rerr)
+	}
+	utils.Info("retrying helm upgrade --install %s", release)
+	return install()
+}
+
+// recoverStuck unlocks a release left in a pending state by an interrupted
+// helm operation.
+func (h *HelmClient) recoverStuck(ctx context.Context, release, namespace string, timeout time.Duration) error {
+	status, revision, err := h.ReleaseStatus(ctx, release, namespace)
 	if err != nil {
-		return fmt.Errorf("helm upgrade --install failed: %w: %s", err, string(out))
+		return err
 	}
-	return nil
+	switch {
+	case status == "pending-install" || (strings.HasPrefix(status, "pending-") && revision <= 1):
+		utils.Warn("release %s is stuck in %s; uninstalling it", release, status)
+		return h.Uninstall(ctx, release, namespace, false, timeout)
+	case status == "pending-upgrade" || status == "pending-rollback":
+		utils.Warn("release %s is stuck in %s; rolling back to revision %d", release, status, revision-1)
+		return h.Rollback(ctx, release, namespace, revision-1, false, timeout)
+	default:
+		return fmt.Errorf("release %s is %s, not pending", release, status)
+	}
+}
+
+// ReleaseStatus returns the status (e.g. deployed or pending-upgrade) and
+// current revision of a release: `helm status <release> -n <ns> -o json`.
+func (h *HelmClient) ReleaseStatus(ctx context.Context, release, namespace string) (string, int, error) {
+	args := append([]string{"status", release, "-n", namespace, "-o", "json"}, h.kubeArgs()...)
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return "", 0, nil
+	}
+	cmd := h.command(ctx, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", 0, commandError(ctx, "status", err, stderr.String())
+	}
+	var st struct {
+		Info struct {
+			Status string `json:"status"`
+		} `json:"info"`
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(out, &st); err != nil {
+		return "", 0, fmt.Errorf("parse helm status output: %w: %s", err, string(out))
+	}
+	return st.Info.Status, st.Version, nil
+}
+
+// chartArgs returns the flags locating chart: --version selecting a chart
+// version, if any, and --plain-http for OCI charts on a loopback registry
+// such as a local registry:2 container.
+func chartArgs(chart, version string) []string {
+	var args []string
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	if IsOCIChart(chart) && IsLoopbackHost(OCIHost(chart)) {
+		args = append(args, "--plain-http")
+	}
+	return args
+}
+
+// IsLocalChart reports whether chart refers to a chart directory or a
+// packaged chart archive on the local filesystem. Such charts need no
+// repository, so RepoAdd and RepoUpdate are skipped for them.
+func IsLocalChart(chart string) bool {
+	return strings.HasPrefix(chart, "./") || strings.HasPrefix(chart, "/") ||
+		strings.HasSuffix(chart, ".tgz") || strings.HasSuffix(chart, ".tar.gz")
+}
+
+// IsOCIChart reports whether chart is an OCI artifact reference such as
+// oci://registry-1.docker.io/bitnamicharts/kafka. OCI charts are pulled from
+// their registry directly and need no repository either.
+func IsOCIChart(chart string) bool {
+	return strings.HasPrefix(chart, "oci://")
+}
+
+// OCIHost returns the registry host of an OCI chart reference.
+func OCIHost(chart string) string {
+	host, _, _ := strings.Cut(strings.TrimPrefix(chart, "oci://"), "/")
+	return host
+}
+
+// IsLoopbackHost reports whether the registry host (optionally with a port)
+// is on this machine. Such registries are spoken to over plain HTTP.
+func IsLoopbackHost(host string) bool {
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	if name == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(name)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Pull stores chart as a packaged archive in destDir and returns its path:
+// repository charts are fetched with `helm pull`, local chart directories
+// are packaged with `helm package`. version selects the chart version to
+// pull. It returns "" in dry-run mode.
+func (h *HelmClient) Pull(ctx context.Context, chart, version, destDir string) (string, error) {
+	args := append([]string{"pull", chart}, chartArgs(chart, version)...)
+	args = append(args, "--destination", destDir)
+	if IsLocalChart(chart) {
+		args = []string{"package", chart, "--destination", destDir}
+	}
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return "", nil
+	}
+	before, err := chartArchives(destDir)
+	if err != nil {
+		return "", err
+	}
+	cmd := h.command(ctx, args...)
+	out, err := utils.Run(cmd, "helm")
+	if err != nil {
+		return "", commandError(ctx, args[0], err, string(out))
+	}
+	after, err := chartArchives(destDir)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range after {
+		if !slices.Contains(before, f) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("helm %s %s wrote no chart archive to %s", args[0], chart, destDir)
+}
+
+// chartArchives lists the chart archives in dir.
+func chartArchives(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Template renders a chart locally with `helm template` and returns the
+// manifests. Arguments mirror InstallOrUpgrade; includeCRDs adds the CRDs of
+// the chart's crds/ directory, which helm installs but does not template by
+// default. It returns "" in dry-run mode.
+func (h *HelmClient) Template(ctx context.Context, release, chart, version, namespace, valuesFile string, setPairs []string, includeCRDs bool) (string, error) {
+	args := append([]string{"template", release, chart}, chartArgs(chart, version)...)
+	args = append(args, "-n", namespace)
+	if valuesFile != "" {
+		args = append(args, "-f", valuesFile)
+	}
+	for _, s := range setPairs {
+		if s != "" {
+			args = append(args, "--set", s)
+		}
+	}
+	if includeCRDs {
+		args = append(args, "--include-crds")
+	}
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return "", nil
+	}
+	cmd := h.command(ctx, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", commandError(ctx, "template", err, stderr.String())
+	}
+	return string(out), nil
+}
+
+// PlanUpgrade returns the manifest, without hooks, that InstallOrUpgrade
+// would deploy: `helm upgrade --install --dry-run=server -o json`. Unlike
+// Template, the chart is rendered against the cluster, so it sees the
+// cluster's API versions and `lookup` returns live objects (e.g. the
+// generated passwords charts reuse). Requires helm 3.13 or newer. It returns
+// "" in dry-run mode.
+func (h *HelmClient) PlanUpgrade(ctx context.Context, release, chart, version, namespace, valuesFile string, setPairs []string) (string, error) {
+	args := append([]string{"upgrade", "--install", release, chart}, chartArgs(chart, version)...)
+	args = append(args, "-n", namespace)
+	if valuesFile != "" {
+		args = append(args, "-f", valuesFile)
+	}
+	for _, s := range setPairs {
+		if s != "" {
+			args = append(args, "--set", s)
+		}
+	}
+	args = append(args, "--dry-run=server", "-o", "json")
+	args = append(args, h.kubeArgs()...)
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return "", nil
+	}
+	cmd := h.command(ctx, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", commandError(ctx, "upgrade --dry-run", err, stderr.String())
+	}
+	var rel struct {
+		Manifest string `json:"manifest"`
+	}
+	if err := json.Unmarshal(out, &rel); err != nil {
+		return "", fmt.Errorf("parse helm upgrade --dry-run output: %w", err)
+	}
+	return rel.Manifest, nil
 }
 
 // Uninstall runs `helm uninstall <release> -n <ns>`.
-// If wait is true, it includes `--timeout`.
-func (h *HelmClient) Uninstall(release, namespace string, wait bool, timeout time.Duration) error {
+// If wait is true, it includes `--timeout`, shortened to expire before the
+// deadline of ctx.
+func (h *HelmClient) Uninstall(ctx context.Context, release, namespace string, wait bool, timeout time.Duration) error {
 	args := []string{"uninstall", release, "-n", namespace}
 	if wait {
-		args = append(args, "--timeout", timeout.String())
+		args = append(args, "--timeout", helmTimeout(ctx, timeout).String())
 	}
+	args = append(args, h.kubeArgs()...)
 	if h.DryRun {
 		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
 		return nil
 	}
-	ctxTimeout := timeout
-	if ctxTimeout < 30*time.Second {
-		ctxTimeout = 30 * time.Second
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), ctxTimeout)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, h.Path, args...)
-	out, err := cmd.CombinedOutput()
+	cmd := h.command(ctx, args...)
+	out, err := utils.Run(cmd, release)
 	if err != nil {
-		return fmt.Errorf("helm uninstall failed: %w: %s", err, string(out))
+		return commandError(ctx, "uninstall", err, string(out))
 	}
 	return nil
 }
 
+// ReleaseValues returns the user-supplied values of a release as JSON:
+// `helm get values <release> -n <ns> -o json`.
+func (h *HelmClient) ReleaseValues(ctx context.Context, release, namespace string) ([]byte, error) {
+	return h.RevisionValues(ctx, release, namespace, 0)
+}
+
+// ReleaseManifest returns the manifest of a deployed release:
+// `helm get manifest <release> -n <ns>`. Hooks are not part of it. A release
+// that is not installed yields an error of kind ErrReleaseNotFound.
+func (h *HelmClient) ReleaseManifest(ctx context.Context, release, namespace string) (string, error) {
+	args := append([]string{"get", "manifest", release, "-n", namespace}, h.kubeArgs()...)
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return "", nil
+	}
+	cmd := h.command(ctx, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", commandError(ctx, "get manifest", err, stderr.String())
+	}
+	return string(out), nil
+}
+
 // ReleaseInfo is a minimal representation of a Helm release as returned by
 // `helm list -n <ns> -o json`.
 type ReleaseInfo struct {
@@ -154,18 +556,16 @@ type ReleaseInfo struct {
 
 // ListReleases returns Helm releases in the given namespace by calling
 // `helm list -n <ns> -o json` and parsing the JSON output.
-func (h *HelmClient) ListReleases(namespace string) ([]ReleaseInfo, error) {
+func (h *HelmClient) ListReleases(ctx context.Context, namespace string) ([]ReleaseInfo, error) {
+	args := append([]string{"list", "-n", namespace, "-o", "json"}, h.kubeArgs()...)
 	if h.DryRun {
-		utils.Info("DRY-RUN: %s list -n %s -o json", h.Path, namespace)
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
 		return nil, nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-	args := []string{"list", "-n", namespace, "-o", "json"}
-	cmd := exec.CommandContext(ctx, h.Path, args...)
+	cmd := h.command(ctx, args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return nil, fmt.Errorf("helm list failed: %w: %s", err, string(out))
+		return nil, commandError(ctx, "list", err, string(out))
 	}
 	var releases []ReleaseInfo
 	if err := json.Unmarshal(out, &releases); err != nil {
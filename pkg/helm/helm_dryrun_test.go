@@ -1,6 +1,7 @@
 package helm
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -8,22 +9,22 @@ import (
 func TestHelmClient_DryRun_RepoAndInstall(t *testing.T) {
 	h := NewClient("helm")
 	h.DryRun = true
-	if _, err := h.Preflight(2 * time.Second); err != nil {
+	if _, err := h.Preflight(context.Background(), 2*time.Second); err != nil {
 		t.Fatalf("preflight dry-run failed: %v", err)
 	}
-	if err := h.RepoAdd("bitnami", "https://charts.bitnami.com/bitnami"); err != nil {
+	if err := h.RepoAdd(context.Background(), "bitnami", "https://charts.bitnami.com/bitnami"); err != nil {
 		t.Fatalf("repo add dry-run failed: %v", err)
 	}
-	if err := h.RepoUpdate(); err != nil {
+	if err := h.RepoUpdate(context.Background()); err != nil {
 		t.Fatalf("repo update dry-run failed: %v", err)
 	}
-	if err := h.InstallOrUpgrade("rel", "chart", "ns", "", true, 30*time.Second, true, []string{"k=v"}); err != nil {
+	if err := h.InstallOrUpgrade(context.Background(), "rel", "chart", "", "ns", "", true, 30*time.Second, true, []string{"k=v"}); err != nil {
 		t.Fatalf("install dry-run failed: %v", err)
 	}
-	if err := h.Uninstall("rel", "ns", true, 10*time.Second); err != nil {
+	if err := h.Uninstall(context.Background(), "rel", "ns", true, 10*time.Second); err != nil {
 		t.Fatalf("uninstall dry-run failed: %v", err)
 	}
-	if _, err := h.ListReleases("ns"); err != nil {
+	if _, err := h.ListReleases(context.Background(), "ns"); err != nil {
 		t.Fatalf("list releases dry-run failed: %v", err)
 	}
 }
@@ -1,9 +1,12 @@
 package helm
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -24,37 +27,157 @@ func writeFailHelm(t *testing.T, script string) string {
 func TestHelmErrors_Branches(t *testing.T) {
 	// version fails
 	h := NewClient(writeFailHelm(t, "#!/usr/bin/env bash\nexit 1\n"))
-	if _, err := h.Preflight(time.Second); err == nil {
+	if _, err := h.Preflight(context.Background(), time.Second); err == nil {
 		t.Fatalf("expected preflight error")
 	}
 
 	// repo add fails
 	h = NewClient(writeFailHelm(t, "#!/usr/bin/env bash\nif [ \"$1\" = \"repo\" ]; then exit 1; fi\necho ok\n"))
-	if err := h.RepoAdd("n", "u"); err == nil {
+	if err := h.RepoAdd(context.Background(), "n", "u"); err == nil {
 		t.Fatalf("expected repo add error")
 	}
 
 	// repo update fails
 	h = NewClient(writeFailHelm(t, "#!/usr/bin/env bash\nif [ \"$1\" = \"repo\" ] && [ \"$2\" = \"update\" ]; then exit 1; fi\necho ok\n"))
-	if err := h.RepoUpdate(); err == nil {
+	if err := h.RepoUpdate(context.Background()); err == nil {
 		t.Fatalf("expected repo update error")
 	}
 
 	// install fails
 	h = NewClient(writeFailHelm(t, "#!/usr/bin/env bash\nif [ \"$1\" = \"upgrade\" ]; then exit 1; fi\necho ok\n"))
-	if err := h.InstallOrUpgrade("r", "c", "ns", "", false, time.Second, false, nil); err == nil {
+	if err := h.InstallOrUpgrade(context.Background(), "r", "c", "", "ns", "", false, time.Second, false, nil); err == nil {
 		t.Fatalf("expected install error")
 	}
 
 	// uninstall fails
 	h = NewClient(writeFailHelm(t, "#!/usr/bin/env bash\nif [ \"$1\" = \"uninstall\" ]; then exit 1; fi\necho ok\n"))
-	if err := h.Uninstall("r", "ns", false, time.Second); err == nil {
+	if err := h.Uninstall(context.Background(), "r", "ns", false, time.Second); err == nil {
 		t.Fatalf("expected uninstall error")
 	}
 
 	// list returns invalid json
 	h = NewClient(writeFailHelm(t, "#!/usr/bin/env bash\nif [ \"$1\" = \"list\" ]; then echo not-json; exit 0; fi\necho ok\n"))
-	if _, err := h.ListReleases("ns"); err == nil {
+	if _, err := h.ListReleases(context.Background(), "ns"); err == nil {
 		t.Fatalf("expected list parse error")
 	}
 }
+
+func TestClassifyHelmOutput(t *testing.T) {
+	cases := []struct {
+		out  string
+		want error
+	}{
+		{"Error: UPGRADE FAILED: another operation (install/upgrade/rollback) is in progress", ErrReleaseLocked},
+		{`Error: chart "grafana" version "99.0.0" not found in https://grafana.github.io/helm-charts repository`, ErrChartNotFound},
+		{"Error: repo nosuch not found", ErrChartNotFound},
+		{"Error: release: not found", ErrReleaseNotFound},
+		{`Error: failed to perform "FetchReference" on source: registry-1.docker.io/bitnamicharts/nope:1.0.0: not found`, ErrChartNotFound},
+		{"Error: UPGRADE FAILED: context deadline exceeded", ErrTimeout},
+		{"Error: INSTALLATION FAILED: timed out waiting for the condition", ErrTimeout},
+		{"Error: values don't meet the specifications of the schema(s) in the following chart(s):\nkafka:\n- replicas: Invalid type", ErrSchemaViolation},
+		{"Error: Kubernetes cluster unreachable: Get \"https://127.0.0.1:6443/version\": dial tcp 127.0.0.1:6443: connect: connection refused", ErrKubeUnreachable},
+		{"Error: Kubernetes cluster unreachable: Get \"https://kind.invalid:6443/version\": dial tcp: lookup kind.invalid: no such host", ErrKubeUnreachable},
+		{"Error: failed to download \"grafana/grafana\": Get \"https://grafana.github.io/helm-charts/grafana-8.5.1.tgz\": dial tcp: lookup grafana.github.io: no such host", ErrChartNotFound},
+		{"Error: looks like \"https://charts.invalid\" is not a valid chart repository or cannot be reached: Get \"https://charts.invalid/index.yaml\": dial tcp: lookup charts.invalid: no such host", nil},
+		{"Error: INSTALLATION FAILED: something else", nil},
+	}
+	for _, c := range cases {
+		if got := classify(c.out); got != c.want {
+			t.Fatalf("classify(%q) = %v, want %v", c.out, got, c.want)
+		}
+	}
+}
+
+func TestRepoAndPull_DNSFailureIsNotKubeUnreachable(t *testing.T) {
+	h := NewClient(writeFailHelm(t, `#!/usr/bin/env bash
+case "$1" in
+  repo) echo 'Error: looks like "https://charts.invalid" is not a valid chart repository or cannot be reached: Get "https://charts.invalid/index.yaml": dial tcp: lookup charts.invalid: no such host' >&2;;
+  pull) echo 'Error: failed to download "oci://charts.invalid/app" at version "1.0.0": dial tcp: lookup charts.invalid: no such host' >&2;;
+esac
+exit 1
+`))
+	err := h.RepoAdd(context.Background(), "n", "https://charts.invalid")
+	if err == nil || errors.Is(err, ErrKubeUnreachable) {
+		t.Fatalf("repo add: expected an error not blaming the cluster, got %v", err)
+	}
+	_, err = h.Pull(context.Background(), "oci://charts.invalid/app", "1.0.0", t.TempDir())
+	if !errors.Is(err, ErrChartNotFound) || errors.Is(err, ErrKubeUnreachable) {
+		t.Fatalf("pull: expected ErrChartNotFound, got %v", err)
+	}
+}
+
+func TestInstallOrUpgrade_TypedErrorAndRecovery(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	// the first upgrade finds the release locked; status reports the given state
+	script := func(status string) string {
+		return "#!/usr/bin/env bash\necho \"$@\" >> " + argsFile + "\n" +
+			"case \"$1\" in\n" +
+			"  upgrade) if [ ! -f " + dir + "/unlocked ]; then echo 'Error: UPGRADE FAILED: another operation (install/upgrade/rollback) is in progress' >&2; exit 1; fi;;\n" +
+			"  status) echo '{\"name\":\"r\",\"info\":{\"status\":\"" + status + "\"},\"version\":3}';;\n" +
+			"  rollback|uninstall) touch " + dir + "/unlocked;;\n" +
+			"esac\nexit 0\n"
+	}
+
+	h := NewClient(writeFailHelm(t, script("pending-upgrade")))
+	err := h.InstallOrUpgrade(context.Background(), "r", "c", "", "ns", "", false, time.Second, false, nil)
+	var herr *Error
+	if !errors.Is(err, ErrReleaseLocked) || !errors.As(err, &herr) || herr.Op != "upgrade --install" {
+		t.Fatalf("expected a typed locked-release error, got %v", err)
+	}
+
+	h.RecoverStuck = true
+	if err := h.InstallOrUpgrade(context.Background(), "r", "c", "", "ns", "", false, time.Second, false, nil); err != nil {
+		t.Fatalf("expected recovery, got %v", err)
+	}
+	b, _ := os.ReadFile(argsFile)
+	if !strings.Contains(string(b), "status r -n ns -o json\nrollback r 2 -n ns\nupgrade --install r c") {
+		t.Fatalf("expected status, rollback to revision 2 and a retry:\n%s", b)
+	}
+
+	os.Remove(filepath.Join(dir, "unlocked"))
+	os.Remove(argsFile)
+	h = NewClient(writeFailHelm(t, script("pending-install")))
+	h.RecoverStuck = true
+	if err := h.InstallOrUpgrade(context.Background(), "r", "c", "", "ns", "", false, time.Second, false, nil); err != nil {
+		t.Fatalf("expected recovery, got %v", err)
+	}
+	if b, _ := os.ReadFile(argsFile); !strings.Contains(string(b), "uninstall r -n ns\nupgrade --install r c") {
+		t.Fatalf("expected a stuck install to be uninstalled:\n%s", b)
+	}
+}
+
+func TestInstallOrUpgrade_CancelTerminatesHelm(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "terminated")
+	h := NewClient(writeFailHelm(t, "#!/usr/bin/env bash\n"+
+		"trap 'echo \"Release $3 has been cancelled.\"; touch "+marker+"; kill $pid; exit 1' TERM\n"+
+		"sleep 30 & pid=$!\nwait $pid\n"))
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := h.InstallOrUpgrade(ctx, "rel", "repo/chart", "", "ns", "", true, time.Minute, false, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout wrapping the context error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "has been cancelled") {
+		t.Fatalf("expected helm's own output, got %v", err)
+	}
+	if _, serr := os.Stat(marker); serr != nil {
+		t.Fatalf("helm was not sent SIGTERM: %v", serr)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("cancel took %s", d)
+	}
+}
+
+func TestCommandError_ClassifiesAllOutputQuotesTail(t *testing.T) {
+	h := NewClient(writeFailHelm(t, "#!/usr/bin/env bash\necho 'Error: another operation (install/upgrade/rollback) is in progress'\nfor i in $(seq 1 40); do echo \"wait $i\"; done\nexit 1\n"))
+	err := h.InstallOrUpgrade(context.Background(), "rel", "repo/chart", "", "ns", "", false, time.Minute, false, nil)
+	var herr *Error
+	if !errors.As(err, &herr) || !errors.Is(err, ErrReleaseLocked) {
+		t.Fatalf("expected a locked release error, got %v", err)
+	}
+	if strings.Contains(herr.Output, "another operation") || !strings.HasSuffix(herr.Output, "wait 40") {
+		t.Fatalf("expected only the tail of the output in the error:\n%s", herr.Output)
+	}
+}
@@ -1,9 +1,11 @@
 package helm
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -24,22 +26,161 @@ func writeFakeHelm(t *testing.T) string {
 
 func TestHelmClient_WithFakeBinary(t *testing.T) {
 	h := NewClient(writeFakeHelm(t))
-	if v, err := h.Preflight(2 * time.Second); err != nil || v == "" {
+	if v, err := h.Preflight(context.Background(), 2*time.Second); err != nil || v == "" {
 		t.Fatalf("preflight failed: %v, v=%q", err, v)
 	}
-	if err := h.RepoAdd("n", "u"); err != nil {
+	if err := h.RepoAdd(context.Background(), "n", "u"); err != nil {
 		t.Fatalf("repo add: %v", err)
 	}
-	if err := h.RepoUpdate(); err != nil {
+	if err := h.RepoUpdate(context.Background()); err != nil {
 		t.Fatalf("repo update: %v", err)
 	}
-	if err := h.InstallOrUpgrade("r", "c", "ns", "", true, time.Second, false, nil); err != nil {
+	if err := h.InstallOrUpgrade(context.Background(), "r", "c", "", "ns", "", true, time.Second, false, nil); err != nil {
 		t.Fatalf("install: %v", err)
 	}
-	if err := h.Uninstall("r", "ns", true, time.Second); err != nil {
+	if err := h.Uninstall(context.Background(), "r", "ns", true, time.Second); err != nil {
 		t.Fatalf("uninstall: %v", err)
 	}
-	if rels, err := h.ListReleases("ns"); err != nil || len(rels) != 0 {
+	if rels, err := h.ListReleases(context.Background(), "ns"); err != nil || len(rels) != 0 {
 		t.Fatalf("list: err=%v rels=%v", err, rels)
 	}
 }
+
+func TestHelmClient_PassesKubeconfigAndContext(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	path := writeFailHelm(t, "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\nif [ \"$1\" = \"list\" ]; then echo '[]'; fi\nexit 0\n")
+	h := NewClient(path)
+	h.Kubeconfig = "/tmp/kstack-kubeconfig"
+	h.KubeContext = "kind-dev"
+	if err := h.InstallOrUpgrade(context.Background(), "r", "c", "", "ns", "", false, time.Second, false, nil); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if err := h.Uninstall(context.Background(), "r", "ns", false, time.Second); err != nil {
+		t.Fatalf("uninstall: %v", err)
+	}
+	if _, err := h.ListReleases(context.Background(), "ns"); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	b, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 helm invocations, got %q", lines)
+	}
+	for _, l := range lines {
+		if !strings.Contains(l, "--kubeconfig /tmp/kstack-kubeconfig --kube-context kind-dev") {
+			t.Fatalf("missing cluster selection flags in %q", l)
+		}
+	}
+}
+
+func TestHelmClient_TimeoutEndsBeforeDeadline(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	h := NewClient(writeFailHelm(t, "#!/usr/bin/env bash\necho \"$@\" > "+argsFile+"\nexit 0\n"))
+	timeoutArg := func() time.Duration {
+		b, _ := os.ReadFile(argsFile)
+		f := strings.Fields(string(b))
+		for i := range f[:len(f)-1] {
+			if f[i] == "--timeout" {
+				d, err := time.ParseDuration(f[i+1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				return d
+			}
+		}
+		t.Fatalf("no --timeout in %q", b)
+		return 0
+	}
+	for _, tc := range []struct {
+		left     time.Duration
+		min, max time.Duration
+	}{
+		{0, 15 * time.Minute, 15 * time.Minute},
+		{time.Hour, 15 * time.Minute, 15 * time.Minute},
+		{10 * time.Minute, 9*time.Minute + 29*time.Second, 9*time.Minute + 30*time.Second},
+		{40 * time.Second, 19 * time.Second, 20 * time.Second},
+	} {
+		ctx := context.Background()
+		if tc.left > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tc.left)
+			defer cancel()
+		}
+		if err := h.InstallOrUpgrade(ctx, "r", "c", "", "ns", "", true, 15*time.Minute, false, nil); err != nil {
+			t.Fatalf("install: %v", err)
+		}
+		if got := timeoutArg(); got < tc.min || got > tc.max {
+			t.Fatalf("with %s left: --timeout %s, want between %s and %s", tc.left, got, tc.min, tc.max)
+		}
+		if err := h.Uninstall(ctx, "r", "ns", true, 15*time.Minute); err != nil {
+			t.Fatalf("uninstall: %v", err)
+		}
+		if got := timeoutArg(); got < tc.min || got > tc.max {
+			t.Fatalf("uninstall with %s left: --timeout %s", tc.left, got)
+		}
+	}
+}
+
+func TestHelmClient_Template(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	path := writeFailHelm(t, "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\necho 'kind: Pod'\necho 'warning' >&2\nexit 0\n")
+	h := NewClient(path)
+	h.Kubeconfig = "/tmp/kstack-kubeconfig"
+	out, err := h.Template(context.Background(), "r", "repo/c", "", "ns", "v.yaml", []string{"a=b"}, true)
+	if err != nil || out != "kind: Pod\n" {
+		t.Fatalf("template: out=%q err=%v", out, err)
+	}
+	b, _ := os.ReadFile(argsFile)
+	if got := strings.TrimSpace(string(b)); got != "template r repo/c -n ns -f v.yaml --set a=b --include-crds" {
+		t.Fatalf("unexpected helm args: %q", got)
+	}
+}
+
+func TestHelmClient_PlanUpgrade(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	path := writeFailHelm(t, "#!/usr/bin/env bash\necho \"$@\" >> "+argsFile+"\necho '{\"name\":\"r\",\"manifest\":\"---\\nkind: Pod\\n\"}'\nexit 0\n")
+	h := NewClient(path)
+	h.Kubeconfig = "/tmp/kstack-kubeconfig"
+	out, err := h.PlanUpgrade(context.Background(), "r", "repo/c", "1.2.3", "ns", "v.yaml", []string{"a=b"})
+	if err != nil || out != "---\nkind: Pod\n" {
+		t.Fatalf("plan: out=%q err=%v", out, err)
+	}
+	b, _ := os.ReadFile(argsFile)
+	if got := strings.TrimSpace(string(b)); got != "upgrade --install r repo/c --version 1.2.3 -n ns -f v.yaml --set a=b --dry-run=server -o json --kubeconfig /tmp/kstack-kubeconfig" {
+		t.Fatalf("unexpected helm args: %q", got)
+	}
+}
+
+func TestHelmClient_IsolatedReposUpdatedOnce(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	path := writeFailHelm(t, "#!/usr/bin/env bash\necho \"$HELM_REPOSITORY_CONFIG $HELM_REPOSITORY_CACHE $*\" >> "+argsFile+"\nexit 0\n")
+	h := NewClient(path)
+	h.RepositoryConfig = "/tmp/kstack/helm/repositories.yaml"
+	h.RepositoryCache = "/tmp/kstack/helm/repository"
+	for i := 0; i < 2; i++ {
+		if err := h.RepoAdd(context.Background(), "grafana", "https://grafana.github.io/helm-charts"); err != nil {
+			t.Fatalf("repo add: %v", err)
+		}
+		if err := h.RepoUpdate(context.Background(), "grafana"); err != nil {
+			t.Fatalf("repo update: %v", err)
+		}
+	}
+	if err := h.RepoUpdate(context.Background(), "grafana", "bitnami"); err != nil {
+		t.Fatalf("repo update: %v", err)
+	}
+	b, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/tmp/kstack/helm/repositories.yaml /tmp/kstack/helm/repository repo add grafana https://grafana.github.io/helm-charts --force-update",
+		"/tmp/kstack/helm/repositories.yaml /tmp/kstack/helm/repository repo update grafana",
+		"/tmp/kstack/helm/repositories.yaml /tmp/kstack/helm/repository repo update bitnami",
+	}
+	if got := strings.Split(strings.TrimSpace(string(b)), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("helm invocations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
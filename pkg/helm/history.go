@@ -0,0 +1,193 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christk1/kstack/utils"
+)
+
+// Revision is one revision of a release as listed by `helm history`.
+type Revision struct {
+	Revision    int       `json:"revision"`
+	Updated     time.Time `json:"updated"`
+	Status      string    `json:"status"`
+	Chart       string    `json:"chart"`
+	AppVersion  string    `json:"app_version"`
+	Description string    `json:"description"`
+}
+
+// History returns the revisions helm keeps of a release, oldest first:
+// `helm history <release> -n <ns> -o json`. A release that is not installed
+// yields an error of kind ErrReleaseNotFound.
+func (h *HelmClient) History(ctx context.Context, release, namespace string) ([]Revision, error) {
+	args := append([]string{"history", release, "-n", namespace, "-o", "json"}, h.kubeArgs()...)
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return nil, nil
+	}
+	cmd := h.command(ctx, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, commandError(ctx, "history", err, stderr.String())
+	}
+	var revs []Revision
+	if err := json.Unmarshal(out, &revs); err != nil {
+		return nil, fmt.Errorf("parse helm history output: %w: %s", err, string(out))
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Revision < revs[j].Revision })
+	return revs, nil
+}
+
+// RevisionValues returns the user-supplied values of a revision of a
+// release as JSON: `helm get values <release> --revision <n> -o json`. A
+// revision of 0 selects the current one.
+func (h *HelmClient) RevisionValues(ctx context.Context, release, namespace string, revision int) ([]byte, error) {
+	args := []string{"get", "values", release, "-n", namespace, "-o", "json"}
+	if revision > 0 {
+		args = append(args, "--revision", strconv.Itoa(revision))
+	}
+	args = append(args, h.kubeArgs()...)
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return nil, nil
+	}
+	cmd := h.command(ctx, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, commandError(ctx, "get values", err, stderr.String())
+	}
+	return out, nil
+}
+
+// Rollback rolls a release back to revision, or to the previous revision
+// if revision is 0: `helm rollback <release> [revision] -n <ns>`. If wait is
+// true, it adds `--wait` and `--timeout` with the provided timeout, shortened
+// to expire before the deadline of ctx.
+func (h *HelmClient) Rollback(ctx context.Context, release, namespace string, revision int, wait bool, timeout time.Duration) error {
+	args := []string{"rollback", release}
+	if revision > 0 {
+		args = append(args, strconv.Itoa(revision))
+	}
+	args = append(args, "-n", namespace)
+	if wait {
+		args = append(args, "--wait", "--timeout", helmTimeout(ctx, timeout).String())
+	}
+	args = append(args, h.kubeArgs()...)
+	if h.DryRun {
+		utils.Info("DRY-RUN: %s %s", h.Path, strings.Join(args, " "))
+		return nil
+	}
+	out, err := utils.Run(h.command(ctx, args...), release)
+	if err != nil {
+		return commandError(ctx, "rollback", err, string(out))
+	}
+	return nil
+}
+
+// ValuesDiff lists the values, as dotted keys such as "persistence.size",
+// that differ between two revisions. Lists are compared as a whole.
+type ValuesDiff struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// DiffValues compares two sets of values given as JSON (e.g. from
+// RevisionValues).
+func DiffValues(from, to []byte) (ValuesDiff, error) {
+	var d ValuesDiff
+	old, err := flattenValues(from)
+	if err != nil {
+		return d, err
+	}
+	cur, err := flattenValues(to)
+	if err != nil {
+		return d, err
+	}
+	for k, v := range cur {
+		prev, ok := old[k]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, k)
+		case !reflect.DeepEqual(prev, v):
+			d.Changed = append(d.Changed, k)
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Changed)
+	sort.Strings(d.Removed)
+	return d, nil
+}
+
+// Empty reports whether the values are the same.
+func (d ValuesDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// Summary describes the difference in one line, marking added keys with
+// "+", changed ones with "~" and removed ones with "-". At most limit keys
+// are named.
+func (d ValuesDiff) Summary(limit int) string {
+	if d.Empty() {
+		return "unchanged"
+	}
+	var keys []string
+	for _, k := range d.Added {
+		keys = append(keys, "+"+k)
+	}
+	for _, k := range d.Changed {
+		keys = append(keys, "~"+k)
+	}
+	for _, k := range d.Removed {
+		keys = append(keys, "-"+k)
+	}
+	if limit > 0 && len(keys) > limit {
+		return fmt.Sprintf("%s (+%d more)", strings.Join(keys[:limit], " "), len(keys)-limit)
+	}
+	return strings.Join(keys, " ")
+}
+
+// flattenValues maps the dotted key of every leaf of values to its value.
+func flattenValues(values []byte) (map[string]any, error) {
+	var v any
+	if len(strings.TrimSpace(string(values))) > 0 {
+		if err := json.Unmarshal(values, &v); err != nil {
+			return nil, fmt.Errorf("parse values: %w", err)
+		}
+	}
+	out := map[string]any{}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		m, ok := v.(map[string]any)
+		if !ok || (len(m) == 0 && prefix != "") {
+			if prefix != "" {
+				out[prefix] = v
+			}
+			return
+		}
+		for k, child := range m {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			walk(k, child)
+		}
+	}
+	walk("", v)
+	return out, nil
+}
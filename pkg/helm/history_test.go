@@ -0,0 +1,102 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory_ParsesAndSortsRevisions(t *testing.T) {
+	h := NewClient(writeFailHelm(t, `#!/usr/bin/env bash
+if [ "$1" = "history" ]; then
+cat <<'EOF'
+[{"revision":2,"updated":"2026-10-15T17:40:31.5+02:00","status":"deployed","chart":"grafana-8.5.2","app_version":"11.2.1","description":"Upgrade complete"},
+ {"revision":1,"updated":"2026-10-12T09:14:02Z","status":"superseded","chart":"grafana-8.5.1","app_version":"11.2.0","description":"Install complete"}]
+EOF
+fi
+`))
+	revs, err := h.History(context.Background(), "grafana", "monitoring")
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(revs) != 2 || revs[0].Revision != 1 || revs[1].Revision != 2 {
+		t.Fatalf("revisions not sorted oldest first: %+v", revs)
+	}
+	if revs[1].Chart != "grafana-8.5.2" || revs[1].AppVersion != "11.2.1" || revs[1].Status != "deployed" {
+		t.Fatalf("unexpected revision: %+v", revs[1])
+	}
+	if want := time.Date(2026, 10, 12, 9, 14, 2, 0, time.UTC); !revs[0].Updated.Equal(want) {
+		t.Fatalf("updated = %v, want %v", revs[0].Updated, want)
+	}
+}
+
+func TestHistory_NotInstalled(t *testing.T) {
+	h := NewClient(writeFailHelm(t, "#!/usr/bin/env bash\necho 'Error: release: not found' >&2\nexit 1\n"))
+	_, err := h.History(context.Background(), "grafana", "monitoring")
+	if !errors.Is(err, ErrReleaseNotFound) {
+		t.Fatalf("expected ErrReleaseNotFound, got %v", err)
+	}
+}
+
+func TestRevisionValuesAndRollback_Args(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "args")
+	h := NewClient(writeFailHelm(t, "#!/usr/bin/env bash\necho \"$@\" >> "+log+"\necho '{}'\n"))
+	h.KubeContext = "kind-dev"
+	ctx := context.Background()
+	if _, err := h.RevisionValues(ctx, "grafana", "monitoring", 3); err != nil {
+		t.Fatalf("values: %v", err)
+	}
+	if err := h.Rollback(ctx, "grafana", "monitoring", 2, true, 5*time.Minute); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if err := h.Rollback(ctx, "grafana", "monitoring", 0, false, time.Minute); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(string(b)), "\n")
+	want := []string{
+		"get values grafana -n monitoring -o json --revision 3 --kube-context kind-dev",
+		"rollback grafana 2 -n monitoring --wait --timeout 5m0s --kube-context kind-dev",
+		"rollback grafana -n monitoring --kube-context kind-dev",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("args:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	from := `{"adminPassword":"a","persistence":{"enabled":false,"size":"1Gi"},"ingress":{"hosts":["a"]},"old":1}`
+	to := `{"adminPassword":"b","persistence":{"enabled":false,"size":"1Gi","storageClass":"fast"},"ingress":{"hosts":["a","b"]}}`
+	d, err := DiffValues([]byte(from), []byte(to))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Summary(0); got != "+persistence.storageClass ~adminPassword ~ingress.hosts -old" {
+		t.Fatalf("summary = %q", got)
+	}
+	if got := d.Summary(2); got != "+persistence.storageClass ~adminPassword (+2 more)" {
+		t.Fatalf("limited summary = %q", got)
+	}
+
+	d, err = DiffValues([]byte("null\n"), []byte(`{"a":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Summary(3); got != "+a" {
+		t.Fatalf("summary = %q", got)
+	}
+	if d, _ := DiffValues([]byte(from), []byte(from)); !d.Empty() || d.Summary(3) != "unchanged" {
+		t.Fatalf("expected no difference, got %+v", d)
+	}
+	if _, err := DiffValues([]byte("{"), nil); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
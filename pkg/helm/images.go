@@ -0,0 +1,56 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ManifestImages returns the container images referenced by rendered
+// manifests, sorted and without duplicates. Every string-valued `image`
+// field is collected, which covers pod templates as well as custom
+// resources such as the Prometheus operator's.
+func ManifestImages(manifests string) ([]string, error) {
+	seen := map[string]bool{}
+	dec := yaml.NewDecoder(strings.NewReader(manifests))
+	for {
+		var doc any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse rendered manifests: %w", err)
+		}
+		collectImages(doc, seen)
+	}
+	out := make([]string, 0, len(seen))
+	for img := range seen {
+		out = append(out, img)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func collectImages(v any, seen map[string]bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if img, ok := child.(string); ok && k == "image" {
+				if img = strings.TrimSpace(img); img != "" && !strings.ContainsAny(img, " \t{}") {
+					seen[img] = true
+				}
+				continue
+			}
+			collectImages(child, seen)
+		}
+	case []any:
+		for _, child := range t {
+			collectImages(child, seen)
+		}
+	}
+}
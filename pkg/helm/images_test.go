@@ -0,0 +1,47 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManifestImages(t *testing.T) {
+	manifests := `---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: init
+          image: busybox:1.36
+      containers:
+        - name: app
+          image: docker.io/bitnami/postgresql:16.4.0
+        - name: sidecar
+          image: busybox:1.36
+---
+# empty document
+---
+apiVersion: monitoring.coreos.com/v1
+kind: Prometheus
+spec:
+  image: quay.io/prometheus/prometheus:v2.54.1
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  image: "{{ not an image }}"
+`
+	got, err := ManifestImages(manifests)
+	if err != nil {
+		t.Fatalf("ManifestImages: %v", err)
+	}
+	want := []string{"busybox:1.36", "docker.io/bitnami/postgresql:16.4.0", "quay.io/prometheus/prometheus:v2.54.1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ManifestImages = %v, want %v", got, want)
+	}
+	if _, err := ManifestImages("a: [unterminated"); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
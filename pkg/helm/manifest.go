@@ -0,0 +1,145 @@
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Object is a Kubernetes object of a rendered or deployed manifest.
+type Object struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Source is the chart template the object was rendered from, taken
+	// from helm's "# Source:" comment.
+	Source string
+	// Hook is the helm.sh/hook annotation of hook resources (e.g.
+	// "pre-install" or "test"), which helm runs around installs and tests
+	// but does not record in a release.
+	Hook string
+	// YAML is the object's document without the comment.
+	YAML string
+}
+
+// Key identifies the object within a release, e.g.
+// "Deployment monitoring/grafana" or "ClusterRole grafana-clusterrole".
+func (o Object) Key() string {
+	if o.Namespace == "" {
+		return o.Kind + " " + o.Name
+	}
+	return o.Kind + " " + o.Namespace + "/" + o.Name
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// SplitManifest splits manifests, as printed by `helm template` or `helm get
+// manifest`, into their objects.
+func SplitManifest(manifests string) ([]Object, error) {
+	var objects []Object
+	for _, doc := range documentSeparator.Split(manifests, -1) {
+		var meta struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Metadata   struct {
+				Name        string            `yaml:"name"`
+				Namespace   string            `yaml:"namespace"`
+				Annotations map[string]string `yaml:"annotations"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &meta); err != nil {
+			return nil, fmt.Errorf("parse manifest: %w", err)
+		}
+		if meta.Kind == "" {
+			// empty document
+			continue
+		}
+		obj := Object{
+			APIVersion: meta.APIVersion,
+			Kind:       meta.Kind,
+			Namespace:  meta.Metadata.Namespace,
+			Name:       meta.Metadata.Name,
+			Hook:       meta.Metadata.Annotations["helm.sh/hook"],
+		}
+		var body []string
+		for _, line := range strings.Split(strings.Trim(doc, "\n"), "\n") {
+			if src, ok := strings.CutPrefix(line, "# Source: "); ok && len(body) == 0 {
+				obj.Source = src
+				continue
+			}
+			body = append(body, line)
+		}
+		obj.YAML = strings.Join(body, "\n") + "\n"
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// RedactSecret hides the values under data and stringData of two versions
+// of a Secret's YAML (either may be ""), so that a diff of them shows which
+// keys change without printing credentials. A value that differs between
+// the versions is redacted as "<redacted, changed>" on the newer side.
+func RedactSecret(from, to string) (string, string) {
+	old, oldValues := secretValues(from)
+	cur, curValues := secretValues(to)
+	for k, v := range curValues {
+		if o, ok := oldValues[k]; ok && o.Value != v.Value {
+			v.Value = "<redacted, changed>"
+		} else {
+			v.Value = "<redacted>"
+		}
+		v.Tag, v.Style = "!!str", 0
+	}
+	for _, v := range oldValues {
+		v.Value, v.Tag, v.Style = "<redacted>", "!!str", 0
+	}
+	return encodeSecret(from, old), encodeSecret(to, cur)
+}
+
+// secretValues parses a Secret and returns its scalar data and stringData
+// values by "data.<key>" or "stringData.<key>".
+func secretValues(yml string) (*yaml.Node, map[string]*yaml.Node) {
+	values := map[string]*yaml.Node{}
+	var doc yaml.Node
+	if strings.TrimSpace(yml) == "" || yaml.Unmarshal([]byte(yml), &doc) != nil || len(doc.Content) == 0 {
+		return nil, values
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, values
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		field, m := root.Content[i].Value, root.Content[i+1]
+		if (field != "data" && field != "stringData") || m.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(m.Content); j += 2 {
+			if m.Content[j+1].Kind == yaml.ScalarNode {
+				values[field+"."+m.Content[j].Value] = m.Content[j+1]
+			}
+		}
+	}
+	return &doc, values
+}
+
+// encodeSecret formats a redacted Secret. YAML that could not be parsed is
+// replaced by a placeholder as a whole.
+func encodeSecret(yml string, doc *yaml.Node) string {
+	if strings.TrimSpace(yml) == "" {
+		return yml
+	}
+	if doc == nil {
+		return "# Secret redacted\n"
+	}
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "# Secret redacted\n"
+	}
+	enc.Close()
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package helm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitManifest(t *testing.T) {
+	manifests := `---
+# Source: grafana/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana
+  namespace: monitoring
+data:
+  a: "1"
+---
+# Source: grafana/templates/clusterrole.yaml
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: grafana-clusterrole
+---
+# Source: grafana/templates/tests/test.yaml
+apiVersion: v1
+kind: Pod
+metadata:
+  name: grafana-test
+  annotations:
+    "helm.sh/hook": test
+---
+`
+	objs, err := SplitManifest(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 3 || objs[0].Hook != "" || objs[2].Hook != "test" {
+		t.Fatalf("expected 3 objects, the last a hook, got %+v", objs)
+	}
+	if objs[0].Key() != "ConfigMap monitoring/grafana" || objs[1].Key() != "ClusterRole grafana-clusterrole" {
+		t.Fatalf("unexpected keys %q, %q", objs[0].Key(), objs[1].Key())
+	}
+	if objs[0].Source != "grafana/templates/configmap.yaml" || objs[0].YAML[:11] != "apiVersion:" {
+		t.Fatalf("expected the source comment split off, got %+v", objs[0])
+	}
+	if _, err := SplitManifest("kind: [\n"); err == nil {
+		t.Fatalf("expected a parse error")
+	}
+}
+
+func TestRedactSecret(t *testing.T) {
+	deployed := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: b2xk\n  user: YWRtaW4=\n"
+	rendered := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: bmV3\n  user: YWRtaW4=\nstringData:\n  token: |\n    multi\n    line\n"
+	from, to := RedactSecret(deployed, rendered)
+	for _, s := range []string{"b2xk", "bmV3", "YWRtaW4=", "multi"} {
+		if strings.Contains(from+to, s) {
+			t.Fatalf("secret value %q not redacted:\n%s\n%s", s, from, to)
+		}
+	}
+	if !strings.Contains(from, "password: <redacted>\n") || !strings.Contains(to, "password: <redacted, changed>\n") {
+		t.Fatalf("expected the changed key to be marked:\n%s\n%s", from, to)
+	}
+	if !strings.Contains(to, "  user: <redacted>\n") || !strings.Contains(to, "  token: <redacted>\n") || !strings.Contains(to, "  name: db\n") {
+		t.Fatalf("unexpected redacted secret:\n%s", to)
+	}
+
+	from, to = RedactSecret("", "kind: Secret\ndata: [")
+	if from != "" || to != "# Secret redacted\n" {
+		t.Fatalf("expected an unparseable secret to be replaced, got %q %q", from, to)
+	}
+}
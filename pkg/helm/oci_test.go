@@ -0,0 +1,134 @@
+package helm
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOCIChartRefs(t *testing.T) {
+	if !IsOCIChart("oci://registry-1.docker.io/bitnamicharts/kafka") || IsOCIChart("bitnami/kafka") {
+		t.Fatalf("IsOCIChart misclassifies charts")
+	}
+	if got := OCIHost("oci://localhost:5001/charts/app"); got != "localhost:5001" {
+		t.Fatalf("OCIHost = %q", got)
+	}
+	for host, want := range map[string]bool{"localhost:5001": true, "127.0.0.1:5000": true, "[::1]:5000": true, "localhost": true, "ghcr.io": false, "registry.local:5000": false} {
+		if got := IsLoopbackHost(host); got != want {
+			t.Fatalf("IsLoopbackHost(%q) = %v", host, got)
+		}
+	}
+	if got := chartArgs("oci://localhost:5001/charts/app", "1.0.0"); !reflect.DeepEqual(got, []string{"--version", "1.0.0", "--plain-http"}) {
+		t.Fatalf("chartArgs = %v", got)
+	}
+	if got := chartArgs("oci://ghcr.io/org/app", ""); got != nil {
+		t.Fatalf("chartArgs = %v", got)
+	}
+}
+
+func TestHelmClient_RegistryLogin(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	path := writeFailHelm(t, "#!/usr/bin/env bash\necho \"$HELM_REGISTRY_CONFIG $* $(cat)\" >> "+argsFile+"\nexit 0\n")
+	h := NewClient(path)
+	h.RegistryConfig = "/tmp/kstack/helm/registry/config.json"
+	for i := 0; i < 2; i++ {
+		if err := h.RegistryLogin(context.Background(), "ghcr.io", "bot", "s3cret"); err != nil {
+			t.Fatalf("login: %v", err)
+		}
+	}
+	if err := h.RegistryLogin(context.Background(), "localhost:5001", "dev", "pw"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	b, _ := os.ReadFile(argsFile)
+	want := "/tmp/kstack/helm/registry/config.json registry login ghcr.io --username bot --password-stdin s3cret\n" +
+		"/tmp/kstack/helm/registry/config.json registry login localhost:5001 --username dev --password-stdin --insecure pw\n"
+	if string(b) != want {
+		t.Fatalf("helm invocations:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestCredentials_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kstack", "credentials.yaml")
+	creds, err := LoadCredentials(path)
+	if err != nil || len(creds) != 0 {
+		t.Fatalf("missing file should load empty: %v %v", creds, err)
+	}
+	creds["ghcr.io"] = Credential{Username: "bot", Password: "s3cret"}
+	creds["docker.io"] = Credential{Username: "me", Password: "pw"}
+	if err := creds.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Fatalf("credentials should be private, got %v", fi.Mode())
+	}
+	got, err := LoadCredentials(path)
+	if err != nil || !reflect.DeepEqual(got, creds) || !reflect.DeepEqual(got.Hosts(), []string{"docker.io", "ghcr.io"}) {
+		t.Fatalf("round trip: %v %v", got, err)
+	}
+}
+
+// TestOCI_LocalRegistry pushes the example chart to a throwaway registry:2
+// container and pulls and renders it as an oci:// chart. It needs docker
+// and helm and is skipped without them.
+func TestOCI_LocalRegistry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping registry container in -short mode")
+	}
+	for _, bin := range []string{"docker", "helm"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not available", bin)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := exec.CommandContext(ctx, "docker", "info").Run(); err != nil {
+		t.Skip("docker daemon not reachable")
+	}
+	out, err := exec.CommandContext(ctx, "docker", "run", "-d", "--rm", "-p", "127.0.0.1::5000", "registry:2").CombinedOutput()
+	if err != nil {
+		t.Skipf("cannot start registry:2: %v: %s", err, out)
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() { exec.Command("docker", "rm", "-f", id).Run() })
+	out, err = exec.CommandContext(ctx, "docker", "port", id, "5000/tcp").CombinedOutput()
+	if err != nil {
+		t.Fatalf("docker port: %v: %s", err, out)
+	}
+	host := strings.TrimSpace(strings.Split(string(out), "\n")[0])
+
+	dir := t.TempDir()
+	h := NewClient("helm")
+	h.RegistryConfig = filepath.Join(dir, "registry.json")
+	archive, err := h.Pull(context.Background(), "../addons/exampleapp/chart", "", dir)
+	if err != nil {
+		t.Fatalf("package: %v", err)
+	}
+	var pushErr error
+	for i := 0; i < 20; i++ { // the registry takes a moment to listen
+		if out, pushErr = h.command(ctx, "push", archive, "oci://"+host+"/charts", "--plain-http").CombinedOutput(); pushErr == nil {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	if pushErr != nil {
+		t.Fatalf("helm push: %v: %s", pushErr, out)
+	}
+
+	chart := "oci://" + host + "/charts/example-app"
+	pulled, err := h.Pull(context.Background(), chart, "0.1.0", filepath.Join(dir, "pulled"))
+	if err != nil {
+		t.Fatalf("pull %s: %v", chart, err)
+	}
+	if meta, err := ReadChartMetadata(pulled); err != nil || meta.Name != "example-app" || meta.Version != "0.1.0" {
+		t.Fatalf("pulled chart metadata: %+v %v", meta, err)
+	}
+	manifests, err := h.Template(context.Background(), "app", chart, "0.1.0", "app", "", nil, false)
+	if err != nil || !strings.Contains(manifests, "kind: Deployment") {
+		t.Fatalf("template %s: %v\n%s", chart, err, manifests)
+	}
+}
@@ -0,0 +1,403 @@
+// Package kubeconfig reads kubeconfig files and talks to the API server
+// they point at, without depending on client-go.
+package kubeconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Config is a kubeconfig file. Fields kstack does not interpret are kept in
+// the inline maps so that files round-trip without losing data.
+type Config struct {
+	APIVersion     string         `yaml:"apiVersion"`
+	Kind           string         `yaml:"kind"`
+	Clusters       []NamedCluster `yaml:"clusters"`
+	Contexts       []NamedContext `yaml:"contexts"`
+	Users          []NamedUser    `yaml:"users"`
+	CurrentContext string         `yaml:"current-context"`
+	Preferences    map[string]any `yaml:"preferences,omitempty"`
+	Extra          map[string]any `yaml:",inline"`
+}
+
+// NamedCluster is an entry of the `clusters` list.
+type NamedCluster struct {
+	Name    string  `yaml:"name"`
+	Cluster Cluster `yaml:"cluster"`
+}
+
+// Cluster holds the API server endpoint and how to trust it.
+type Cluster struct {
+	Server                   string         `yaml:"server"`
+	CertificateAuthorityData string         `yaml:"certificate-authority-data,omitempty"`
+	CertificateAuthority     string         `yaml:"certificate-authority,omitempty"`
+	InsecureSkipTLSVerify    bool           `yaml:"insecure-skip-tls-verify,omitempty"`
+	Extra                    map[string]any `yaml:",inline"`
+}
+
+// NamedContext is an entry of the `contexts` list.
+type NamedContext struct {
+	Name    string  `yaml:"name"`
+	Context Context `yaml:"context"`
+}
+
+// Context binds a cluster to a user (and optionally a namespace).
+type Context struct {
+	Cluster   string         `yaml:"cluster"`
+	User      string         `yaml:"user"`
+	Namespace string         `yaml:"namespace,omitempty"`
+	Extra     map[string]any `yaml:",inline"`
+}
+
+// NamedUser is an entry of the `users` list. User credentials take many
+// shapes (certs, tokens, exec plugins) and are kept as a generic map.
+type NamedUser struct {
+	Name string         `yaml:"name"`
+	User map[string]any `yaml:"user"`
+}
+
+// Load reads and parses the kubeconfig at path.
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read kubeconfig: %w", err)
+	}
+	return Parse(b)
+}
+
+// Parse parses kubeconfig bytes.
+func Parse(b []byte) (*Config, error) {
+	var c Config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+	return &c, nil
+}
+
+// Marshal serializes the kubeconfig.
+func (c *Config) Marshal() ([]byte, error) {
+	if c.APIVersion == "" {
+		c.APIVersion = "v1"
+	}
+	if c.Kind == "" {
+		c.Kind = "Config"
+	}
+	return yaml.Marshal(c)
+}
+
+// Resolve returns the context, cluster and user entries for contextName, or
+// for the current context when contextName is empty.
+func (c *Config) Resolve(contextName string) (Context, Cluster, map[string]any, error) {
+	if contextName == "" {
+		contextName = c.CurrentContext
+	}
+	if contextName == "" {
+		return Context{}, Cluster{}, nil, fmt.Errorf("kubeconfig has no current-context; pass a context name")
+	}
+	var ctx *Context
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == contextName {
+			ctx = &c.Contexts[i].Context
+			break
+		}
+	}
+	if ctx == nil {
+		return Context{}, Cluster{}, nil, fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	var cl *Cluster
+	for i := range c.Clusters {
+		if c.Clusters[i].Name == ctx.Cluster {
+			cl = &c.Clusters[i].Cluster
+			break
+		}
+	}
+	if cl == nil {
+		return Context{}, Cluster{}, nil, fmt.Errorf("cluster %q of context %q not found in kubeconfig", ctx.Cluster, contextName)
+	}
+	var user map[string]any
+	for i := range c.Users {
+		if c.Users[i].Name == ctx.User {
+			user = c.Users[i].User
+			break
+		}
+	}
+	return *ctx, *cl, user, nil
+}
+
+// Minify returns a kubeconfig holding only contextName (or the current
+// context) and the cluster and user it refers to, with that context current.
+func (c *Config) Minify(contextName string) (*Config, error) {
+	if contextName == "" {
+		contextName = c.CurrentContext
+	}
+	ctx, cl, user, err := c.Resolve(contextName)
+	if err != nil {
+		return nil, err
+	}
+	out := &Config{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []NamedCluster{{Name: ctx.Cluster, Cluster: cl}},
+		Contexts:       []NamedContext{{Name: contextName, Context: ctx}},
+		CurrentContext: contextName,
+	}
+	if user != nil {
+		out.Users = []NamedUser{{Name: ctx.User, User: user}}
+	}
+	return out, nil
+}
+
+// Merge copies the current context of src, with its cluster and user, into
+// c under name, replacing entries of that name, and makes it current.
+func (c *Config) Merge(src *Config, name string) error {
+	ctx, cl, user, err := src.Resolve("")
+	if err != nil {
+		return err
+	}
+	c.Remove(name)
+	ctx.Cluster, ctx.User = name, name
+	c.Clusters = append(c.Clusters, NamedCluster{Name: name, Cluster: cl})
+	c.Contexts = append(c.Contexts, NamedContext{Name: name, Context: ctx})
+	c.Users = append(c.Users, NamedUser{Name: name, User: user})
+	c.CurrentContext = name
+	return nil
+}
+
+// Remove deletes the context, cluster and user called name, clearing the
+// current context if it was name. It reports whether anything was removed.
+func (c *Config) Remove(name string) bool {
+	n := len(c.Clusters) + len(c.Contexts) + len(c.Users)
+	clusters := c.Clusters[:0]
+	for _, e := range c.Clusters {
+		if e.Name != name {
+			clusters = append(clusters, e)
+		}
+	}
+	contexts := c.Contexts[:0]
+	for _, e := range c.Contexts {
+		if e.Name != name {
+			contexts = append(contexts, e)
+		}
+	}
+	users := c.Users[:0]
+	for _, e := range c.Users {
+		if e.Name != name {
+			users = append(users, e)
+		}
+	}
+	c.Clusters, c.Contexts, c.Users = clusters, contexts, users
+	if c.CurrentContext == name {
+		c.CurrentContext = ""
+	}
+	return len(c.Clusters)+len(c.Contexts)+len(c.Users) != n
+}
+
+// SetServer points every cluster entry at server.
+func (c *Config) SetServer(server string) {
+	for i := range c.Clusters {
+		c.Clusters[i].Cluster.Server = server
+	}
+}
+
+// Save writes the kubeconfig to path, readable only by the owner, creating
+// parent directories as needed.
+func (c *Config) Save(path string) error {
+	b, err := c.Marshal()
+	if err != nil {
+		return fmt.Errorf("serialize kubeconfig: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create kubeconfig dir: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return fmt.Errorf("write kubeconfig: %w", err)
+	}
+	return nil
+}
+
+// DefaultPath returns the kubeconfig kubectl uses by default: the first
+// entry of $KUBECONFIG, or ~/.kube/config.
+func DefaultPath() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+// VersionInfo is the subset of the API server's /version response kstack uses.
+type VersionInfo struct {
+	Major      string `json:"major"`
+	Minor      string `json:"minor"`
+	GitVersion string `json:"gitVersion"`
+}
+
+// ServerVersion queries the /version endpoint of the API server selected by
+// the kubeconfig at path and contextName (empty means current context).
+func ServerVersion(ctx context.Context, path, contextName string) (VersionInfo, error) {
+	var v VersionInfo
+	c, err := Load(path)
+	if err != nil {
+		return v, err
+	}
+	client, server, err := c.httpClient(contextName)
+	if err != nil {
+		return v, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(server, "/")+"/version", nil)
+	if err != nil {
+		return v, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return v, fmt.Errorf("API server %s unreachable: %w", server, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return v, fmt.Errorf("API server %s returned %s: %s", server, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return v, fmt.Errorf("parse /version response: %w", err)
+	}
+	return v, nil
+}
+
+// ApplyConfigMap creates the ConfigMap namespace/name with data, replacing
+// it if it already exists, on the API server selected by the kubeconfig at
+// path and contextName.
+func ApplyConfigMap(ctx context.Context, path, contextName, namespace, name string, data map[string]string) error {
+	c, err := Load(path)
+	if err != nil {
+		return err
+	}
+	client, server, err := c.httpClient(contextName)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]string{"name": name, "namespace": namespace},
+		"data":       data,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	base := strings.TrimSuffix(server, "/") + "/api/v1/namespaces/" + namespace + "/configmaps"
+	status, msg, err := send(ctx, client, http.MethodPost, base, body)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusConflict {
+		status, msg, err = send(ctx, client, http.MethodPut, base+"/"+name, body)
+		if err != nil {
+			return err
+		}
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("apply configmap %s/%s: API server returned %d: %s", namespace, name, status, msg)
+	}
+	return nil
+}
+
+// send issues a JSON request and returns the status code and response body.
+func send(ctx context.Context, client *http.Client, method, url string, body []byte) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("API server unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, strings.TrimSpace(string(b)), nil
+}
+
+// httpClient builds an HTTP client trusting the cluster CA and presenting
+// the user's client certificate or bearer token, if any.
+func (c *Config) httpClient(contextName string) (*http.Client, string, error) {
+	_, cl, user, err := c.Resolve(contextName)
+	if err != nil {
+		return nil, "", err
+	}
+	tlsCfg := &tls.Config{InsecureSkipVerify: cl.InsecureSkipTLSVerify}
+	if ca, err := pemData(cl.CertificateAuthorityData, cl.CertificateAuthority); err != nil {
+		return nil, "", fmt.Errorf("cluster CA: %w", err)
+	} else if ca != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, "", fmt.Errorf("cluster CA: no certificates found")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	cert, _ := user["client-certificate-data"].(string)
+	key, _ := user["client-key-data"].(string)
+	certFile, _ := user["client-certificate"].(string)
+	keyFile, _ := user["client-key"].(string)
+	certPEM, err := pemData(cert, certFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("client certificate: %w", err)
+	}
+	keyPEM, err := pemData(key, keyFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("client key: %w", err)
+	}
+	if certPEM != nil && keyPEM != nil {
+		pair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, "", fmt.Errorf("client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{pair}
+	}
+	var rt http.RoundTripper = &http.Transport{TLSClientConfig: tlsCfg, Proxy: http.ProxyFromEnvironment}
+	if token, _ := user["token"].(string); token != "" {
+		rt = bearerTransport{token: token, next: rt}
+	}
+	return &http.Client{Transport: rt}, cl.Server, nil
+}
+
+// pemData returns base64-decoded inline data, or the contents of file.
+func pemData(data, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
+
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(r)
+}
@@ -0,0 +1,176 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKubeconfig(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatalf("write kubeconfig: %v", err)
+	}
+	return p
+}
+
+func TestServerVersion_TLSWithToken(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" || r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"major":"1","minor":"30","gitVersion":"v1.30.0"}`))
+	}))
+	defer srv.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	p := writeKubeconfig(t, `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: `+srv.URL+`
+    certificate-authority-data: `+base64.StdEncoding.EncodeToString(ca)+`
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev}
+users:
+- name: dev
+  user: {token: s3cret}
+`)
+	v, err := ServerVersion(context.Background(), p, "")
+	if err != nil {
+		t.Fatalf("ServerVersion: %v", err)
+	}
+	if v.GitVersion != "v1.30.0" || v.Minor != "30" {
+		t.Fatalf("unexpected version: %+v", v)
+	}
+	if _, err := ServerVersion(context.Background(), p, "missing"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected unknown context error, got %v", err)
+	}
+}
+
+func TestParse_RoundTripKeepsUnknownFields(t *testing.T) {
+	c, err := Parse([]byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: a
+  cluster: {server: "https://127.0.0.1:6443", proxy-url: "http://proxy"}
+users:
+- name: a
+  user:
+    exec: {command: aws}
+extensions:
+- name: client.example.com
+  extension: {last-update: "2026-10-18"}
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	for _, want := range []string{"proxy-url", "exec:", "command: aws", "extensions:", "name: client.example.com", "last-update:"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q preserved:\n%s", want, b)
+		}
+	}
+}
+
+func TestMergeAndRemove(t *testing.T) {
+	into, err := Parse([]byte(`apiVersion: v1
+kind: Config
+current-context: work
+clusters:
+- {name: work, cluster: {server: "https://work:6443"}}
+- {name: kstack-dev, cluster: {server: "https://stale:6443"}}
+contexts:
+- {name: work, context: {cluster: work, user: work}}
+users:
+- {name: work, user: {token: w}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := Parse([]byte(`apiVersion: v1
+kind: Config
+current-context: kind-dev
+clusters:
+- {name: kind-dev, cluster: {server: "https://127.0.0.1:40000"}}
+contexts:
+- {name: kind-dev, context: {cluster: kind-dev, user: kind-dev}}
+users:
+- {name: kind-dev, user: {client-certificate-data: abc}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := into.Merge(from, "kstack-dev"); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if into.CurrentContext != "kstack-dev" || len(into.Clusters) != 2 || len(into.Contexts) != 2 || len(into.Users) != 2 {
+		t.Fatalf("unexpected merge result: %#v", into)
+	}
+	ctx, cl, _, err := into.Resolve("kstack-dev")
+	if err != nil || ctx.Cluster != "kstack-dev" || cl.Server != "https://127.0.0.1:40000" {
+		t.Fatalf("merged context not resolvable: %v %#v %#v", err, ctx, cl)
+	}
+
+	p := filepath.Join(t.TempDir(), "sub", "config")
+	if err := into.Save(p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if fi, err := os.Stat(p); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("saved kubeconfig mode: %v %v", fi, err)
+	}
+
+	if !into.Remove("kstack-dev") || into.CurrentContext != "" || len(into.Clusters) != 1 || into.Clusters[0].Name != "work" {
+		t.Fatalf("unexpected remove result: %#v", into)
+	}
+	if into.Remove("kstack-dev") {
+		t.Fatalf("second Remove should report nothing removed")
+	}
+}
+
+func TestApplyConfigMap_CreatesThenReplaces(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPost {
+			http.Error(w, `{"reason":"AlreadyExists"}`, http.StatusConflict)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	p := writeKubeconfig(t, `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster: {server: `+srv.URL+`}
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev}
+users:
+- name: dev
+  user: {}
+`)
+	if err := ApplyConfigMap(context.Background(), p, "", "kube-public", "local-registry-hosting", map[string]string{"k": "v"}); err != nil {
+		t.Fatalf("ApplyConfigMap: %v", err)
+	}
+	want := []string{"POST /api/v1/namespaces/kube-public/configmaps", "PUT /api/v1/namespaces/kube-public/configmaps/local-registry-hosting"}
+	if strings.Join(methods, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected requests: %v", methods)
+	}
+}
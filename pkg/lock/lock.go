@@ -0,0 +1,149 @@
+// Package lock reads and writes kstack.lock, which records the exact chart
+// and values every addon of a stack was installed with, so that the whole
+// team installs the same charts.
+package lock
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// FileName is the lockfile written next to the stack file.
+const FileName = "kstack.lock"
+
+// Version is the lockfile format version.
+const Version = 1
+
+const header = "# Generated by `kstack up`. Do not edit; run `kstack up --update` to re-resolve charts.\n"
+
+// File is the content of a lockfile.
+type File struct {
+	Version int     `yaml:"version"`
+	Addons  []Addon `yaml:"addons"`
+}
+
+// Addon records the chart an addon was installed from.
+type Addon struct {
+	Name string `yaml:"name"`
+	// Chart is the chart reference, e.g. grafana/grafana.
+	Chart string `yaml:"chart"`
+	// Repo is the chart repository URL; empty for local charts.
+	Repo       string `yaml:"repo,omitempty"`
+	Version    string `yaml:"version,omitempty"`
+	AppVersion string `yaml:"appVersion,omitempty"`
+	// Digest is the sha256 of the packaged chart, as in the repository index.
+	Digest string `yaml:"digest,omitempty"`
+	// ValuesHash is the sha256 of the release's user-supplied values.
+	ValuesHash string `yaml:"valuesHash,omitempty"`
+}
+
+// Path returns the lockfile belonging to stackFile, or ./kstack.lock when
+// no stack file is used.
+func Path(stackFile string) string {
+	if stackFile == "" {
+		return FileName
+	}
+	return filepath.Join(filepath.Dir(stackFile), FileName)
+}
+
+// Read loads the lockfile at path. A missing lockfile yields an empty File.
+func Read(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &File{Version: Version}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if f.Version != Version {
+		return nil, fmt.Errorf("%s: unsupported lockfile version %d (this kstack reads version %d)", path, f.Version, Version)
+	}
+	return &f, nil
+}
+
+// Write stores f at path with the addons sorted by name.
+func (f *File) Write(path string) error {
+	f.Version = Version
+	sort.Slice(f.Addons, func(i, j int) bool { return f.Addons[i].Name < f.Addons[j].Name })
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// Get returns the locked entry of addon name.
+func (f *File) Get(name string) (Addon, bool) {
+	for _, a := range f.Addons {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Addon{}, false
+}
+
+// Set adds or replaces the entry of a.Name.
+func (f *File) Set(a Addon) {
+	for i := range f.Addons {
+		if f.Addons[i].Name == a.Name {
+			f.Addons[i] = a
+			return
+		}
+	}
+	f.Addons = append(f.Addons, a)
+}
+
+// FileDigest returns the sha256 digest of the file at path as "sha256:<hex>".
+func FileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ValuesHash hashes values given as JSON (e.g. `helm get values -o json`)
+// independently of key order and formatting.
+func ValuesHash(values []byte) (string, error) {
+	var v any
+	if len(bytes.TrimSpace(values)) > 0 {
+		if err := json.Unmarshal(values, &v); err != nil {
+			return "", fmt.Errorf("parse values: %w", err)
+		}
+	}
+	if m, ok := v.(map[string]any); ok && len(m) == 0 {
+		v = nil
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,59 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	f, err := Read(path)
+	if err != nil || len(f.Addons) != 0 {
+		t.Fatalf("missing lockfile should read as empty: %v, %v", f, err)
+	}
+	f.Set(Addon{Name: "prometheus", Chart: "prometheus-community/prometheus", Version: "25.27.0"})
+	f.Set(Addon{Name: "grafana", Chart: "grafana/grafana", Version: "8.5.0"})
+	f.Set(Addon{Name: "grafana", Chart: "grafana/grafana", Version: "8.5.1", Digest: "sha256:ab"})
+	if err := f.Write(path); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	b, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(b), "# Generated by `kstack up`") || strings.Index(string(b), "grafana") > strings.Index(string(b), "prometheus") {
+		t.Fatalf("unexpected lockfile:\n%s", b)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if a, ok := got.Get("grafana"); !ok || a.Version != "8.5.1" || a.Digest != "sha256:ab" || len(got.Addons) != 2 {
+		t.Fatalf("unexpected lock: %+v", got.Addons)
+	}
+	if got := Path("/src/stack/kstack.yaml"); got != "/src/stack/kstack.lock" {
+		t.Fatalf("Path = %s", got)
+	}
+
+	os.WriteFile(path, []byte("version: 2\n"), 0o644)
+	if _, err := Read(path); err == nil || !strings.Contains(err.Error(), "unsupported lockfile version") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+}
+
+func TestValuesHash(t *testing.T) {
+	a, err := ValuesHash([]byte(`{"b": 1, "a": {"y": true, "x": "s"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ValuesHash([]byte("{\"a\":{\"x\":\"s\",\"y\":true},\n\"b\":1}"))
+	if a != b || !strings.HasPrefix(a, "sha256:") {
+		t.Fatalf("hash should not depend on key order or formatting: %s vs %s", a, b)
+	}
+	empty, _ := ValuesHash([]byte("null\n"))
+	if other, _ := ValuesHash([]byte("{}")); other != empty {
+		t.Fatalf("no values and empty values should hash alike")
+	}
+	if _, err := ValuesHash([]byte("{")); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/christk1/kstack/utils"
 )
 
 // Verbose and Debug control whether preflight helpers print full command
@@ -44,7 +46,7 @@ func CheckDocker(ctx context.Context) error {
 	// create a short-lived context if parent has none
 	cctx, cancel := context.WithTimeout(ctx, 8*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(cctx, "docker", "info")
+	cmd := utils.Command(cctx, "docker", "info")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		// Provide actionable advice
@@ -69,19 +71,14 @@ func CheckDocker(ctx context.Context) error {
 	return nil
 }
 
-// CheckProviderCLI validates provider-specific CLIs (kind or k3d).
-func CheckProviderCLI(provider string) error {
-	switch provider {
-	case "kind":
-		if _, err := exec.LookPath("kind"); err != nil {
-			return fmt.Errorf("'kind' not found in PATH. Install kind: https://kind.sigs.k8s.io/")
-		}
-	case "k3d":
-		if _, err := exec.LookPath("k3d"); err != nil {
-			return fmt.Errorf("'k3d' not found in PATH. Install k3d: https://k3d.io/")
+// CheckBinary ensures the named executable is in PATH, pointing at
+// installURL when it is not.
+func CheckBinary(name, installURL string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		if installURL == "" {
+			return fmt.Errorf("'%s' not found in PATH", name)
 		}
-	default:
-		return fmt.Errorf("unknown provider '%s'", provider)
+		return fmt.Errorf("'%s' not found in PATH. Install %s: %s", name, name, installURL)
 	}
 	return nil
 }
@@ -24,14 +24,14 @@ func writeFake(t *testing.T, name, script string) string {
 	return p
 }
 
-func TestCheckProviderCLI_Success(t *testing.T) {
+func TestCheckBinary(t *testing.T) {
 	writeFake(t, "kind", "#!/usr/bin/env bash\nexit 0\n")
-	if err := CheckProviderCLI("kind"); err != nil {
+	if err := CheckBinary("kind", "https://kind.sigs.k8s.io/"); err != nil {
 		t.Fatalf("expected success for kind in PATH: %v", err)
 	}
-	writeFake(t, "k3d", "#!/usr/bin/env bash\nexit 0\n")
-	if err := CheckProviderCLI("k3d"); err != nil {
-		t.Fatalf("expected success for k3d in PATH: %v", err)
+	err := CheckBinary("kstack-missing-provider-cli", "https://example.com/install")
+	if err == nil || !strings.Contains(err.Error(), "https://example.com/install") {
+		t.Fatalf("expected install hint in error, got %v", err)
 	}
 }
 
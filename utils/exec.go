@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// CommandGracePeriod is how long a cancelled command may take to exit after
+// SIGTERM before it is killed.
+const CommandGracePeriod = 10 * time.Second
+
+// Command is exec.CommandContext for the external tools kstack drives
+// (helm, kind, k3d, minikube, docker). When ctx is cancelled, e.g. by
+// Ctrl-C or --timeout, the process receives SIGTERM rather than SIGKILL so
+// that it can clean up (helm marks an interrupted release as failed instead
+// of leaving it pending), and is killed only if it is still running after
+// CommandGracePeriod.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = CommandGracePeriod
+	return cmd
+}
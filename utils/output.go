@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// TailLines is how many trailing lines of a command's output Tail keeps.
+const TailLines = 20
+
+// Run runs cmd and returns its combined stdout and stderr, like
+// exec.Cmd.CombinedOutput. In verbose mode every line is also logged as it
+// arrives, prefixed with "[prefix]", so that long-running commands such as
+// `helm upgrade --wait` or `kind create cluster` show their progress.
+func Run(cmd *exec.Cmd, prefix string) ([]byte, error) {
+	if !std.verbose {
+		return cmd.CombinedOutput()
+	}
+	w := &lineLogger{prefix: prefix}
+	// one writer for both streams, so exec never calls Write concurrently
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	w.flush()
+	return w.buf.Bytes(), err
+}
+
+// Tail returns the last TailLines lines of a command's output for quoting
+// in an error, noting how many lines were left out.
+func Tail(out []byte) string {
+	s := strings.TrimRight(string(out), "\n")
+	lines := strings.Split(s, "\n")
+	if len(lines) <= TailLines {
+		return s
+	}
+	return fmt.Sprintf("... (%d earlier lines omitted)\n%s", len(lines)-TailLines, strings.Join(lines[len(lines)-TailLines:], "\n"))
+}
+
+// lineLogger collects a command's output and logs each complete line.
+type lineLogger struct {
+	prefix string
+	buf    bytes.Buffer
+	// logged is the offset of the first byte not logged yet.
+	logged int
+}
+
+func (w *lineLogger) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		rest := w.buf.Bytes()[w.logged:]
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.log(rest[:i])
+		w.logged += i + 1
+	}
+}
+
+// flush logs a last line that did not end in a newline.
+func (w *lineLogger) flush() {
+	if w.logged < w.buf.Len() {
+		w.log(w.buf.Bytes()[w.logged:])
+		w.logged = w.buf.Len()
+	}
+}
+
+func (w *lineLogger) log(line []byte) {
+	Debug("[%s] %s", w.prefix, strings.TrimRight(string(line), "\r"))
+}
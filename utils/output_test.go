@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRun_StreamsLinesInVerboseMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skip on windows")
+	}
+	buf := &bytes.Buffer{}
+	prev := std
+	t.Cleanup(func() { std = prev })
+	std = &Logger{verbose: true, logger: log.New(buf, "", 0)}
+
+	out, err := Run(exec.Command("sh", "-c", "echo one; echo two >&2; printf three; exit 3"), "grafana")
+	if err == nil {
+		t.Fatalf("expected the exit status as error")
+	}
+	if string(out) != "one\ntwo\nthree" {
+		t.Fatalf("unexpected combined output %q", out)
+	}
+	for _, want := range []string{"DEBUG: [grafana] one\n", "DEBUG: [grafana] two\n", "DEBUG: [grafana] three\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected %q in log:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	std.verbose = false
+	if out, err := Run(exec.Command("sh", "-c", "echo quiet"), "kind"); err != nil || string(out) != "quiet\n" {
+		t.Fatalf("unexpected output %q, %v", out, err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing logged outside verbose mode, got %q", buf.String())
+	}
+}
+
+func TestTail(t *testing.T) {
+	if got := Tail([]byte("a\nb\n")); got != "a\nb" {
+		t.Fatalf("short output should be kept whole, got %q", got)
+	}
+	var b strings.Builder
+	for i := 1; i <= TailLines+5; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	got := Tail([]byte(b.String()))
+	if !strings.HasPrefix(got, "... (5 earlier lines omitted)\nline 6\n") || !strings.HasSuffix(got, fmt.Sprintf("line %d", TailLines+5)) {
+		t.Fatalf("unexpected tail:\n%s", got)
+	}
+}
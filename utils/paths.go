@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// StateDir returns the directory kstack keeps per-user state in (managed
+// kubeconfigs, caches). It is $KSTACK_HOME if set, otherwise
+// $XDG_STATE_HOME/kstack, defaulting to ~/.local/state/kstack.
+func StateDir() string {
+	if dir := os.Getenv("KSTACK_HOME"); dir != "" {
+		return dir
+	}
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return filepath.Join(os.TempDir(), "kstack")
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "kstack")
+}
@@ -17,9 +17,11 @@ type Spinner struct {
 // NewSpinner creates a new spinner with a message prefix.
 func NewSpinner(msg string) *Spinner { return &Spinner{msg: msg, stopCh: make(chan struct{})} }
 
-// Start begins the spinner animation. If already running, it's a no-op.
+// Start begins the spinner animation. If already running, it's a no-op. In
+// verbose mode the spinner stays hidden so that it does not garble the
+// command output streamed by Run.
 func (s *Spinner) Start() {
-	if s.running {
+	if s.running || std.verbose {
 		return
 	}
 	s.running = true